@@ -9,7 +9,9 @@ import (
 	"runtime"
 	"syscall"
 	"time"
+	"towd/src-server/cli"
 	"towd/src-server/handler"
+	"towd/src-server/handler/calendar_handler"
 	"towd/src-server/handler/event_handler"
 	"towd/src-server/handler/kanban_handler"
 	"towd/src-server/metric"
@@ -39,6 +41,11 @@ func init() {
 }
 
 func main() {
+	// the command line tools, e.g. `towd ical lint`, run without the bot
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// There are 2 important things (and others) inside the AppState:
 	// - appCmdInfo: a map of all slash commands
 	// - appCmdHandler: a map of all slash command handlers
@@ -52,8 +59,7 @@ func main() {
 	// injecting interaction handlers into appCmdInfo, appCmdHandler in AppState
 	event_handler.Init(as)
 	kanban_handler.Init(as)
-	handler.ImportCalendar(as)
-	handler.DeleteCalendar(as)
+	calendar_handler.Init(as)
 	handler.Ping(as)
 	handler.Login(as)
 
@@ -136,6 +142,7 @@ func main() {
 		muxer.Handle("GET /metrics", promhttp.Handler())
 		route.Auth(muxer, as)
 		route.Ical(muxer, as)
+		route.FreeBusy(muxer, as)
 		route.Calendar(muxer, as)
 		route.Kanban(muxer, as)
 		route.SPA(muxer, as)
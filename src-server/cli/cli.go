@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// The exit codes of the command line tools
+const (
+	ExitOK      = 0
+	ExitProblem = 1 // the tool ran and found problems
+	ExitUsage   = 2 // the tool couldn't run, e.g. bad arguments
+)
+
+const usage = `Usage:
+  towd                              run the bot
+  towd ical lint [-strict=false] <file|URL|->...
+                                    check iCalendar files
+`
+
+// Run a command line tool, e.g. `towd ical lint calendar.ics`, and get its exit
+// code. The arguments don't include the program name.
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	switch {
+	case len(args) >= 2 && args[0] == "ical" && args[1] == "lint":
+		return IcalLint(args[2:], stdout, stderr)
+	case len(args) >= 1 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help"):
+		fmt.Fprint(stdout, usage)
+		return ExitOK
+	default:
+		fmt.Fprint(stderr, usage)
+		return ExitUsage
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+	"towd/src-server/ical"
+)
+
+// Check iCalendar files or URLs with the parser used by the imports, and
+// report every problem along with a suggested fix. The lint is strict by
+// default: it exits with ExitProblem if an event, or anything else, would be
+// skipped, or if a property would be ignored. With -strict=false, only the
+// skipped components fail it. For example:
+//
+//	$ towd ical lint calendar.ics
+//	calendar.ics:12: error: event "Standup" skipped: start date is missing
+//	    fix: add a DTSTART property, e.g. DTSTART:20250101T090000Z
+//	calendar.ics: 1 error, 0 warnings, 41 events
+func IcalLint(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("towd ical lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	strict := flags.Bool("strict", true, "fail on warnings too, e.g. an invalid property being ignored")
+	timeout := flags.Duration("timeout", time.Minute, "the time limit to fetch and parse each calendar")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: towd ical lint [-strict=false] [-timeout 1m] <file|URL|->...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	exitCode := ExitOK
+	for _, source := range flags.Args() {
+		diagnostics, eventCount, err := lintIcal(source, *timeout)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", source, err)
+			exitCode = max(exitCode, ExitUsage)
+			continue
+		}
+
+		// the overrides are checked once the whole calendar is read
+		sort.SliceStable(diagnostics, func(i, j int) bool {
+			return diagnostics[i].Line < diagnostics[j].Line
+		})
+		for _, diagnostic := range diagnostics {
+			position := source
+			if diagnostic.Line != 0 {
+				position += fmt.Sprintf(":%d", diagnostic.Line)
+			}
+			if diagnostic.Column != 0 {
+				position += fmt.Sprintf(":%d", diagnostic.Column)
+			}
+			fmt.Fprintf(stdout, "%s: %s: %s\n", position, diagnostic.Severity, diagnostic.Message)
+			if suggestion := diagnostic.Suggestion(); suggestion != "" {
+				fmt.Fprintf(stdout, "    fix: %s\n", suggestion)
+			}
+		}
+		errorCount := ical.CountDiagnostics(diagnostics, ical.DiagnosticSeverityError)
+		warningCount := ical.CountDiagnostics(diagnostics, ical.DiagnosticSeverityWarning)
+		fmt.Fprintf(stdout, "%s: %s, %s, %s\n", source,
+			plural(errorCount, "error"), plural(warningCount, "warning"), plural(eventCount, "event"))
+
+		if errorCount > 0 || (*strict && warningCount > 0) {
+			exitCode = max(exitCode, ExitProblem)
+		}
+	}
+	return exitCode
+}
+
+// Parse a calendar from a file, a URL, or the standard input if the source is
+// "-". The problems stopping the parsing are among the diagnostics; the error
+// is about reading the source. The parser runs in lenient mode even for a
+// strict lint, since its strict mode stops at the first error and the lint
+// reports every problem; IcalLint applies the strictness to the outcome.
+func lintIcal(source string, timeout time.Duration) ([]ical.Diagnostic, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		calendar    *ical.Calendar
+		diagnostics []ical.Diagnostic
+		customErr   *ical.CustomError
+	)
+	switch parsedURL, err := url.Parse(source); {
+	case source == "-":
+		calendar, diagnostics, customErr = ical.Parse(ctx, os.Stdin, ical.ParseOptions{})
+	case err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https"):
+		calendar, diagnostics, customErr = ical.FetchIcal(ctx, source, ical.ParseOptions{})
+		if customErr != nil && diagnostics == nil {
+			return nil, 0, customErr
+		}
+	default:
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer file.Close()
+		calendar, diagnostics, customErr = ical.Parse(ctx, file, ical.ParseOptions{})
+	}
+	if ctx.Err() != nil {
+		return nil, 0, fmt.Errorf("timed out after %s", timeout)
+	}
+	if customErr != nil {
+		return append(diagnostics, customErr.Diagnostic()), 0, nil
+	}
+	return diagnostics, calendar.GetMasterEventCount(), nil
+}
+
+// Format a count, e.g. 1 error or 2 errors
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
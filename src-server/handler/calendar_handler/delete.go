@@ -1,4 +1,4 @@
-package handler
+package calendar_handler
 
 import (
 	"context"
@@ -14,10 +14,10 @@ import (
 	"github.com/uptrace/bun"
 )
 
-func DeleteCalendar(as *utils.AppState) {
-	id := "delete-calendar"
-	as.AddAppCmdHandler(id, deleteCalendarHandler(as))
-	as.AddAppCmdInfo(id, &discordgo.ApplicationCommand{
+func deleteCalendar(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "delete"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
 		Name:        id,
 		Description: "Delete an external calendar.",
 		Options: []*discordgo.ApplicationCommandOption{
@@ -29,6 +29,7 @@ func DeleteCalendar(as *utils.AppState) {
 			},
 		},
 	})
+	cmdHandler[id] = deleteCalendarHandler(as)
 }
 
 func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
@@ -43,7 +44,7 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 				Flags: discordgo.MessageFlagsEphemeral,
 			},
 		}); err != nil {
-			slog.Warn("deleteCalendarHandler: can't send defer message", "error", err)
+			slog.Warn("calendar_handler:delete: can't send defer message", "error", err)
 			return nil
 		}
 		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
@@ -51,7 +52,7 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 		// get the calendar ID
 		calendarID := func() string {
 			options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, 0)
-			for _, opt := range i.ApplicationCommandData().Options {
+			for _, opt := range i.ApplicationCommandData().Options[0].Options {
 				options[opt.Name] = opt
 			}
 			if opt, ok := options["calendar-id"]; ok {
@@ -65,7 +66,7 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 				Content: &msg,
 			}); err != nil {
-				slog.Warn("deleteCalendarHandler: can't send message about calendar ID is empty", "error", err)
+				slog.Warn("calendar_handler:delete: can't send message about calendar ID is empty", "error", err)
 			}
 			return nil
 		}
@@ -83,15 +84,15 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 				Content: &msg,
 			}); err != nil {
-				slog.Warn("deleteCalendarHandler: can't send message about can't check if calendar exists", "error", err)
+				slog.Warn("calendar_handler:delete: can't send message about can't check if calendar exists", "error", err)
 			}
-			return fmt.Errorf("deleteCalendarHandler: can't check if calendar exists: %w", err)
+			return fmt.Errorf("calendar_handler:delete: can't check if calendar exists: %w", err)
 		case !exists:
 			msg := "Calendar not found."
 			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 				Content: &msg,
 			}); err != nil {
-				slog.Warn("deleteCalendarHandler: can't send message about calendar not found", "error", err)
+				slog.Warn("calendar_handler:delete: can't send message about calendar not found", "error", err)
 			}
 			return nil
 		}
@@ -106,9 +107,9 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 				Content: &msg,
 			}); err != nil {
-				slog.Warn("deleteCalendarHandler: can't send message about can't get calendar", "error", err)
+				slog.Warn("calendar_handler:delete: can't send message about can't get calendar", "error", err)
 			}
-			return fmt.Errorf("deleteCalendarHandler: can't get calendar: %w", err)
+			return fmt.Errorf("calendar_handler:delete: can't get calendar: %w", err)
 		}
 
 		// delete the calendar
@@ -121,6 +122,36 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 				Exec(ctx); err != nil {
 				return fmt.Errorf("transaction: can't delete calendar model: %w", err)
 			}
+			if _, err := tx.NewDelete().
+				Model((*model.EventOverride)(nil)).
+				Where("event_id IN (?)", tx.NewSelect().
+					Model((*model.Event)(nil)).
+					Column("id").
+					Where("calendar_id = ?", calendarID).
+					Where("channel_id = ?", interaction.ChannelID)).
+				Exec(ctx); err != nil {
+				return fmt.Errorf("transaction: can't delete event override models: %w", err)
+			}
+			if _, err := tx.NewDelete().
+				Model((*model.Alarm)(nil)).
+				Where("event_id IN (?)", tx.NewSelect().
+					Model((*model.Event)(nil)).
+					Column("id").
+					Where("calendar_id = ?", calendarID).
+					Where("channel_id = ?", interaction.ChannelID)).
+				Exec(ctx); err != nil {
+				return fmt.Errorf("transaction: can't delete event alarm models: %w", err)
+			}
+			if _, err := tx.NewDelete().
+				Model((*model.Attendee)(nil)).
+				Where("event_id IN (?)", tx.NewSelect().
+					Model((*model.Event)(nil)).
+					Column("id").
+					Where("calendar_id = ?", calendarID).
+					Where("channel_id = ?", interaction.ChannelID)).
+				Exec(ctx); err != nil {
+				return fmt.Errorf("transaction: can't delete attendee models: %w", err)
+			}
 			if _, err := tx.NewDelete().
 				Model((*model.Event)(nil)).
 				Where("calendar_id = ?", calendarID).
@@ -134,18 +165,24 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 				Content: &msg,
 			}); err != nil {
-				slog.Warn("deleteCalendarHandler: can't respond about can't delete calendar", "error", err)
+				slog.Warn("calendar_handler:delete: can't respond about can't delete calendar", "error", err)
 			}
-			return fmt.Errorf("deleteCalendarHandler: can't delete calendar: %w", err)
+			return fmt.Errorf("calendar_handler:delete: can't delete calendar: %w", err)
 		}
 		as.MetricChans.DatabaseWrite <- float64(time.Since(startTimer).Microseconds())
 
+		// the calendars imported from a file have no link
+		label := fmt.Sprintf("`%s`", externalCalendarModel.Name)
+		if externalCalendarModel.Url != "" {
+			label = fmt.Sprintf("[%s](%s)", externalCalendarModel.Name, externalCalendarModel.Url)
+		}
+
 		// edit the deferred message (ephemeral)
-		msg := fmt.Sprintf("Calendar [%s](%s) deleted.", externalCalendarModel.Name, externalCalendarModel.Url)
+		msg := fmt.Sprintf("Calendar %s deleted.", label)
 		if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
 			Content: &msg,
 		}); err != nil {
-			slog.Warn("deleteCalendarHandler: can't respond about calendar deletion success", "error", err)
+			slog.Warn("calendar_handler:delete: can't respond about calendar deletion success", "error", err)
 		}
 
 		// announce the calendar deletion
@@ -156,11 +193,11 @@ func deleteCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *dis
 			} else {
 				sb.WriteString("Deleted")
 			}
-			sb.WriteString(fmt.Sprintf(" calendar [%s](%s).", externalCalendarModel.Name, externalCalendarModel.Url))
+			sb.WriteString(fmt.Sprintf(" calendar %s.", label))
 			return sb.String()
 		}()
 		if _, err := s.ChannelMessageSend(interaction.ChannelID, msg); err != nil {
-			slog.Warn("deleteCalendarHandler: can't send message about calendar deletion success", "error", err)
+			slog.Warn("calendar_handler:delete: can't send message about calendar deletion success", "error", err)
 		}
 
 		return nil
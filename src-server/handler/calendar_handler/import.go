@@ -0,0 +1,700 @@
+package calendar_handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/ical/event"
+	"towd/src-server/ical/structured"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/uptrace/bun"
+)
+
+func importCalendar(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "import"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        id,
+		Description: "Import an external calendar from a URL or an .ics file.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "url",
+				Description: "The URL of the external calendar, refreshed periodically",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "An .ics file exported from a calendar app, imported once",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "Override the calendar name",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "kanban-group",
+				Description: "Add the calendar's todos to this Kanban group",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "refresh-interval",
+				Description: "How often to refresh the calendar, e.g. 30m or 6h",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "merge",
+				Description: "Copy the events into the channel calendar instead of keeping a separate calendar",
+				Required:    false,
+			},
+		},
+	})
+	cmdHandler[id] = importCalendarHandler(as)
+}
+
+// The options of /calendar import
+type importOptions struct {
+	url             string                       // blank if the calendar is a file
+	attachment      *discordgo.MessageAttachment // nil if the calendar is a URL
+	nameOverride    string
+	kanbanGroup     string
+	refreshInterval time.Duration
+	merge           bool // copy the events into the channel calendar, once
+}
+
+// Get where the calendar is fetched from
+func (o importOptions) sourceURL() string {
+	if o.attachment != nil {
+		return o.attachment.URL
+	}
+	return o.url
+}
+
+// Describe the calendar for Discord, as a link if it has a URL
+func (o importOptions) label(name string) string {
+	if o.attachment != nil {
+		return fmt.Sprintf("`%s` (from `%s`)", name, o.attachment.Filename)
+	}
+	return fmt.Sprintf("[%s](%s)", name, o.url)
+}
+
+func importCalendarHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		interaction := i.Interaction
+
+		// #region - respond w/ deferred
+		startTimer := time.Now()
+		if err := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			slog.Warn("calendar_handler:import: can't send defer message", "error", err)
+			return nil
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+		// #endregion
+
+		// #region - parse input parameters & validate URL
+		opts, err := func() (importOptions, error) {
+			opts := importOptions{}
+			data := i.ApplicationCommandData()
+			options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, 0)
+			for _, opt := range data.Options[0].Options {
+				options[opt.Name] = opt
+			}
+			if opt, ok := options["url"]; ok {
+				opts.url = strings.TrimSpace(opt.StringValue())
+			}
+			if opt, ok := options["file"]; ok {
+				if attachmentID, ok := opt.Value.(string); ok && data.Resolved != nil {
+					opts.attachment = data.Resolved.Attachments[attachmentID]
+				}
+				if opts.attachment == nil {
+					return opts, fmt.Errorf("can't get the uploaded file")
+				}
+			}
+			if opt, ok := options["name"]; ok {
+				opts.nameOverride = opt.StringValue()
+			}
+			if opt, ok := options["kanban-group"]; ok {
+				opts.kanbanGroup = strings.TrimSpace(opt.StringValue())
+			}
+			if opt, ok := options["merge"]; ok {
+				opts.merge = opt.BoolValue()
+			}
+			if opt, ok := options["refresh-interval"]; ok {
+				var err error
+				if opts.refreshInterval, err = time.ParseDuration(strings.TrimSpace(opt.StringValue())); err != nil {
+					return opts, fmt.Errorf("invalid refresh interval: %w", err)
+				}
+				if opts.refreshInterval < model.MinRefreshInterval {
+					return opts, fmt.Errorf("the refresh interval must be at least %s", model.MinRefreshInterval)
+				}
+			}
+
+			switch {
+			case (opts.url == "") == (opts.attachment == nil):
+				return opts, fmt.Errorf("provide either a URL or a file")
+			case opts.refreshInterval != 0 && (opts.attachment != nil || opts.merge):
+				return opts, fmt.Errorf("only the calendars imported from a URL, without merging, are refreshed")
+			case opts.attachment != nil && int64(opts.attachment.Size) > ical.DefaultMaxSize:
+				return opts, fmt.Errorf("the file is larger than %d MiB", ical.DefaultMaxSize>>20)
+			case opts.url != "":
+				if _, err := url.ParseRequestURI(opts.url); err != nil {
+					return opts, err
+				}
+			}
+			return opts, nil
+		}()
+		if err != nil {
+			msg := err.Error()
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about invalid input", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - calendar already exists?
+		// the files and the merged calendars don't have a URL to compare
+		exists := false
+		if opts.url != "" && !opts.merge {
+			exists, err = as.BunDB.
+				NewSelect().
+				Model((*model.ExternalCalendar)(nil)).
+				Where("url = ?", opts.url).
+				Where("channel_id = ?", interaction.ChannelID).
+				Exists(context.Background())
+		}
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("Can't check if calendar exists\n```\n%s\n```", err.Error())
+			if _, err2 := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err2 != nil {
+				slog.Warn("calendar_handler:import: can't send message about can't check if calendar exists", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:import: can't check if calendar exists: %w", err)
+		case exists:
+			msg := "Calendar already exists in the database."
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about calendar already exists", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - kanban group exists?
+		if opts.kanbanGroup != "" {
+			exists, err := as.BunDB.
+				NewSelect().
+				Model((*model.KanbanGroup)(nil)).
+				Where("name = ?", opts.kanbanGroup).
+				Where("channel_id = ?", interaction.ChannelID).
+				Exists(context.Background())
+			switch {
+			case err != nil:
+				msg := fmt.Sprintf("Can't check if Kanban group exists\n```\n%s\n```", err.Error())
+				if _, err2 := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+					Content: &msg,
+				}); err2 != nil {
+					slog.Warn("calendar_handler:import: can't send message about can't check if kanban group exists", "error", err)
+				}
+				return fmt.Errorf("calendar_handler:import: can't check if kanban group exists: %w", err)
+			case !exists:
+				msg := fmt.Sprintf("Kanban group `%s` not found.", opts.kanbanGroup)
+				if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+					Content: &msg,
+				}); err != nil {
+					slog.Warn("calendar_handler:import: can't send message about kanban group not found", "error", err)
+				}
+				return nil
+			}
+		}
+		// #endregion
+
+		// #region - fetch & parse calendar
+		fetchResult, isTimedOut, err := func() (ical.FetchResult, bool, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			// the validators are kept for the later refreshes
+			result, err := ical.FetchIcalIfChanged(ctx, opts.sourceURL(), ical.FetchValidators{}, ical.ParseOptions{})
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				return ical.FetchResult{}, true, nil
+			case err != nil:
+				return ical.FetchResult{}, false, err
+			}
+			return result, false, nil
+		}()
+		calendar := fetchResult.Calendar
+		skippedCount := ical.CountDiagnostics(fetchResult.Diagnostics, ical.DiagnosticSeverityError)
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("Can't fetch calendar.\n```\n%s\n```", err.Error())
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about can't fetch calendar", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:import: can't fetch calendar: %w", err)
+		case isTimedOut:
+			msg := "Timed out waiting for calendar to be fetched & parsed."
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about timed out waiting for calendar to be fetched & parsed", "error", err)
+			}
+			return nil
+		case calendar == nil:
+			msg := "Something went wrong."
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about something went wrong", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:import: something went wrong, iCalendar is not supposed to be nil")
+		}
+		// #endregion
+
+		// #region - overwrite calendar name if provided
+		switch {
+		case opts.nameOverride != "":
+			calendar.SetName(opts.nameOverride)
+		case calendar.GetName() == "" && opts.attachment != nil:
+			calendar.SetName(strings.TrimSuffix(opts.attachment.Filename, path.Ext(opts.attachment.Filename)))
+		case calendar.GetName() == "":
+			calendar.SetName("Untitled")
+		}
+		// #endregion
+
+		// #region - events already imported?
+		// the event IDs come from the UIDs, so the events already imported in
+		// another calendar of the channel would clash. A file imported again,
+		// e.g. an updated export, updates the calendar it was imported as.
+		var updatedCalendarModel *model.ExternalCalendar
+		importedCalendarModels, err := func() ([]model.ExternalCalendar, error) {
+			eventIDs := make([]string, 0, calendar.GetMasterEventCount())
+			if err := calendar.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+				eventIDs = append(eventIDs, model.EventIDFromIcal(masterEvent.GetID(), interaction.ChannelID))
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			// the merged events are updated in the channel calendar
+			targetCalendarID := calendar.GetID()
+			if opts.merge {
+				targetCalendarID = interaction.ChannelID
+			}
+			return findImportedCalendars(context.Background(), as.BunDB, interaction.ChannelID, targetCalendarID, eventIDs)
+		}()
+		switch {
+		case err != nil:
+			msg := fmt.Sprintf("Can't check if the events were imported before\n```\n%s\n```", err.Error())
+			if _, err2 := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err2 != nil {
+				slog.Warn("calendar_handler:import: can't send message about can't check if the events were imported before", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:import: can't check if the events were imported before: %w", err)
+		case len(importedCalendarModels) == 1 && opts.attachment != nil && !opts.merge &&
+			importedCalendarModels[0].Url == "" && importedCalendarModels[0].ID != interaction.ChannelID:
+			updatedCalendarModel = &importedCalendarModels[0]
+			if opts.nameOverride == "" {
+				calendar.SetName(updatedCalendarModel.Name)
+			}
+		case len(importedCalendarModels) > 0:
+			names := make([]string, 0, len(importedCalendarModels))
+			hint := "Delete it with `/calendar delete` first."
+			for _, importedCalendarModel := range importedCalendarModels {
+				if importedCalendarModel.ID == interaction.ChannelID {
+					names = append(names, "the channel calendar")
+					hint = "Use `merge` to update the channel calendar."
+					continue
+				}
+				names = append(names, fmt.Sprintf("calendar `%s` (`%s`)", importedCalendarModel.Name, importedCalendarModel.ID))
+			}
+			msg := fmt.Sprintf("Some events are already imported as %s. %s", strings.Join(names, ", "), hint)
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send message about events already imported", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - ask for confirmation to continue
+		cancelButtonID := "cancel-import-calendar" + calendar.GetID()
+		cancelCh := make(chan struct{}, 1)
+		defer close(cancelCh)
+		as.AddAppCmdHandler(cancelButtonID, func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+			interaction = i.Interaction
+			cancelCh <- struct{}{}
+			return nil
+		})
+		defer as.RemoveAppCmdHandler(cancelButtonID)
+
+		confirmButtonID := "confirm-import-calendar" + calendar.GetID()
+		confirmCh := make(chan struct{}, 1)
+		defer close(confirmCh)
+		as.AddAppCmdHandler(confirmButtonID, func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+			interaction = i.Interaction
+			confirmCh <- struct{}{}
+			return nil
+		})
+		defer as.RemoveAppCmdHandler(confirmButtonID)
+
+		// send msg to ask for confirmation
+		msg := fmt.Sprintf(
+			"Found `%d` events in `%s`.",
+			calendar.GetMasterEventCount(),
+			calendar.GetName(),
+		)
+		if opts.kanbanGroup != "" {
+			msg = fmt.Sprintf(
+				"Found `%d` events and `%d` todos in `%s`, the todos will be added to `%s`.",
+				calendar.GetMasterEventCount(),
+				calendar.GetTodoCount(),
+				calendar.GetName(),
+				opts.kanbanGroup,
+			)
+		}
+		switch {
+		case opts.merge:
+			msg += " The events will be copied into the channel calendar."
+		case updatedCalendarModel != nil:
+			msg += fmt.Sprintf(" It was imported before as `%s`, its events will be replaced.", updatedCalendarModel.Name)
+		}
+		if skippedCount > 0 {
+			msg += fmt.Sprintf(" `%d` skipped:\n```\n%s\n```", skippedCount, formatDiagnostics(fetchResult.Diagnostics, 10))
+		}
+		msg += "\nContinue?"
+		if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+			Content: &msg,
+			Components: &[]discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							CustomID: confirmButtonID,
+							Label:    "Import",
+							Style:    discordgo.PrimaryButton,
+						},
+						discordgo.Button{
+							CustomID: cancelButtonID,
+							Label:    "Cancel",
+							Style:    discordgo.DangerButton,
+						},
+					},
+				}},
+		}); err != nil {
+			return fmt.Errorf("calendar_handler:import: can't ask for confirmation: %w", err)
+		}
+
+		select {
+		case <-cancelCh:
+			// response the cancel button
+			if err := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: "Calendar import canceled.",
+					Flags:   discordgo.MessageFlagsEphemeral,
+				},
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't respond about calendar import canceled", "error", err)
+			}
+			return nil
+		case <-time.After(time.Minute * 2):
+			// edit the ask-to-confirm message
+			msg := "Timed out waiting for confirmation."
+			if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+				Content:    &msg,
+				Components: &[]discordgo.MessageComponent{},
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't respond about calendar import timed out", "error", err)
+			}
+			return nil
+		case <-confirmCh:
+			if err := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Flags: discordgo.MessageFlagsEphemeral,
+				},
+			}); err != nil {
+				slog.Warn("calendar_handler:import: can't send defer message to later edit to calendar import success", "error", err)
+			}
+		}
+		// #endregion
+
+		// #region - insert to DB
+		syncResult := model.SyncResult{}
+		if err := as.BunDB.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+			switch {
+			case opts.merge:
+				// the channel calendar may not exist yet, e.g. no event was
+				// created in the channel
+				channelName := "Untitled"
+				if channel, err := s.Channel(interaction.ChannelID); err == nil && channel.Name != "" {
+					channelName = channel.Name
+				}
+				if _, err := tx.NewInsert().
+					Model(&model.Calendar{
+						ChannelID: interaction.ChannelID,
+						Name:      channelName,
+					}).
+					On("CONFLICT (channel_id) DO NOTHING").
+					Exec(ctx); err != nil {
+					return err
+				}
+
+				// the events imported before are updated
+				eventModels := make([]model.Event, 0)
+				if err := calendar.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+					eventModels = append(eventModels, model.EventFromIcal(masterEvent, interaction.ChannelID, interaction.ChannelID))
+					return nil
+				}); err != nil {
+					return err
+				}
+				if _, err := model.MergeEvents(ctx, tx, interaction.ChannelID, eventModels); err != nil {
+					return err
+				}
+			case updatedCalendarModel != nil:
+				// keep the ID of the calendar imported before, and of its
+				// events
+				updatedCalendarModel.ProdID = calendar.GetProdID()
+				updatedCalendarModel.Name = calendar.GetName()
+				updatedCalendarModel.Description = calendar.GetDescription()
+				if _, err := tx.NewUpdate().
+					Model(updatedCalendarModel).
+					Column("prod_id", "name", "description").
+					WherePK().
+					Exec(ctx); err != nil {
+					return err
+				}
+
+				eventModels := make([]model.Event, 0)
+				if err := calendar.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+					eventModels = append(eventModels, model.EventFromIcal(masterEvent, updatedCalendarModel.ID, interaction.ChannelID))
+					return nil
+				}); err != nil {
+					return err
+				}
+				var err error
+				if syncResult, err = model.SyncEvents(ctx, tx, updatedCalendarModel.ID, eventModels); err != nil {
+					return err
+				}
+			default:
+				// create new calendar model and insert to DB
+				calendarModel := model.ExternalCalendar{
+					ID:          calendar.GetID(),
+					ProdID:      calendar.GetProdID(),
+					Name:        calendar.GetName(),
+					Description: calendar.GetDescription(),
+					ChannelID:   interaction.ChannelID,
+				}
+				if opts.url != "" {
+					calendarModel.Url = opts.url
+					calendarModel.Hash = fetchResult.Validators.Hash
+					calendarModel.ETag = fetchResult.Validators.ETag
+					calendarModel.LastModified = fetchResult.Validators.LastModified
+					calendarModel.RefreshInterval = int64(opts.refreshInterval.Seconds())
+					// the calendar was just fetched, the first refresh is due
+					// after an interval
+					calendarModel.RecordRefresh(time.Now().UTC(), nil, as.Config.GetCalendarUpdateInterval())
+				}
+				if _, err := tx.
+					NewInsert().
+					Model(&calendarModel).
+					Exec(ctx); err != nil {
+					return err
+				}
+
+				// the recurring events are stored with their recurrence, they're
+				// expanded on read
+				eventModels := make([]model.Event, 0)
+				if err := calendar.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+					eventModels = append(eventModels, model.EventFromIcal(masterEvent, calendarModel.ID, interaction.ChannelID))
+					return nil
+				}); err != nil {
+					return err
+				}
+				if err := model.InsertEvents(ctx, tx, eventModels); err != nil {
+					return err
+				}
+			}
+
+			if opts.kanbanGroup == "" {
+				return nil
+			}
+			itemModels := make([]model.KanbanItem, 0)
+			if err := calendar.IterateTodos(func(id string, todo *structured.Todo) error {
+				if itemModel, ok := model.KanbanItemFromIcalTodo(todo, opts.kanbanGroup, interaction.ChannelID); ok {
+					itemModels = append(itemModels, itemModel)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if len(itemModels) == 0 {
+				return nil
+			}
+			if _, err := tx.NewInsert().
+				Model(&itemModels).
+				Exec(ctx); err != nil {
+				return err
+			}
+
+			return nil
+		}); err != nil {
+			// response the confirm button
+			if err2 := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: fmt.Sprintf("Can't import calendar.\n```\n%s\n```", err.Error()),
+				},
+			}); err2 != nil {
+				slog.Warn("calendar_handler:import: can't respond about can't import calendar", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:import: can't import calendar: %w", err)
+		}
+		// #endregion
+
+		// #region - response the confirm button (ephemeral) & announce the calendar import
+		msg = fmt.Sprintf("Calendar %s imported successfully.", opts.label(calendar.GetName()))
+		switch {
+		case updatedCalendarModel != nil:
+			msg = fmt.Sprintf(
+				"Calendar %s updated: `%d` added, `%d` updated, `%d` removed.",
+				opts.label(calendar.GetName()), syncResult.Added, syncResult.Updated, syncResult.Removed,
+			)
+		case skippedCount > 0:
+			msg = fmt.Sprintf(
+				"Calendar %s imported: `%d` events, `%d` skipped.",
+				opts.label(calendar.GetName()), calendar.GetMasterEventCount(), skippedCount,
+			)
+		}
+		if _, err := s.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+			Content: &msg,
+		}); err != nil {
+			slog.Warn("calendar_handler:import: can't respond about calendar import success", "error", err)
+		}
+
+		msg = func() string {
+			var sb strings.Builder
+			verb := "imported"
+			if updatedCalendarModel != nil {
+				verb = "updated"
+			}
+			if i.Member != nil && i.Member.User != nil {
+				sb.WriteString(fmt.Sprintf("<@%s> %s", i.Member.User.ID, verb))
+			} else {
+				sb.WriteString(strings.ToUpper(verb[:1]) + verb[1:])
+			}
+			sb.WriteString(fmt.Sprintf(" calendar %s", opts.label(calendar.GetName())))
+			if opts.merge {
+				sb.WriteString(" into the channel calendar")
+			}
+			sb.WriteString(".")
+			return sb.String()
+		}()
+		if _, err := s.ChannelMessageSend(interaction.ChannelID, msg); err != nil {
+			slog.Warn("calendar_handler:import: can't send message about calendar import success", "error", err)
+		}
+		// #endregion
+
+		return nil
+	}
+}
+
+// Get the calendars of the channel, other than the given one, already holding
+// some of the events, e.g. the same file imported before. The channel calendar
+// is among them with the ID of its channel.
+func findImportedCalendars(ctx context.Context, db bun.IDB, channelID string, calendarID string, eventIDs []string) ([]model.ExternalCalendar, error) {
+	if len(eventIDs) == 0 {
+		return nil, nil
+	}
+	calendarIDs := make([]string, 0)
+	if err := db.NewSelect().
+		Model((*model.Event)(nil)).
+		Distinct().
+		Column("calendar_id").
+		Where("id IN (?)", bun.In(eventIDs)).
+		Where("channel_id = ?", channelID).
+		Where("calendar_id != ?", calendarID).
+		Scan(ctx, &calendarIDs); err != nil {
+		return nil, fmt.Errorf("can't get the calendars of the events: %w", err)
+	}
+
+	calendarModels := make([]model.ExternalCalendar, 0, len(calendarIDs))
+	for _, id := range calendarIDs {
+		if id == channelID {
+			channelCalendarModel := new(model.Calendar)
+			if err := db.NewSelect().
+				Model(channelCalendarModel).
+				Where("channel_id = ?", channelID).
+				Scan(ctx); err != nil {
+				return nil, fmt.Errorf("can't get channel calendar: %w", err)
+			}
+			calendarModels = append(calendarModels, model.ExternalCalendar{
+				ID:        channelCalendarModel.ChannelID,
+				Name:      channelCalendarModel.Name,
+				ChannelID: channelCalendarModel.ChannelID,
+			})
+			continue
+		}
+		calendarModel := model.ExternalCalendar{}
+		if err := db.NewSelect().
+			Model(&calendarModel).
+			Where("id = ?", id).
+			Scan(ctx); err != nil {
+			return nil, fmt.Errorf("can't get calendar %s: %w", id, err)
+		}
+		calendarModels = append(calendarModels, calendarModel)
+	}
+	return calendarModels, nil
+}
+
+// List the errors among the diagnostics, one per line, up to limit lines
+func formatDiagnostics(diagnostics []ical.Diagnostic, limit int) string {
+	lines := make([]string, 0, limit)
+	count := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity != ical.DiagnosticSeverityError {
+			continue
+		}
+		count++
+		if len(lines) < limit {
+			line := []rune(diagnostic.String())
+			if len(line) > 150 {
+				line = append(line[:149], '…')
+			}
+			lines = append(lines, string(line))
+		}
+	}
+	if count > limit {
+		lines = append(lines, fmt.Sprintf("... and %d more", count-limit))
+	}
+	return strings.Join(lines, "\n")
+}
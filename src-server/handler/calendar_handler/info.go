@@ -0,0 +1,196 @@
+package calendar_handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func info(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "info"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        id,
+		Description: "Show the details of a calendar of this channel.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "calendar-id",
+				Description: "The ID of the calendar, see /calendar list. The channel calendar if empty.",
+				Required:    false,
+			},
+		},
+	})
+	cmdHandler[id] = infoHandler(as)
+}
+
+func infoHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		// #region - respond to original request
+		startTimer := time.Now()
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			slog.Warn("calendar_handler:info: can't send defer message", "error", err)
+			return nil
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+		// #endregion
+
+		// #region - get the calendar ID
+		calendarID := func() string {
+			options := i.ApplicationCommandData().Options[0].Options
+			optionMap := make(
+				map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options),
+			)
+			for _, opt := range options {
+				optionMap[opt.Name] = opt
+			}
+			if opt, ok := optionMap["calendar-id"]; ok {
+				return strings.TrimSpace(opt.StringValue())
+			}
+			return ""
+		}()
+		if calendarID == "" {
+			calendarID = i.ChannelID
+		}
+		// #endregion
+
+		// #region - get the calendar as an embed
+		startTimer = time.Now()
+		embed, err := func() (*discordgo.MessageEmbed, error) {
+			eventCounts, err := countEvents(as, i.ChannelID)
+			if err != nil {
+				return nil, err
+			}
+
+			// the channel calendar has the ID of its channel
+			if calendarID == i.ChannelID {
+				channelCalendarModel := new(model.Calendar)
+				if err := as.BunDB.
+					NewSelect().
+					Model(channelCalendarModel).
+					Where("channel_id = ?", i.ChannelID).
+					Scan(context.Background()); err != nil {
+					return nil, err
+				}
+				feedToken, err := channelCalendarModel.GetFeedToken(context.Background(), as.BunDB)
+				if err != nil {
+					return nil, err
+				}
+				return &discordgo.MessageEmbed{
+					Title:       channelCalendarModel.Name,
+					Description: "The calendar of the events created in this channel.",
+					Fields: []*discordgo.MessageEmbedField{
+						{Name: "ID", Value: fmt.Sprintf("`%s`", channelCalendarModel.ChannelID)},
+						{Name: "Events", Value: fmt.Sprintf("%d", eventCounts[calendarID]), Inline: true},
+						{Name: "Feed", Value: feedURL(as, feedToken)},
+					},
+				}, nil
+			}
+
+			externalCalendarModel := new(model.ExternalCalendar)
+			if err := as.BunDB.
+				NewSelect().
+				Model(externalCalendarModel).
+				Where("id = ?", calendarID).
+				Where("channel_id = ?", i.ChannelID).
+				Scan(context.Background()); err != nil {
+				return nil, err
+			}
+			embed := &discordgo.MessageEmbed{
+				Title:       externalCalendarModel.Name,
+				Description: externalCalendarModel.Description,
+				Fields: []*discordgo.MessageEmbedField{
+					{Name: "ID", Value: fmt.Sprintf("`%s`", externalCalendarModel.ID)},
+					{Name: "Events", Value: fmt.Sprintf("%d", eventCounts[calendarID]), Inline: true},
+				},
+			}
+			if externalCalendarModel.Url != "" {
+				embed.Fields = append(embed.Fields,
+					&discordgo.MessageEmbedField{
+						Name:   "Refresh interval",
+						Value:  externalCalendarModel.GetRefreshInterval(as.Config.GetCalendarUpdateInterval()).String(),
+						Inline: true,
+					},
+					&discordgo.MessageEmbedField{
+						Name:   "Last synced",
+						Value:  formatSyncDate(externalCalendarModel.LastSyncedAt),
+						Inline: true,
+					},
+					&discordgo.MessageEmbedField{
+						Name: "Next refresh",
+						Value: func() string {
+							if externalCalendarModel.NextRefreshAt == 0 {
+								return "soon"
+							}
+							return fmt.Sprintf("<t:%d:R>", externalCalendarModel.NextRefreshAt)
+						}(),
+						Inline: true,
+					},
+					&discordgo.MessageEmbedField{
+						Name:  "Source",
+						Value: externalCalendarModel.Url,
+					},
+				)
+			} else {
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+					Name:  "Source",
+					Value: "Uploaded file, not refreshed",
+				})
+			}
+			if externalCalendarModel.LastError != "" {
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+					Name:  fmt.Sprintf("Last error (%d refreshes failed in a row)", externalCalendarModel.FailureCount),
+					Value: fmt.Sprintf("```\n%s\n```", externalCalendarModel.LastError),
+				})
+			}
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "Feed",
+				Value: feedURL(as, externalCalendarModel.ID),
+			})
+			return embed, nil
+		}()
+		as.MetricChans.DatabaseRead <- float64(time.Since(startTimer).Microseconds())
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// edit the deferred message
+			msg := "Calendar not found."
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:info: can't respond about calendar not found", "error", err)
+			}
+			return nil
+		case err != nil:
+			// edit the deferred message
+			msg := fmt.Sprintf("Can't get calendar\n```\n%s\n```", err.Error())
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:info: can't respond about can't get calendar", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:info: can't get calendar: %w", err)
+		}
+		// #endregion
+
+		// edit the deferred message
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds: &[]*discordgo.MessageEmbed{embed},
+		}); err != nil {
+			slog.Warn("calendar_handler:info: can't respond about calendar info", "error", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+package calendar_handler
+
+import (
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Init injects one "calendar" slash command with multiple subcommands
+// into appCmdInfo and appCmdHandler in AppState.
+func Init(as *utils.AppState) {
+	// works similar to how we create a new slash command using
+	// appCmdInfo and appCmdHandler in AppState.
+	localCmdInfo := make(
+		[]*discordgo.ApplicationCommandOption, 0,
+	)
+	localCmdHandler := make(
+		map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error,
+	)
+
+	// injecting info and handler into 2 local maps
+	list(as, &localCmdInfo, localCmdHandler)
+	info(as, &localCmdInfo, localCmdHandler)
+	importCalendar(as, &localCmdInfo, localCmdHandler)
+	refresh(as, &localCmdInfo, localCmdHandler)
+	deleteCalendar(as, &localCmdInfo, localCmdHandler)
+
+	id := "calendar"
+	as.AddAppCmdInfo(id, &discordgo.ApplicationCommand{
+		Name:        id,
+		Description: "Calendar management commands.",
+		Options:     localCmdInfo,
+	})
+	as.AddAppCmdHandler(id, func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		data := i.ApplicationCommandData()
+		if handler, ok := localCmdHandler[data.Options[0].Name]; ok {
+			return handler(s, i)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+package calendar_handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord doesn't allow more fields in an embed
+const maxEmbedFields = 25
+
+func list(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "list"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        id,
+		Description: "List the calendars of this channel.",
+	})
+	cmdHandler[id] = listHandler(as)
+}
+
+func listHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		// #region - respond to original request
+		startTimer := time.Now()
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			slog.Warn("calendar_handler:list: can't send defer message", "error", err)
+			return nil
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+		// #endregion
+
+		// #region - get the calendars & their event counts
+		startTimer = time.Now()
+		channelCalendarModels := make([]model.Calendar, 0)
+		externalCalendarModels := make([]model.ExternalCalendar, 0)
+		eventCounts, err := func() (map[string]int, error) {
+			if err := as.BunDB.
+				NewSelect().
+				Model(&channelCalendarModels).
+				Where("channel_id = ?", i.ChannelID).
+				Scan(context.Background()); err != nil {
+				return nil, fmt.Errorf("can't get channel calendar: %w", err)
+			}
+			for i := range channelCalendarModels {
+				if _, err := channelCalendarModels[i].GetFeedToken(context.Background(), as.BunDB); err != nil {
+					return nil, err
+				}
+			}
+			if err := as.BunDB.
+				NewSelect().
+				Model(&externalCalendarModels).
+				Where("channel_id = ?", i.ChannelID).
+				Order("name").
+				Scan(context.Background()); err != nil {
+				return nil, fmt.Errorf("can't get external calendars: %w", err)
+			}
+			return countEvents(as, i.ChannelID)
+		}()
+		as.MetricChans.DatabaseRead <- float64(time.Since(startTimer).Microseconds())
+		if err != nil {
+			// edit the deferred message
+			msg := fmt.Sprintf("Can't get calendars\n```\n%s\n```", err.Error())
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:list: can't respond about can't get calendars", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:list: %w", err)
+		}
+		if len(channelCalendarModels) == 0 && len(externalCalendarModels) == 0 {
+			// edit the deferred message
+			msg := "This channel has no calendar yet, create an event or use `/calendar import`."
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:list: can't respond about no calendar", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - one field per calendar
+		fields := make([]*discordgo.MessageEmbedField, 0)
+		for _, channelCalendarModel := range channelCalendarModels {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name: channelCalendarModel.Name + " (channel calendar)",
+				Value: strings.Join([]string{
+					fmt.Sprintf("ID: `%s`", channelCalendarModel.ChannelID),
+					fmt.Sprintf("Events: %d", eventCounts[channelCalendarModel.ChannelID]),
+					"Feed: " + feedURL(as, channelCalendarModel.FeedToken),
+				}, "\n"),
+			})
+		}
+		for _, externalCalendarModel := range externalCalendarModels {
+			lines := []string{
+				fmt.Sprintf("ID: `%s`", externalCalendarModel.ID),
+				fmt.Sprintf("Events: %d", eventCounts[externalCalendarModel.ID]),
+			}
+			if externalCalendarModel.Url != "" {
+				lines = append(lines,
+					"Source: "+externalCalendarModel.Url,
+					"Last synced: "+formatSyncDate(externalCalendarModel.LastSyncedAt),
+				)
+			} else {
+				lines = append(lines, "Source: uploaded file")
+			}
+			if externalCalendarModel.LastError != "" {
+				lines = append(lines, fmt.Sprintf("Failing: %d refreshes in a row", externalCalendarModel.FailureCount))
+			}
+			lines = append(lines, "Feed: "+feedURL(as, externalCalendarModel.ID))
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  externalCalendarModel.Name,
+				Value: strings.Join(lines, "\n"),
+			})
+		}
+		embed := &discordgo.MessageEmbed{
+			Title:  "Calendars",
+			Fields: fields,
+		}
+		if len(fields) > maxEmbedFields {
+			embed.Fields = fields[:maxEmbedFields]
+			embed.Footer = &discordgo.MessageEmbedFooter{
+				Text: fmt.Sprintf("and %d more", len(fields)-maxEmbedFields),
+			}
+		}
+		// #endregion
+
+		// edit the deferred message
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds: &[]*discordgo.MessageEmbed{embed},
+		}); err != nil {
+			slog.Warn("calendar_handler:list: can't respond about calendars", "error", err)
+		}
+		return nil
+	}
+}
+
+// Count the events of each calendar of the channel, by calendar ID
+func countEvents(as *utils.AppState, channelID string) (map[string]int, error) {
+	rows := make([]struct {
+		CalendarID string `bun:"calendar_id"`
+		Count      int    `bun:"count"`
+	}, 0)
+	if err := as.BunDB.
+		NewSelect().
+		Model((*model.Event)(nil)).
+		Column("calendar_id").
+		ColumnExpr("COUNT(*) AS count").
+		Where("channel_id = ?", channelID).
+		Group("calendar_id").
+		Scan(context.Background(), &rows); err != nil {
+		return nil, fmt.Errorf("can't count events: %w", err)
+	}
+	eventCounts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		eventCounts[row.CalendarID] = row.Count
+	}
+	return eventCounts, nil
+}
+
+// Get the link to the iCalendar feed of a calendar, by the ID of an external
+// calendar or the feed token of a channel calendar, see route.Ical
+func feedURL(as *utils.AppState, feedID string) string {
+	return as.Config.GetPublicURL() + "/ical/" + feedID
+}
+
+// Format the date a calendar was last synced at, relative to now
+func formatSyncDate(unixTime int64) string {
+	if unixTime == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("<t:%d:R>", unixTime)
+}
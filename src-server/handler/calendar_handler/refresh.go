@@ -0,0 +1,152 @@
+package calendar_handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"towd/src-server/model"
+	"towd/src-server/scheduler"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func refresh(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "refresh"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        id,
+		Description: "Refresh an external calendar now.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "calendar-id",
+				Description: "The ID of the calendar to refresh.",
+				Required:    true,
+			},
+		},
+	})
+	cmdHandler[id] = refreshHandler(as)
+}
+
+func refreshHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		// #region - respond to original request
+		startTimer := time.Now()
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			slog.Warn("calendar_handler:refresh: can't send defer message", "error", err)
+			return nil
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+		// #endregion
+
+		// #region - get the calendar ID
+		calendarID := func() string {
+			options := i.ApplicationCommandData().Options[0].Options
+			optionMap := make(
+				map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options),
+			)
+			for _, opt := range options {
+				optionMap[opt.Name] = opt
+			}
+			var calendarID string
+			if opt, ok := optionMap["calendar-id"]; ok {
+				calendarID = strings.TrimSpace(opt.StringValue())
+			}
+			return calendarID
+		}()
+		if calendarID == "" {
+			// edit the deferred message
+			msg := "Calendar ID is empty."
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:refresh: can't respond about calendar ID is empty", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - get the calendar model
+		startTimer = time.Now()
+		externalCalendarModel := new(model.ExternalCalendar)
+		err := as.BunDB.
+			NewSelect().
+			Model(externalCalendarModel).
+			Where("id = ?", calendarID).
+			Where("channel_id = ?", i.Interaction.ChannelID).
+			Scan(context.Background())
+		as.MetricChans.DatabaseRead <- float64(time.Since(startTimer).Microseconds())
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// edit the deferred message
+			msg := "Calendar not found."
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:refresh: can't respond about calendar not found", "error", err)
+			}
+			return nil
+		case err != nil:
+			// edit the deferred message
+			msg := fmt.Sprintf("Can't get calendar\n```\n%s\n```", err.Error())
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:refresh: can't respond about can't get calendar", "error", err)
+			}
+			return fmt.Errorf("calendar_handler:refresh: can't get calendar: %w", err)
+		}
+		// #endregion
+
+		// #region - refresh the calendar
+		if externalCalendarModel.Url == "" {
+			// edit the deferred message
+			msg := fmt.Sprintf("Calendar `%s` was imported from a file, it can't be refreshed.", externalCalendarModel.Name)
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:refresh: can't respond about calendar from a file", "error", err)
+			}
+			return nil
+		}
+		if err := scheduler.RefreshCalendar(as, externalCalendarModel); err != nil {
+			// edit the deferred message
+			msg := fmt.Sprintf(
+				"Can't refresh calendar `%s`, next attempt <t:%d:R>.\n```\n%s\n```",
+				externalCalendarModel.Name,
+				externalCalendarModel.NextRefreshAt,
+				err.Error(),
+			)
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("calendar_handler:refresh: can't respond about can't refresh calendar", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// edit the deferred message
+		msg := fmt.Sprintf(
+			"Calendar `%s` refreshed, next refresh <t:%d:R>.",
+			externalCalendarModel.Name,
+			externalCalendarModel.NextRefreshAt,
+		)
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &msg,
+		}); err != nil {
+			slog.Warn("calendar_handler:refresh: can't respond about calendar refreshed", "error", err)
+		}
+		return nil
+	}
+}
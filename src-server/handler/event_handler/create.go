@@ -7,12 +7,14 @@ import (
 	"log/slog"
 	"strings"
 	"time"
+	"towd/src-server/ical"
 	"towd/src-server/model"
 	"towd/src-server/utils"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"github.com/xyedo/rrule"
 )
 
 func create(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
@@ -70,6 +72,12 @@ func create(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption,
 				Description: "List the invitees of the event, each separated by a comma.",
 				Required:    false,
 			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "repeat",
+				Description: "Repeat the event, as an iCalendar RRULE, e.g. FREQ=WEEKLY;COUNT=4.",
+				Required:    false,
+			},
 		},
 	})
 	cmdHandler[id] = createHandler(as)
@@ -143,23 +151,23 @@ func createHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 				for _, attendee := range strings.Split(rawString, ",") {
 					attendee := strings.TrimSpace(attendee)
 					if attendee != "" {
-						attendeeModels = append(attendeeModels, model.Attendee{
-							EventID: eventModel.ID,
-							Data:    attendee,
-						})
+						attendeeModels = append(attendeeModels, model.NewAttendee(eventModel.ID, attendee))
 					}
 				}
 			}
-			if value, ok := optionMap["whole-day"]; ok {
-				eventModel.IsWholeDay = value.BoolValue()
-				startDate := time.Unix(eventModel.StartDateUnixUTC, 0)
-				endDate := time.Unix(eventModel.EndDateUnixUTC, 0)
-				if eventModel.IsWholeDay {
-					startDate = startDate.Truncate(24 * time.Hour)
-					endDate = endDate.Truncate(24 * time.Hour)
+			if value, ok := optionMap["repeat"]; ok {
+				rruleString := strings.TrimPrefix(strings.ToUpper(utils.CleanupString(value.StringValue())), "RRULE:")
+				if _, err := rrule.StrToRRule(rruleString); err != nil {
+					return nil, fmt.Errorf("can't parse repeat rule: %w", err)
+				}
+				eventModel.RRule = rruleString
+				// follow the daylight saving time changes of the server's timezone
+				if loc := as.Config.GetLocation(); loc != time.Local {
+					eventModel.Tzid = loc.String()
 				}
-				eventModel.StartDateUnixUTC = startDate.UTC().Unix()
-				eventModel.EndDateUnixUTC = endDate.UTC().Unix()
+			}
+			if value, ok := optionMap["whole-day"]; ok {
+				eventModel.SetDates(eventModel.StartDateUnixUTC, eventModel.EndDateUnixUTC, value.BoolValue(), as.Config.GetLocation())
 			}
 
 			return eventModel, nil
@@ -334,6 +342,15 @@ func createHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 		}
 		// #endregion
 
+		// #region - send the invitations
+		for idx := range attendeeModels {
+			eventModel.Attendees = append(eventModel.Attendees, &attendeeModels[idx])
+		}
+		if err := sendItip(as, s, i, eventModel, ical.MethodRequest); err != nil {
+			slog.Warn("event_handler:create: can't send the invitations", "error", err)
+		}
+		// #endregion
+
 		return nil
 	}
 }
@@ -2,13 +2,16 @@ package event_handler
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log/slog"
 	"time"
+	"towd/src-server/ical"
 	"towd/src-server/model"
 	"towd/src-server/utils"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/uptrace/bun"
 )
 
 func delete(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
@@ -242,11 +245,10 @@ func deleteHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 
 		// #region - delete event
 		startTimer = time.Now()
-		if _, err := as.BunDB.NewDelete().
-			Model((*model.Event)(nil)).
-			Where("id = ?", eventID).
-			Where("channel_id = ?", i.Interaction.ChannelID).
-			Exec(context.WithValue(context.Background(), model.EventIDCtxKey, eventID)); err != nil {
+		// the overrides, alarms and attendees go along with the event
+		if err := as.BunDB.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+			return model.DeleteEvents(ctx, tx, []string{eventID})
+		}); err != nil {
 			// edit deferred response of button click
 			msg := fmt.Sprintf("Can't delete event\n```\n%s\n```", err.Error())
 			if _, err := s.InteractionResponseEdit(buttonInteraction, &discordgo.WebhookEdit{
@@ -268,6 +270,12 @@ func deleteHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 		}
 		// #endregion
 
+		// #region - tell the attendees
+		if err := sendItip(as, s, i, eventModel, ical.MethodCancel); err != nil {
+			slog.Warn("event_handler:delete: can't send the cancellation", "error", err)
+		}
+		// #endregion
+
 		return nil
 	}
 }
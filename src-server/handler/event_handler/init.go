@@ -28,6 +28,7 @@ func Init(as *utils.AppState) {
 	delete(as, &localCmdInfo, localCmdHandler)
 	list(as, &localCmdInfo, localCmdHandler)
 	modify(as, &localCmdInfo, localCmdHandler)
+	rsvp(as, &localCmdInfo, localCmdHandler)
 
 	id := "event"
 	as.AddAppCmdInfo(id, &discordgo.ApplicationCommand{
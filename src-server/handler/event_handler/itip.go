@@ -0,0 +1,122 @@
+package event_handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Post an iTIP message (RFC5546) about the event as an .ics attachment in the
+// channel, and DM it to the attendees mentioned as Discord users. Nothing is
+// sent if none of the attendees can be reached.
+func sendItip(as *utils.AppState, s *discordgo.Session, i *discordgo.InteractionCreate, eventModel *model.Event, method ical.Method) error {
+	hasReachableAttendee := false
+	for _, attendeeModel := range eventModel.Attendees {
+		if attendeeModel.CalAddress() != "" {
+			hasReachableAttendee = true
+			break
+		}
+	}
+	if !hasReachableAttendee {
+		return nil
+	}
+
+	// the channel organizes the event on behalf of the user who created it
+	organizerCalAddress := fmt.Sprintf("https://discord.com/channels/%s/%s", i.GuildID, i.ChannelID)
+	icalCalendar, err := eventModel.ToItip(method, organizerCalAddress)
+	if err != nil {
+		return fmt.Errorf("sendItip: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := icalCalendar.ToIcal(&buf); err != nil {
+		return fmt.Errorf("sendItip: %w", err)
+	}
+
+	var content, fileName string
+	switch method {
+	case ical.MethodCancel:
+		content = fmt.Sprintf("**%s** has been cancelled.", eventModel.Summary)
+		fileName = "cancellation.ics"
+	default:
+		content = fmt.Sprintf("You're invited to **%s**, <t:%d:f>.", eventModel.Summary, eventModel.StartDateUnixUTC)
+		fileName = "invitation.ics"
+	}
+	newMessage := func() *discordgo.MessageSend {
+		return &discordgo.MessageSend{
+			Content: content,
+			Files: []*discordgo.File{
+				{
+					Name:        fileName,
+					ContentType: fmt.Sprintf("text/calendar; method=%s; charset=utf-8", method),
+					Reader:      bytes.NewReader(buf.Bytes()),
+				},
+			},
+		}
+	}
+
+	startTimer := time.Now()
+	if _, err := s.ChannelMessageSendComplex(i.ChannelID, newMessage()); err != nil {
+		return fmt.Errorf("sendItip: can't post the message: %w", err)
+	}
+	as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+
+	for _, attendeeModel := range eventModel.Attendees {
+		userID := attendeeModel.DiscordUserID()
+		if userID == "" {
+			continue
+		}
+		startTimer := time.Now()
+		dmChannel, err := s.UserChannelCreate(userID)
+		if err != nil {
+			slog.Warn("event_handler:sendItip: can't open DM channel", "user", userID, "error", err)
+			continue
+		}
+		if _, err := s.ChannelMessageSendComplex(dmChannel.ID, newMessage()); err != nil {
+			slog.Warn("event_handler:sendItip: can't send DM", "user", userID, "error", err)
+			continue
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+	}
+
+	return nil
+}
+
+// Fetch an .ics attachment and read the iTIP replies out of it
+func fetchItipReplies(attachment *discordgo.MessageAttachment) ([]ical.ItipReply, error) {
+	const maxSize = 1 << 20
+	switch {
+	case attachment == nil:
+		return nil, fmt.Errorf("no file attached")
+	case attachment.Size > maxSize:
+		return nil, fmt.Errorf("the file is larger than 1 MiB")
+	case !strings.HasSuffix(strings.ToLower(attachment.Filename), ".ics") &&
+		!strings.HasPrefix(attachment.ContentType, "text/calendar"):
+		return nil, fmt.Errorf("expected an .ics file")
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(attachment.URL)
+	if err != nil {
+		return nil, fmt.Errorf("can't download the file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't download the file: %s", resp.Status)
+	}
+
+	replies, customErr := ical.ParseItipReply(context.Background(), io.LimitReader(resp.Body, maxSize))
+	if customErr != nil {
+		return nil, customErr
+	}
+	return replies, nil
+}
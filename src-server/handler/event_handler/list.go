@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 	"towd/src-server/model"
 	"towd/src-server/utils"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/uptrace/bun"
 )
 
 // func List(as *utils.AppState) {
@@ -29,6 +32,11 @@ func list(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cm
 				Name:        "end",
 				Description: "The end of the start date range",
 			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Description: "Only the events in this category",
+			},
 		},
 	})
 	cmdHandler[id] = listEventHandler(as)
@@ -48,6 +56,7 @@ func listEventHandler(as *utils.AppState) func(s *discordgo.Session, i *discordg
 
 		// #region - parse date and get the start/end start date range
 		searchDate := ""
+		category := ""
 		startStartDateRange, endStartDateRange, err := func() (time.Time, time.Time, error) {
 			options := i.ApplicationCommandData().Options[0].Options
 			optionMap := make(
@@ -57,6 +66,10 @@ func listEventHandler(as *utils.AppState) func(s *discordgo.Session, i *discordg
 				optionMap[opt.Name] = opt
 			}
 
+			if value, ok := optionMap["category"]; ok {
+				category = utils.CleanupString(value.StringValue())
+			}
+
 			var startStartDateRange time.Time
 			var endStartDateRange time.Time
 
@@ -80,6 +93,9 @@ func listEventHandler(as *utils.AppState) func(s *discordgo.Session, i *discordg
 			}
 
 			searchDate = fmt.Sprintf("from <t:%d:f> to <t:%d:f>", startStartDateRange.Unix(), endStartDateRange.Unix())
+			if category != "" {
+				searchDate += fmt.Sprintf(" in category %s", category)
+			}
 			return startStartDateRange, endStartDateRange, nil
 		}()
 		if err != nil {
@@ -95,16 +111,11 @@ func listEventHandler(as *utils.AppState) func(s *discordgo.Session, i *discordg
 		// #endregion
 
 		// #region - get all events
-		var eventModels []model.Event
 		startTimer = time.Now()
-		if err := as.BunDB.
-			NewSelect().
-			Model(&eventModels).
-			Relation("Attendees").
-			Where("start_date >= ?", startStartDateRange.Unix()).
-			Where("end_date <= ?", endStartDateRange.Unix()).
-			Where("channel_id = ?", i.Interaction.ChannelID).
-			Scan(context.Background()); err != nil {
+		occurrences, err := model.SelectOccurrences(context.Background(), as.BunDB, startStartDateRange, endStartDateRange, func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("channel_id = ?", i.Interaction.ChannelID)
+		})
+		if err != nil {
 			// edit the deferred message
 			msg := fmt.Sprintf("Can't get events in range\n```\n%s```", err.Error())
 			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
@@ -119,7 +130,16 @@ func listEventHandler(as *utils.AppState) func(s *discordgo.Session, i *discordg
 
 		// #region - compose & send the message
 		embeds := []*discordgo.MessageEmbed{}
-		for _, event := range eventModels {
+		for _, event := range occurrences {
+			// only the events within the range, not the ones overlapping it
+			if event.StartDateUnixUTC < startStartDateRange.Unix() || event.EndDateUnixUTC > endStartDateRange.Unix() {
+				continue
+			}
+			if category != "" && !slices.ContainsFunc(event.Categories, func(c string) bool {
+				return strings.EqualFold(c, category)
+			}) {
+				continue
+			}
 			embeds = append(embeds, event.ToDiscordEmbed())
 		}
 		// edit the deferred message
@@ -96,7 +96,6 @@ func modifyHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 		// #endregion
 
 		// #region - get new event data
-		attendeeModels := make([]model.Attendee, 0)
 		oldEventModel := new(model.Event)
 		newEventModel := new(model.Event)
 		if err := func() error {
@@ -121,6 +120,12 @@ func modifyHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 				return fmt.Errorf("can't get old event: %w", err)
 			}
 			*newEventModel = *oldEventModel
+			// the dates given are instants, the whole-day dates are turned
+			// into instants as well
+			loc := as.Config.GetLocation()
+			startDate := newEventModel.Instant(newEventModel.StartDateUnixUTC, loc)
+			endDate := newEventModel.Instant(newEventModel.EndDateUnixUTC, loc)
+			isWholeDay, isDateChanged := newEventModel.IsWholeDay, false
 
 			if value, ok := optionMap["title"]; ok {
 				newEventModel.Summary = utils.CleanupString(value.StringValue())
@@ -133,14 +138,14 @@ func modifyHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 				if err != nil {
 					return fmt.Errorf("can't parse start date: %w", err)
 				}
-				newEventModel.StartDateUnixUTC = result.Time.UTC().Unix()
+				startDate, isDateChanged = result.Time.UTC().Unix(), true
 			}
 			if value, ok := optionMap["end"]; ok {
 				result, err := as.When.Parse(value.StringValue(), time.Now())
 				if err != nil {
 					return fmt.Errorf("can't parse end date: %w", err)
 				}
-				newEventModel.EndDateUnixUTC = result.Time.UTC().Unix()
+				endDate, isDateChanged = result.Time.UTC().Unix(), true
 			}
 			if value, ok := optionMap["location"]; ok {
 				newEventModel.Location = utils.CleanupString(value.StringValue())
@@ -155,26 +160,22 @@ func modifyHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 			}
 			if value, ok := optionMap["invitees"]; ok {
 				rawString := value.StringValue()
+				attendeeModels := make([]*model.Attendee, 0)
 				for _, attendee := range strings.Split(rawString, ",") {
 					attendee := strings.TrimSpace(attendee)
 					if attendee != "" {
-						attendeeModels = append(attendeeModels, model.Attendee{
-							EventID: newEventModel.ID,
-							Data:    attendee,
-						})
+						attendeeModel := model.NewAttendee(newEventModel.ID, attendee)
+						attendeeModels = append(attendeeModels, &attendeeModel)
 					}
 				}
+				model.CarryOverAttendees(attendeeModels, oldEventModel.Attendees)
+				newEventModel.Attendees = attendeeModels
 			}
 			if value, ok := optionMap["whole-day"]; ok {
-				newEventModel.IsWholeDay = value.BoolValue()
-				startDate := time.Unix(newEventModel.StartDateUnixUTC, 0)
-				endDate := time.Unix(newEventModel.EndDateUnixUTC, 0)
-				if newEventModel.IsWholeDay {
-					startDate = startDate.Truncate(24 * time.Hour)
-					endDate = endDate.Truncate(24 * time.Hour)
-				}
-				newEventModel.StartDateUnixUTC = startDate.UTC().Unix()
-				newEventModel.EndDateUnixUTC = endDate.UTC().Unix()
+				isWholeDay, isDateChanged = value.BoolValue(), true
+			}
+			if isDateChanged {
+				newEventModel.SetDates(startDate, endDate, isWholeDay, loc)
 			}
 			return nil
 		}(); err != nil {
@@ -359,9 +360,9 @@ func modifyHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.I
 				Exec(ctx); err != nil {
 				return err
 			}
-			if len(attendeeModels) > 0 {
+			if len(newEventModel.Attendees) > 0 {
 				if _, err := tx.NewInsert().
-					Model(&attendeeModels).
+					Model(&newEventModel.Attendees).
 					Exec(ctx); err != nil {
 					return err
 				}
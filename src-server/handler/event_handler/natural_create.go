@@ -69,10 +69,8 @@ func handleActionTypeCreate(as *utils.AppState, s *discordgo.Session, i *discord
 	newEventModelID := uuid.NewString()
 	attendeeModels := make([]*model.Attendee, len(naturalOutput.Body.Attendees))
 	for i, attendee := range naturalOutput.Body.Attendees {
-		attendeeModels[i] = &model.Attendee{
-			EventID: newEventModelID,
-			Data:    attendee,
-		}
+		attendeeModel := model.NewAttendee(newEventModelID, attendee)
+		attendeeModels[i] = &attendeeModel
 	}
 	newEventModel := model.Event{
 		ID:               newEventModelID,
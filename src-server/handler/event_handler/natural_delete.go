@@ -2,6 +2,7 @@ package event_handler
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log/slog"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"towd/src-server/utils"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/uptrace/bun"
 )
 
 func handleActionTypeDelete(as *utils.AppState, s *discordgo.Session, i *discordgo.InteractionCreate, naturalInputEventModel *model.Event) error {
@@ -145,11 +147,10 @@ func handleActionTypeDelete(as *utils.AppState, s *discordgo.Session, i *discord
 	// #endregion
 
 	// #region - delete event
-	if _, err := as.BunDB.NewDelete().
-		Model((*model.Event)(nil)).
-		Where("id = ?", naturalInputEventModel.ID).
-		Where("channel_id = ?", i.Interaction.ChannelID).
-		Exec(context.WithValue(context.Background(), model.EventIDCtxKey, naturalInputEventModel.ID)); err != nil {
+	// the overrides, alarms and attendees go along with the event
+	if err := as.BunDB.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		return model.DeleteEvents(ctx, tx, []string{naturalInputEventModel.ID})
+	}); err != nil {
 		// edit deferred response of button click
 		msg := fmt.Sprintf("Can't delete event\n```\n%s\n```", err.Error())
 		if _, err := s.InteractionResponseEdit(buttonInteraction, &discordgo.WebhookEdit{
@@ -9,6 +9,7 @@ import (
 	"towd/src-server/utils"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/uptrace/bun"
 )
 
 func handleActionTypeRead(as *utils.AppState, s *discordgo.Session, i *discordgo.InteractionCreate, naturalOutput utils.NaturalOutput) error {
@@ -35,15 +36,11 @@ func handleActionTypeRead(as *utils.AppState, s *discordgo.Session, i *discordgo
 		}
 		return nil
 	}
-	eventModels := make([]model.Event, 0)
-	if err := as.BunDB.
-		NewSelect().
-		Model(&eventModels).
-		Relation("Attendees").
-		Where("channel_id = ?", i.ChannelID).
-		Where("start_date >= ?", startDate.UTC().Unix()).
-		Where("start_date <= ?", endDate.UTC().Unix()).
-		Scan(context.Background()); err != nil {
+	// the end date is included in the range
+	occurrences, err := model.SelectOccurrences(context.Background(), as.BunDB, startDate, endDate.Add(time.Second), func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("channel_id = ?", i.ChannelID)
+	})
+	if err != nil {
 		// edit the deferred message
 		msg := fmt.Sprintf("Can't read event\n```\n%s\n```", err.Error())
 		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
@@ -57,7 +54,10 @@ func handleActionTypeRead(as *utils.AppState, s *discordgo.Session, i *discordgo
 
 	// #region - compose response
 	var embeds []*discordgo.MessageEmbed
-	for _, eventModel := range eventModels {
+	for _, eventModel := range occurrences {
+		if eventModel.StartDateUnixUTC < startDate.Unix() {
+			continue
+		}
 		embeds = append(embeds, eventModel.ToDiscordEmbed())
 	}
 	if len(embeds) == 0 {
@@ -102,15 +102,14 @@ func handleActionTypeUpdate(as *utils.AppState, s *discordgo.Session, i *discord
 		Attendees: func() []*model.Attendee {
 			attendeeModels := make([]*model.Attendee, len(naturalOutput.Body.Attendees))
 			for i, attendee := range naturalOutput.Body.Attendees {
-				attendeeModels[i] = &model.Attendee{
-					EventID: oldEventModel.ID,
-					Data:    attendee,
-				}
+				attendeeModel := model.NewAttendee(oldEventModel.ID, attendee)
+				attendeeModels[i] = &attendeeModel
 			}
 			return attendeeModels
 		}(),
 		NotificationSent: false,
 	}
+	model.CarryOverAttendees(newEventModel.Attendees, oldEventModel.Attendees)
 	// #endregion
 
 	// #region - ask for confirmation
@@ -0,0 +1,146 @@
+package event_handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func rsvp(as *utils.AppState, cmdInfo *[]*discordgo.ApplicationCommandOption, cmdHandler map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) error) {
+	id := "rsvp"
+	*cmdInfo = append(*cmdInfo, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        id,
+		Description: "Record the answers of an invitation reply (.ics file).",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "The .ics reply sent back by the invitee's calendar app.",
+				Required:    true,
+			},
+		},
+	})
+	cmdHandler[id] = rsvpHandler(as)
+}
+
+func rsvpHandler(as *utils.AppState) func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+		// #region - respond to original request
+		startTimer := time.Now()
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		}); err != nil {
+			slog.Warn("event_handler:rsvp: can't send defer message", "error", err)
+			return nil
+		}
+		as.MetricChans.DiscordSendMessage <- float64(time.Since(startTimer).Microseconds())
+		// #endregion
+
+		// #region - read the replies
+		replies, err := func() ([]ical.ItipReply, error) {
+			data := i.ApplicationCommandData()
+			for _, opt := range data.Options[0].Options {
+				if opt.Name != "file" || data.Resolved == nil {
+					continue
+				}
+				attachmentID, _ := opt.Value.(string)
+				return fetchItipReplies(data.Resolved.Attachments[attachmentID])
+			}
+			return nil, fmt.Errorf("no file attached")
+		}()
+		if err != nil {
+			// edit the deferred message
+			msg := fmt.Sprintf("Can't read the reply\n```\n%s\n```", err.Error())
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &msg,
+			}); err != nil {
+				slog.Warn("event_handler:rsvp: can't respond about can't read the reply", "error", err)
+			}
+			return nil
+		}
+		// #endregion
+
+		// #region - update the attendees
+		updates := make([]string, 0)
+		skipped := 0
+		for _, reply := range replies {
+			// the status of a single occurrence doesn't change the one of
+			// the event as a whole
+			if reply.RecurrenceID != 0 {
+				skipped++
+				continue
+			}
+
+			eventModel := new(model.Event)
+			startTimer := time.Now()
+			if err := as.BunDB.
+				NewSelect().
+				Model(eventModel).
+				Relation("Attendees").
+				Where("id = ?", reply.EventID).
+				Where("channel_id = ?", i.ChannelID).
+				Scan(context.Background()); err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					slog.Warn("event_handler:rsvp: can't get event", "eventID", reply.EventID, "error", err)
+				}
+				skipped++
+				continue
+			}
+			as.MetricChans.DatabaseRead <- float64(time.Since(startTimer).Microseconds())
+			// a reply to an outdated invitation is ignored (RFC5546 section 2.1.5)
+			if reply.Sequence < eventModel.Sequence {
+				skipped++
+				continue
+			}
+
+			for _, attendee := range reply.Attendees {
+				for _, attendeeModel := range eventModel.Attendees {
+					if !strings.EqualFold(attendeeModel.CalAddress(), attendee.GetCalAddress()) {
+						continue
+					}
+					startTimer := time.Now()
+					if _, err := as.BunDB.
+						NewUpdate().
+						Model((*model.Attendee)(nil)).
+						Set("part_stat = ?", string(attendee.GetPartStat())).
+						Where("event_id = ?", eventModel.ID).
+						Where("data = ?", attendeeModel.Data).
+						Exec(context.Background()); err != nil {
+						slog.Warn("event_handler:rsvp: can't update attendee", "eventID", eventModel.ID, "error", err)
+						continue
+					}
+					as.MetricChans.DatabaseWrite <- float64(time.Since(startTimer).Microseconds())
+					updates = append(updates, fmt.Sprintf("- **%s**: %s is now `%s`", eventModel.Summary, attendeeModel.Data, attendee.GetPartStat()))
+				}
+			}
+		}
+		// #endregion
+
+		// #region - edit the deferred message
+		msg := "No attendee to update."
+		if len(updates) > 0 {
+			msg = "Attendees updated.\n" + strings.Join(updates, "\n")
+		}
+		if skipped > 0 {
+			msg += fmt.Sprintf("\nSkipped %d of %d replies: unknown event in this channel, outdated invitation or single occurrence.", skipped, len(replies))
+		}
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &msg,
+		}); err != nil {
+			slog.Warn("event_handler:rsvp: can't edit deferred message", "error", err)
+		}
+		// #endregion
+
+		return nil
+	}
+}
@@ -3,12 +3,20 @@
 // # References:
 // - RFC5545: https://datatracker.ietf.org/doc/html/rfc5545
 // - RFC6321: https://datatracker.ietf.org/doc/html/rfc6321
+// - RFC7265: https://datatracker.ietf.org/doc/html/rfc7265
 //
 // # Notes:
 // - Not all properties are supported when parsing, instead stored in the custom
 //   property array for serialization back into iCalendar format if needed.
-// - VTIMEZONE and VALARM sections, including their sub-sections, are ignored.
-//   parsing local timezones are still supported. All datetimes are stored in UTC.
+// - VTIMEZONE sections are parsed into Timezone{} and used to resolve TZID
+//   parameters that the IANA database doesn't know about (e.g. Outlook's
+//   "W. Europe Standard Time"), the events keep theirs to expand their
+//   recurrence in it. All datetimes are stored in UTC.
+// - When serializing, events having a TZID are written in local time, along
+//   with their VTIMEZONE, generated from Go's tzdata if the calendar doesn't
+//   already have one.
+// - xCal (RFC6321) and jCal (RFC7265) are converted from/to the text format,
+//   so they hold exactly what the text parser and serializer do.
 //
 // - There are 3 types of events: MasterEvent, ChildEvent and UndecidedEvent.
 //   - MasterEvent: a "normal" event.
@@ -16,6 +24,7 @@
 //   - UndecidedEvent: a placeholder for a future Master/ChildEvent.
 // - Calendar{} only holds MasterEvent and ChildEvent, read-only and guaranteed
 //   to be valid.
+// - VTODO sections are parsed into Todo{}, kept apart from the events.
 //
 // # Example usage:
 //
@@ -27,9 +36,19 @@
 // Parse from a URL
 //	calendar, _ := ical.FromIcalUrl("https://example.com/calendar.ics")
 //
-// Marshal to a string -> file
-//	output, _ := calendar.ToIcal()
-//	_ := os.WriteFile("path/to/output/calendar.ics", []byte(output), 0644)
+// Marshal to a file
+//	file, _ := os.Create("path/to/output/calendar.ics")
+//	_ := calendar.ToIcal(file)
+//
+// Convert from/to jCal and xCal
+//	calendar, _ := ical.FromJCal(reader)
+//	jcal, _ := calendar.ToJCal()
+//	calendar, _ := ical.FromXCal(reader)
+//	xcal, _ := calendar.ToXCal()
+//
+// Compare two versions of a calendar and apply the changes
+//	diff := ical.Diff(oldCalendar, newCalendar)
+//	mergedCalendar, _ := ical.Merge(oldCalendar, diff)
 //
 // Create a new Calendar struct
 //	calendar := ical.NewCalendar()
@@ -51,16 +70,24 @@
 package ical
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 	"towd/src-server/ical/event"
 	"towd/src-server/ical/structured"
+	"towd/src-server/ical/utils"
 
 	"github.com/google/uuid"
 )
@@ -69,9 +96,13 @@ import (
 type Calendar struct {
 	id           string
 	prodID       string
+	method       Method
 	name         string
 	description  string
 	masterEvents map[string]*event.MasterEvent
+	timezones    map[string]*structured.Timezone
+	todos        map[string]*structured.Todo
+	freeBusys    []*structured.FreeBusy
 
 	// this field only serve ONE PURPOSE: temporary storage for child events
 	// that are not yet added to a master event. This is to prevent adding
@@ -84,143 +115,263 @@ func NewCalendar() Calendar {
 	return Calendar{
 		id:           uuid.NewString(),
 		masterEvents: make(map[string]*event.MasterEvent),
+		timezones:    make(map[string]*structured.Timezone),
+		todos:        make(map[string]*structured.Todo),
 	}
 }
 
-// Unmarshal an iCalendar file into a Calendar{} struct.
-func FromIcalFile(path string) (*Calendar, *CustomError) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, NewCustomError("can't opening file", map[string]any{
-			"path": path,
-			"err":  err,
-		})
+// The default maximum size of the input of Parse
+const DefaultMaxSize = 32 << 20 // 32 MiB
+
+// Options of Parse
+type ParseOptions struct {
+	// The maximum number of bytes read, DefaultMaxSize if 0
+	MaxSize int64
+	// Abort on the first error, i.e. as soon as a component would be skipped.
+	// Warnings, e.g. an invalid property being ignored, never abort.
+	Strict bool
+}
+
+// Unmarshal an iCalendar stream into a Calendar{} struct. The parsing happens
+// in the calling goroutine, stops as soon as the context is done and fails once
+// more than opts.MaxSize bytes are read. Errors and diagnostics hold the line
+// and column they were found at.
+func Parse(ctx context.Context, r io.Reader, opts ParseOptions) (*Calendar, []Diagnostic, *CustomError) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
 	}
-	defer file.Close()
+	lines := newLineReader(&boundedReader{ctx: ctx, r: r, remaining: maxSize}, int(min(maxSize, math.MaxInt32)))
+	return parseLines(lines, opts.Strict)
+}
 
-	lineCh := make(chan string)
+// Fetch an iCalendar URL and parse it, see Parse.
+func FetchIcal(ctx context.Context, url_ string, opts ParseOptions) (*Calendar, []Diagnostic, *CustomError) {
+	result, customErr := FetchIcalIfChanged(ctx, url_, FetchValidators{}, opts)
+	return result.Calendar, result.Diagnostics, customErr
+}
 
-	go func() {
-		defer close(lineCh)
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			if lineCh != nil {
-				lineCh <- scanner.Text()
-			}
-		}
-	}()
+// What a previous fetch of a calendar got, to only download and parse it again
+// if it changed. The zero value fetches unconditionally.
+type FetchValidators struct {
+	ETag         string // the ETag header, sent as If-None-Match
+	LastModified string // the Last-Modified header, sent as If-Modified-Since
+	Hash         string // the SHA-256 of the body, hex encoded
+}
 
-	return iCalParser(lineCh)
+// The outcome of FetchIcalIfChanged
+type FetchResult struct {
+	Calendar    *Calendar // nil if unchanged
+	Diagnostics []Diagnostic
+	// The server answered 304 Not Modified, or the body has the same hash
+	Unchanged bool
+	// To send with the next fetch, they may change even if the content didn't
+	Validators FetchValidators
 }
 
-// Unmarshal an iCalendar URL into a Calendar{} struct.
-func FromIcalUrl(url_ string) (*Calendar, *CustomError) {
+// Fetch an iCalendar URL and parse it, unless it didn't change since the fetch
+// the validators come from. The body is downloaded once and hashed before
+// being parsed, so an unchanged calendar isn't parsed at all.
+func FetchIcalIfChanged(ctx context.Context, url_ string, validators FetchValidators, opts ParseOptions) (FetchResult, *CustomError) {
+	result := FetchResult{Validators: validators}
 	if _, err := url.ParseRequestURI(url_); err != nil {
-		return nil, NewCustomError("can't parse URL", map[string]any{
+		return result, NewCustomError("can't parse URL", map[string]any{
 			"url": url_,
 			"err": err,
 		})
 	}
 
-	req, err := http.NewRequest("GET", url_, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url_, nil)
 	if err != nil {
-		return nil, NewCustomError("can't create HTTP request", map[string]any{
+		return result, NewCustomError("can't create HTTP request", map[string]any{
 			"url": url_,
 			"err": err,
 		})
 	}
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, NewCustomError("can't make HTTP request", map[string]any{
+		return result, NewCustomError("can't make HTTP request", map[string]any{
 			"url": url_,
 			"err": err,
 		})
 	}
 	defer resp.Body.Close()
 
-	lineCh := make(chan string)
-
-	go func() {
-		defer close(lineCh)
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			lineCh <- scanner.Text()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		// a 304 may come with newer validators
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			result.Validators.ETag = etag
 		}
-	}()
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			result.Validators.LastModified = lastModified
+		}
+		result.Unchanged = true
+		return result, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return result, NewCustomError("unexpected HTTP status", map[string]any{
+			"url":    url_,
+			"status": resp.Status,
+		})
+	}
+	result.Validators.ETag = resp.Header.Get("ETag")
+	result.Validators.LastModified = resp.Header.Get("Last-Modified")
 
-	return iCalParser(lineCh)
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	body, err := io.ReadAll(&boundedReader{ctx: ctx, r: resp.Body, remaining: maxSize})
+	if err != nil {
+		return result, NewCustomError("can't read HTTP response", map[string]any{
+			"url": url_,
+			"err": err,
+		})
+	}
+	sum := sha256.Sum256(body)
+	result.Validators.Hash = hex.EncodeToString(sum[:])
+	if validators.Hash != "" && result.Validators.Hash == validators.Hash {
+		result.Unchanged = true
+		return result, nil
+	}
+
+	var customErr *CustomError
+	result.Calendar, result.Diagnostics, customErr = Parse(ctx, bytes.NewReader(body), opts)
+	return result, customErr
 }
 
-// The shared logic for parsing iCalendar files from a channel of strings, which
-// is used by FromIcalFile and FromIcalUrl.
-func iCalParser(lineCh <-chan string) (*Calendar, *CustomError) {
+// Unmarshal an iCalendar file into a Calendar{} struct. The faulty properties
+// and components are skipped and logged.
+func FromIcalFile(path string) (*Calendar, *CustomError) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, NewCustomError("can't opening file", map[string]any{
+			"path": path,
+			"err":  err,
+		})
+	}
+	defer file.Close()
+
+	cal, diagnostics, customErr := Parse(context.Background(), file, ParseOptions{})
+	logDiagnostics("ical.FromIcalFile", diagnostics)
+	return cal, customErr
+}
+
+// Unmarshal an iCalendar URL into a Calendar{} struct. The faulty properties
+// and components are skipped and logged.
+func FromIcalUrl(url_ string) (*Calendar, *CustomError) {
+	cal, diagnostics, customErr := FetchIcal(context.Background(), url_, ParseOptions{})
+	logDiagnostics("ical.FromIcalUrl", diagnostics)
+	return cal, customErr
+}
+
+// The shared logic for parsing iCalendar content lines, which is used by Parse
+// and FromJCal. In strict mode, the first error aborts the parsing.
+func parseLines(lines *lineReader, strict bool) (*Calendar, []Diagnostic, *CustomError) {
 	ignoredFields := map[string]struct{}{
 		"X-APPLE-TRAVEL-ADVISORY-BEHAVIOR": {},
 		"ACKNOWLEDGED":                     {},
 		"X-APPLE-DEFAULT-ALARM":            {},
 		"VERSION":                          {},
 		"CALSCALE":                         {},
-		"METHOD":                           {},
 		"X-WR-TIMEZONE":                    {},
 	}
 
 	cal := NewCalendar()
-	lineCount := 0
-	eventCount := 0
-
-	errCh := make(chan *CustomError)
+	diagnostics := make([]Diagnostic, 0)
+	// Record a problem, returns the error to abort with if any
+	diagnose := func(severity DiagnosticSeverity, line int, column int, msg string) *CustomError {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: severity,
+			Line:     line,
+			Column:   column,
+			Message:  msg,
+		})
+		if strict && severity == DiagnosticSeverityError {
+			return NewCustomError(msg, map[string]any{
+				"line":   line,
+				"column": column,
+			})
+		}
+		return nil
+	}
+	// the lines the child events end at, in the same order as cal.childEvents
+	childEventLines := make([]int, 0)
 
-	go func() {
+	err := func() *CustomError {
 		var mode string
-		undecidedEvent := event.NewUndecidedEvent()
+		newUndecidedEvent := func() event.UndecidedEvent {
+			undecidedEvent := event.NewUndecidedEvent()
+			undecidedEvent.SetTzidResolver(cal.resolveTzid)
+			return undecidedEvent
+		}
+		undecidedEvent := newUndecidedEvent()
 		newAlarm := structured.NewAlarm()
+		newTimezone := structured.NewTimezone()
+		var newObservance structured.TimezoneObservance
+		newTodo := func() structured.Todo {
+			todo := structured.NewTodo()
+			todo.SetTzidResolver(cal.resolveTzid)
+			return todo
+		}
+		todo := newTodo()
+		// VALARM blocks can be in either VEVENT or VTODO blocks
+		var alarmParentMode string
+		// the components the parser doesn't know about are skipped as a
+		// whole, e.g. VJOURNAL, they may be nested
+		unknownComponents := make([]string, 0)
 
-		var line string
-		isFirstLine := true
-	scoped:
-		for rawLine := range lineCh {
-			lineCount++
-			switch {
-			case isFirstLine:
-				isFirstLine = false
-				line = rawLine
-				continue
-			case strings.HasPrefix(rawLine, " "):
-				line += rawLine
+		for {
+			contentLine, ok := lines.next()
+			if !ok {
+				break
+			}
+			line := contentLine.text
+			lineNo, column := contentLine.position(0)
+			valueLineNo, valueColumn := contentLine.valuePosition()
+			if line == "" {
 				continue
-			case rawLine == "END:VCALENDAR":
-				errCh <- nil
-				break scoped
 			}
 
 			slice := strings.SplitN(line, ":", 2)
 			if len(slice) < 2 {
-				switch mode {
-				case "event":
-					if err := undecidedEvent.AddIcalProperty(line); err != nil {
-						errCh <- NewCustomError("can't add ical property to event", map[string]any{
-							"line":    lineCount,
-							"content": line,
-							"err":     err,
-						})
-					}
-				case "alarm":
-					newAlarm.AddIcalProperty(line)
-				default:
-					errCh <- NewCustomError("unhandled line", map[string]any{
-						"line":    lineCount,
-						"content": line,
-					})
+				if len(unknownComponents) > 0 {
+					continue
+				}
+				if err := diagnose(DiagnosticSeverityWarning, lineNo, column, "line ignored: missing ':'"); err != nil {
+					return err
 				}
-				line = rawLine
 				continue
 			}
 			key := strings.ToUpper(strings.TrimSpace(slice[0]))
 			value := strings.TrimSpace(slice[1])
+			propertyName := strings.SplitN(key, ";", 2)[0]
 
 			if _, ok := ignoredFields[key]; ok {
-				line = rawLine
+				continue
+			}
+
+			if len(unknownComponents) > 0 {
+				switch key {
+				case "BEGIN":
+					unknownComponents = append(unknownComponents, value)
+				case "END":
+					if value != unknownComponents[len(unknownComponents)-1] {
+						return NewCustomError("unexpected END:"+value, map[string]any{
+							"line":    lineNo,
+							"column":  column,
+							"content": line,
+						})
+					}
+					unknownComponents = unknownComponents[:len(unknownComponents)-1]
+				}
 				continue
 			}
 
@@ -229,238 +380,356 @@ func iCalParser(lineCh <-chan string) (*Calendar, *CustomError) {
 				switch value {
 				case "VCALENDAR":
 					if mode == "calendar" {
-						errCh <- NewCustomError("nested VCALENDAR block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("nested VCALENDAR block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
 					mode = "calendar"
 				case "VTIMEZONE":
 					if mode == "timezone" {
-						errCh <- NewCustomError("nested VTIMEZONE block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("nested VTIMEZONE block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
 					mode = "timezone"
+					newTimezone = structured.NewTimezone()
 				case "STANDARD":
 					if mode == "standard" {
-						errCh <- NewCustomError("nested STANDARD block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("nested STANDARD block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
 					if mode != "timezone" {
-						errCh <- NewCustomError("STANDARD block not in VTIMEZONE block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("STANDARD block not in VTIMEZONE block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 							"mode":    mode,
 						})
 					}
 					mode = "standard"
+					newObservance = structured.NewTimezoneObservance(structured.TimezoneObservanceStandard)
 				case "DAYLIGHT":
 					switch {
 					case mode == "timezone":
 						mode = "daylight"
+						newObservance = structured.NewTimezoneObservance(structured.TimezoneObservanceDaylight)
 					case mode == "daylight":
-						errCh <- NewCustomError("nested DAYLIGHT block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("nested DAYLIGHT block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					default:
-						errCh <- NewCustomError("DAYLIGHT block not in STANDARD block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("DAYLIGHT block not in VTIMEZONE block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
 				case "VEVENT":
 					if mode == "event" {
-						slog.Warn("nested VEVENT block", "line", lineCount, "content", line)
+						if err := diagnose(DiagnosticSeverityError, lineNo, column, fmt.Sprintf("nested VEVENT block, event %q skipped", undecidedEvent.GetSummary())); err != nil {
+							return err
+						}
+						undecidedEvent = newUndecidedEvent()
 					}
 					mode = "event"
+				case "VTODO":
+					if mode == "todo" {
+						return NewCustomError("nested VTODO block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
+							"content": line,
+						})
+					}
+					mode = "todo"
 				case "VALARM":
 					switch {
-					case mode == "event":
+					case mode == "event", mode == "todo":
+						alarmParentMode = mode
 						mode = "alarm"
 					case mode == "alarm":
-						errCh <- NewCustomError("nested VALARM block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("nested VALARM block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					default:
-						errCh <- NewCustomError("VALARM block not in VEVENT block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("VALARM block not in VEVENT or VTODO block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
 				default:
 					if mode == "" {
-						errCh <- NewCustomError("expecting BEGIN block", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("expecting BEGIN block", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
+					unknownComponents = append(unknownComponents, value)
+					if err := diagnose(DiagnosticSeverityWarning, lineNo, column, fmt.Sprintf("unsupported %s component skipped", value)); err != nil {
+						return err
+					}
 				}
 			case "END":
 				switch mode {
+				case "calendar":
+					if value != "VCALENDAR" {
+						return NewCustomError("unexpected END:VCALENDAR", map[string]any{
+							"line":    lineNo,
+							"column":  column,
+							"content": line,
+						})
+					}
+					return nil
 				case "timezone":
-					if value != "VTIMEZONE" &&
-						value != "STANDARD" &&
-						value != "DAYLIGHT" {
-						errCh <- NewCustomError("unexpected END:VTIMEZONE", map[string]any{
-							"line":    lineCount,
+					if value != "VTIMEZONE" {
+						return NewCustomError("unexpected END:VTIMEZONE", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
+					parsedTimezone := newTimezone
+					if err := cal.AddTimezone(&parsedTimezone); err != nil {
+						if err := diagnose(DiagnosticSeverityError, lineNo, column, fmt.Sprintf("timezone skipped: %s", err)); err != nil {
+							return err
+						}
+					}
+					newTimezone = structured.NewTimezone()
 					mode = "calendar"
 				case "standard":
 					if value != "STANDARD" {
-						errCh <- NewCustomError("unexpected END:STANDARD", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("unexpected END:STANDARD", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
+					newTimezone.AddObservance(newObservance)
 					mode = "timezone"
 				case "daylight":
 					if value != "DAYLIGHT" {
-						errCh <- NewCustomError("unexpected END:DAYLIGHT", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("unexpected END:DAYLIGHT", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
+					newTimezone.AddObservance(newObservance)
 					mode = "timezone"
 				case "event":
 					mode = "calendar"
 					if value != "VEVENT" {
-						errCh <- NewCustomError("unexpected END:VEVENT", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("unexpected END:VEVENT", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
-					eventCount++
 					if undecidedEvent.GetSummary() == "" {
 						undecidedEvent.SetSummary("(no title)")
 					}
+					summary := undecidedEvent.GetSummary()
+					// the recurrence is expanded in the location the dates
+					// were parsed in
+					if timezone, ok := cal.customTimezone(undecidedEvent.GetTzid()); ok {
+						undecidedEvent.SetTimezone(timezone)
+					}
 					resultEvent, err := undecidedEvent.DecideEventType()
+					undecidedEvent = newUndecidedEvent()
 					if err != nil {
-						errCh <- NewCustomError("can't decide event type", map[string]any{
-							"line":    lineCount,
-							"content": line,
-						})
+						if err := diagnose(DiagnosticSeverityError, lineNo, column, fmt.Sprintf("event %q skipped: %s", summary, err)); err != nil {
+							return err
+						}
+						continue
 					}
 					switch decidedEvent := resultEvent.(type) {
 					case event.MasterEvent:
-						if _, ok := cal.masterEvents[undecidedEvent.GetID()]; ok {
-							errCh <- NewCustomError("duplicate event id", map[string]any{
-								"line":    lineCount,
-								"content": line,
-							})
+						if _, ok := cal.masterEvents[decidedEvent.GetID()]; ok {
+							if err := diagnose(DiagnosticSeverityError, lineNo, column, fmt.Sprintf("event %q skipped: duplicate event id %s", summary, decidedEvent.GetID())); err != nil {
+								return err
+							}
+							continue
 						}
-						cal.masterEvents[undecidedEvent.GetID()] = &decidedEvent
+						cal.masterEvents[decidedEvent.GetID()] = &decidedEvent
 					case event.ChildEvent:
 						cal.childEvents = append(cal.childEvents, &decidedEvent)
-					default:
-						errCh <- NewCustomError("can't decide event type", map[string]any{
-							"line":    lineCount,
-							"content": line,
-						})
+						childEventLines = append(childEventLines, lineNo)
 					}
-					undecidedEvent = event.NewUndecidedEvent()
 				case "alarm":
 					if value != "VALARM" {
-						errCh <- NewCustomError("unexpected END:VALARM", map[string]any{
-							"line":    lineCount,
+						return NewCustomError("unexpected END:VALARM", map[string]any{
+							"line":    lineNo,
+							"column":  column,
 							"content": line,
 						})
 					}
-					undecidedEvent.AddAlarm(newAlarm)
+					switch err := newAlarm.Validate(); {
+					case err != nil:
+						if err := diagnose(DiagnosticSeverityWarning, lineNo, column, fmt.Sprintf("alarm skipped: %s", err)); err != nil {
+							return err
+						}
+					case alarmParentMode == "todo":
+						todo.AddAlarm(newAlarm)
+					default:
+						undecidedEvent.AddAlarm(newAlarm)
+					}
 					newAlarm = structured.NewAlarm()
-					mode = "event"
+					mode = alarmParentMode
+				case "todo":
+					if value != "VTODO" {
+						return NewCustomError("unexpected END:VTODO", map[string]any{
+							"line":    lineNo,
+							"column":  column,
+							"content": line,
+						})
+					}
+					parsedTodo := todo
+					if err := cal.AddTodo(parsedTodo.GetID(), &parsedTodo); err != nil {
+						if err := diagnose(DiagnosticSeverityError, lineNo, column, fmt.Sprintf("todo %q skipped: %s", parsedTodo.GetSummary(), err)); err != nil {
+							return err
+						}
+					}
+					todo = newTodo()
+					mode = "calendar"
 				default:
-					errCh <- NewCustomError("unexpected END", map[string]any{
-						"line":    lineCount,
+					return NewCustomError("unexpected END", map[string]any{
+						"line":    lineNo,
+						"column":  column,
 						"content": line,
 						"mode":    mode,
 					})
 				}
 			default:
 				switch mode {
-				case "timezone", "standard", "daylight":
+				case "timezone":
+					newTimezone.AddIcalProperty(line)
+				case "standard", "daylight":
+					if err := newObservance.AddIcalProperty(line); err != nil {
+						if err := diagnose(DiagnosticSeverityWarning, valueLineNo, valueColumn, fmt.Sprintf("%s ignored: %s", propertyName, err)); err != nil {
+							return err
+						}
+					}
 				case "calendar":
 					switch key {
 					case "PRODID":
 						cal.prodID = value
+					case "METHOD":
+						cal.method = Method(strings.ToUpper(value))
 					case "X-WR-CALNAME":
-						cal.SetName(value)
+						cal.SetName(utils.UnescapeText(value))
 					case "X-WR-CALDESC":
-						cal.SetDescription(value)
+						cal.SetDescription(utils.UnescapeText(value))
 					default:
-						slog.Warn("unhandled line", "line", lineCount, "content", line)
+						if err := diagnose(DiagnosticSeverityWarning, lineNo, column, fmt.Sprintf("%s ignored", propertyName)); err != nil {
+							return err
+						}
 					}
 				case "event":
 					if err := undecidedEvent.AddIcalProperty(line); err != nil {
-						errCh <- NewCustomError("can't add ical property to event", map[string]any{
-							"line":    lineCount,
-							"content": line,
-							"err":     err,
-						})
+						if err := diagnose(DiagnosticSeverityWarning, valueLineNo, valueColumn, fmt.Sprintf("%s ignored: %s", propertyName, err)); err != nil {
+							return err
+						}
 					}
 				case "alarm":
-					newAlarm.AddIcalProperty(line)
+					if err := newAlarm.AddIcalProperty(line); err != nil {
+						if err := diagnose(DiagnosticSeverityWarning, valueLineNo, valueColumn, fmt.Sprintf("%s ignored: %s", propertyName, err)); err != nil {
+							return err
+						}
+					}
+				case "todo":
+					if err := todo.AddIcalProperty(line); err != nil {
+						if err := diagnose(DiagnosticSeverityWarning, valueLineNo, valueColumn, fmt.Sprintf("%s ignored: %s", propertyName, err)); err != nil {
+							return err
+						}
+					}
 				default:
-					slog.Warn("unhandled line", "line", lineCount, "content", line)
+					if err := diagnose(DiagnosticSeverityWarning, lineNo, column, fmt.Sprintf("%s ignored", propertyName)); err != nil {
+						return err
+					}
 				}
 			}
-			line = rawLine
 		}
+		if err := lines.err(); err != nil {
+			return NewCustomError("can't read the input", map[string]any{
+				"line": lines.lineCount,
+				"err":  err,
+			})
+		}
+		return NewCustomError("missing END:VCALENDAR", map[string]any{
+			"line": lines.lineCount,
+		})
 	}()
-
-	err := <-errCh
 	if err != nil {
-		return nil, err
+		return nil, diagnostics, err
 	}
 
 	// add child events to master events
-	for _, childEvent := range cal.childEvents {
-		if masterEvent, ok := cal.masterEvents[childEvent.GetID()]; ok {
-			if err := masterEvent.AddChildEvent(childEvent); err != nil {
-				slog.Warn("can't add child event to master event", "childEventID", childEvent.GetID(), "err", err)
-				continue
+	for i, childEvent := range cal.childEvents {
+		masterEvent, ok := cal.masterEvents[childEvent.GetID()]
+		if !ok {
+			if err := diagnose(DiagnosticSeverityError, childEventLines[i], 0, fmt.Sprintf("event %q skipped: no event with id %s to override", childEvent.GetSummary(), childEvent.GetID())); err != nil {
+				return nil, diagnostics, err
 			}
-		} else {
-			slog.Warn("master event not found for child event", "masterEventID", childEvent.GetID())
 			continue
 		}
+		if err := masterEvent.AddChildEvent(childEvent); err != nil {
+			if err := diagnose(DiagnosticSeverityError, childEventLines[i], 0, fmt.Sprintf("event %q skipped: %s", childEvent.GetSummary(), err)); err != nil {
+				return nil, diagnostics, err
+			}
+		}
 	}
 	cal.childEvents = nil
 
-	return &cal, nil
+	return &cal, diagnostics, nil
 }
 
-// Marshal a Calendar{} struct into an iCalendar string.
-func (cal *Calendar) ToIcal(w func(string)) error {
-	writer := func(s string) {
-		var slices []string
-		for i := 0; i < len(s); i += 75 {
-			end := min(i+75, len(s))
-			slices = append(slices, s[i:end])
-		}
-		w(strings.Join(slices, "\n "))
-	}
+// Marshal a Calendar{} struct into an iCalendar stream, folded and with CRLF
+// line breaks.
+func (cal *Calendar) ToIcal(w io.Writer) error {
+	foldingWriter := utils.NewFoldingWriter(w)
+	writer := foldingWriter.WriteString
 
 	writer("BEGIN:VCALENDAR\n")
 	writer("PRODID:" + cal.prodID + "\n")
 	writer("VERSION:2.0\n")
-	writer("X-WR-CALNAME:" + cal.name + "\n")
+	if cal.method != "" {
+		writer("METHOD:" + string(cal.method) + "\n")
+	}
+	writer("X-WR-CALNAME:" + utils.EscapeText(cal.name) + "\n")
 	if cal.description != "" {
-		writer("X-WR-CALDESC:" + cal.description + "\n")
+		writer("X-WR-CALDESC:" + utils.EscapeText(cal.description) + "\n")
+	}
+
+	for _, timezone := range cal.timezonesInUse() {
+		timezone.ToIcal(writer)
 	}
 
 	for _, event := range cal.masterEvents {
 		event.ToIcal(writer)
 	}
+	for _, todo := range cal.todos {
+		todo.ToIcal(writer)
+	}
+	for _, freeBusy := range cal.freeBusys {
+		freeBusy.ToIcal(writer)
+	}
 	writer("END:VCALENDAR\n")
 
+	if err := foldingWriter.Flush(); err != nil {
+		return fmt.Errorf("(*Calendar).ToIcal: %w", err)
+	}
 	return nil
 }
 
@@ -490,6 +759,16 @@ func (c *Calendar) SetProdID(prodID string) error {
 	return nil
 }
 
+// Get the iTIP method of the calendar, empty if it's not an iTIP message
+func (c *Calendar) GetMethod() Method {
+	return c.method
+}
+
+// Set the iTIP method of the calendar
+func (c *Calendar) SetMethod(method Method) {
+	c.method = method
+}
+
 // Get the calendar name
 func (c *Calendar) GetName() string {
 	return c.name
@@ -537,6 +816,224 @@ func (c *Calendar) IterateMasterEvents(f func(id string, event *event.MasterEven
 	return nil
 }
 
+// Iterate lazily over the occurrences of all events overlapping the
+// [from, to) window, one event after the other. The events whose recurrence
+// rule can't be parsed are skipped.
+func (c *Calendar) ExpandBetween(from time.Time, to time.Time) func() (event.Occurrence, bool) {
+	ids := make([]string, 0, len(c.masterEvents))
+	for id := range c.masterEvents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var next func() (event.Occurrence, bool)
+	return func() (event.Occurrence, bool) {
+		for {
+			if next != nil {
+				if occurrence, ok := next(); ok {
+					return occurrence, true
+				}
+				next = nil
+			}
+			if len(ids) == 0 {
+				return event.Occurrence{}, false
+			}
+			id := ids[0]
+			ids = ids[1:]
+			var err error
+			if next, err = c.masterEvents[id].Occurrences(from, to); err != nil {
+				slog.Warn("can't expand event", "where", "(*Calendar).ExpandBetween", "id", id, "error", err)
+			}
+		}
+	}
+}
+
+// Add a VTODO to the calendar
+func (c *Calendar) AddTodo(id string, todo *structured.Todo) error {
+	if _, ok := c.todos[id]; ok {
+		return fmt.Errorf("todo with id %s already exists", id)
+	}
+	if err := todo.Validate(); err != nil {
+		return fmt.Errorf("invalid todo: %w", err)
+	}
+	c.todos[id] = todo
+	return nil
+}
+
+func (c *Calendar) RemoveTodo(id string) error {
+	if _, ok := c.todos[id]; !ok {
+		return fmt.Errorf("todo with id %s does not exist", id)
+	}
+	delete(c.todos, id)
+	return nil
+}
+
+// Iterate over all VTODOs in the calendar and apply a function to each.
+func (c *Calendar) IterateTodos(f func(id string, todo *structured.Todo) error) error {
+	for id, todo := range c.todos {
+		if err := f(id, todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the number of VTODOs in the calendar
+func (c *Calendar) GetTodoCount() int {
+	return len(c.todos)
+}
+
+// Add a VFREEBUSY to the calendar
+func (c *Calendar) AddFreeBusy(freeBusy *structured.FreeBusy) error {
+	if err := freeBusy.Validate(); err != nil {
+		return fmt.Errorf("invalid free/busy: %w", err)
+	}
+	c.freeBusys = append(c.freeBusys, freeBusy)
+	return nil
+}
+
+// Iterate over all VFREEBUSYs in the calendar and apply a function to each.
+func (c *Calendar) IterateFreeBusys(f func(freeBusy *structured.FreeBusy) error) error {
+	for _, freeBusy := range c.freeBusys {
+		if err := f(freeBusy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add a VTIMEZONE to the calendar, replacing the one having the same TZID
+func (c *Calendar) AddTimezone(tz *structured.Timezone) error {
+	if err := tz.Validate(); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	c.timezones[tz.GetTzid()] = tz
+	return nil
+}
+
+// Parse a single VTIMEZONE component, e.g. stored apart from its calendar
+func ParseTimezone(text string) (*structured.Timezone, error) {
+	cal, _, customErr := Parse(context.Background(), strings.NewReader("BEGIN:VCALENDAR\n"+text+"END:VCALENDAR\n"), ParseOptions{Strict: true})
+	if customErr != nil {
+		return nil, fmt.Errorf("ParseTimezone: %s", customErr)
+	}
+	for _, tz := range cal.timezones {
+		return tz, nil
+	}
+	return nil, fmt.Errorf("ParseTimezone: no VTIMEZONE")
+}
+
+// Get a VTIMEZONE of the calendar by its TZID
+func (c *Calendar) GetTimezone(tzid string) (*structured.Timezone, bool) {
+	tz, ok := c.timezones[tzid]
+	return tz, ok
+}
+
+// Iterate over all VTIMEZONEs in the calendar and apply a function to each.
+func (c *Calendar) IterateTimezones(f func(tzid string, tz *structured.Timezone) error) error {
+	for tzid, tz := range c.timezones {
+		if err := f(tzid, tz); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the VTIMEZONE of the calendar defining a TZID the IANA database doesn't
+// know about
+func (c *Calendar) customTimezone(tzid string) (*structured.Timezone, bool) {
+	tz, ok := c.timezones[tzid]
+	if !ok {
+		return nil, false
+	}
+	if _, err := time.LoadLocation(tzid); err == nil {
+		return nil, false
+	}
+	return tz, true
+}
+
+// Resolve a TZID the IANA database doesn't know about using the VTIMEZONEs of
+// the calendar, in the same location the recurrences are expanded in.
+func (c *Calendar) resolveTzid(tzid string, wallClock time.Time) (int64, bool) {
+	tz, ok := c.customTimezone(tzid)
+	if !ok {
+		return 0, false
+	}
+	loc, err := tz.Location()
+	if err != nil {
+		slog.Warn("can't resolve TZID using VTIMEZONE", "tzid", tzid, "err", err)
+		return 0, false
+	}
+	return time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(),
+		wallClock.Hour(), wallClock.Minute(), wallClock.Second(), 0, loc).Unix(), true
+}
+
+// Get the VTIMEZONEs needed to serialize the events written in local time.
+// Timezones parsed from the original calendar are preferred, then the ones
+// the events were parsed with, the missing ones are generated from Go's
+// tzdata, covering the years the events span.
+func (c *Calendar) timezonesInUse() []*structured.Timezone {
+	type yearRange struct{ from, to time.Time }
+	ranges := make(map[string]*yearRange)
+	timezones := make(map[string]*structured.Timezone)
+	collect := func(info *event.EventInfo) {
+		if info.GetDateKind() != utils.DateKindTzid {
+			return
+		}
+		tzid := info.GetTzid()
+		if _, ok := timezones[tzid]; ok {
+			return
+		}
+		if tz, ok := c.timezones[tzid]; ok {
+			timezones[tzid] = tz
+			return
+		}
+		if tz := info.GetTimezone(); tz != nil {
+			timezones[tzid] = tz
+			return
+		}
+		if _, err := time.LoadLocation(tzid); err != nil {
+			return
+		}
+		start := time.Unix(info.GetStartDate(), 0)
+		end := time.Unix(max(info.GetEndDate(), info.GetStartDate()), 0)
+		if r, ok := ranges[tzid]; ok {
+			if start.Before(r.from) {
+				r.from = start
+			}
+			if end.After(r.to) {
+				r.to = end
+			}
+			return
+		}
+		ranges[tzid] = &yearRange{from: start, to: end}
+	}
+	for _, masterEvent := range c.masterEvents {
+		collect(&masterEvent.EventInfo)
+		masterEvent.IterateChildEvents(func(id string, childEvent *event.ChildEvent) error {
+			collect(&childEvent.EventInfo)
+			return nil
+		})
+	}
+
+	for tzid, r := range ranges {
+		if _, ok := timezones[tzid]; ok {
+			continue
+		}
+		loc, _ := time.LoadLocation(tzid)
+		tz := structured.NewTimezoneFromLocation(loc, r.from, r.to)
+		timezones[tzid] = &tz
+	}
+	sortedTimezones := make([]*structured.Timezone, 0, len(timezones))
+	for _, tz := range timezones {
+		sortedTimezones = append(sortedTimezones, tz)
+	}
+	sort.Slice(sortedTimezones, func(i, j int) bool {
+		return sortedTimezones[i].GetTzid() < sortedTimezones[j].GetTzid()
+	})
+	return sortedTimezones
+}
+
 // Get the number of MasterEvents in the calendar
 func (c *Calendar) GetMasterEventCount() int {
 	return len(c.masterEvents)
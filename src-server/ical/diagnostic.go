@@ -0,0 +1,88 @@
+package ical
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type DiagnosticSeverity string
+
+var (
+	// Something was ignored, e.g. an invalid property, its component is kept
+	DiagnosticSeverityWarning DiagnosticSeverity = "warning"
+	// A component was skipped, e.g. an invalid event
+	DiagnosticSeverityError DiagnosticSeverity = "error"
+)
+
+// A problem found while parsing
+type Diagnostic struct {
+	Severity DiagnosticSeverity
+	Line     int // 1-based, 0 if unknown
+	Column   int // 1-based, 0 if unknown
+	Message  string
+}
+
+// Convert the diagnostic into a human-readable string, e.g.
+// `error at line 12, column 1: event "Standup" skipped: start date is missing`
+func (d Diagnostic) String() string {
+	switch {
+	case d.Line == 0:
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	case d.Column == 0:
+		return fmt.Sprintf("%s at line %d: %s", d.Severity, d.Line, d.Message)
+	default:
+		return fmt.Sprintf("%s at line %d, column %d: %s", d.Severity, d.Line, d.Column, d.Message)
+	}
+}
+
+// The fixes suggested for the common problems, by a part of their message
+var diagnosticSuggestions = []struct {
+	pattern    string
+	suggestion string
+}{
+	{"start date is missing", "add a DTSTART property, e.g. DTSTART:20250101T090000Z"},
+	{"summary is missing", "add a SUMMARY property"},
+	{"invalid TZID", "use an IANA timezone name, e.g. TZID=Europe/Paris, or declare the TZID in a VTIMEZONE block"},
+	{"to override", "add the recurring event having the same UID, or remove the RECURRENCE-ID"},
+	{"not in rrule", "make the RECURRENCE-ID one of the dates the RRULE of the event gives"},
+	{"does not have a rrule", "add an RRULE to the event having the same UID, or remove the RECURRENCE-ID"},
+	{"invalid RRULE", "check the RRULE against RFC5545 section 3.3.10, e.g. RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10"},
+	{"only works with recurring events", "add an RRULE to the event, or remove its EXDATE and RDATE"},
+	{"duplicate event id", "give each event its own UID"},
+	{"start date must be before end date", "swap DTSTART and DTEND, or fix one of them"},
+	{"DTEND must be after DTSTART", "swap DTSTART and DTEND, or fix one of them"},
+	{"along with", "keep either DTEND or DURATION"},
+	{"invalid duration", "write the duration as in RFC5545 section 3.3.6, e.g. PT1H30M"},
+	{"invalid date-time format", "write the date as YYYYMMDD, or the date-time as YYYYMMDDTHHMMSS with a Z suffix for UTC"},
+	{"missing END:", "close every BEGIN: block with its END: line"},
+	{"missing ':'", "write the property as NAME;PARAM=VALUE:VALUE, a folded line must start with a space"},
+}
+
+// Get a suggested fix for the problem, empty if there is none
+func (d Diagnostic) Suggestion() string {
+	for _, s := range diagnosticSuggestions {
+		if strings.Contains(d.Message, s.pattern) {
+			return s.suggestion
+		}
+	}
+	return ""
+}
+
+// Count the diagnostics having the given severity
+func CountDiagnostics(diagnostics []Diagnostic, severity DiagnosticSeverity) int {
+	count := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Log the diagnostics, for the callers having no one to show them to
+func logDiagnostics(where string, diagnostics []Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		slog.Warn(where, "diagnostic", diagnostic.String())
+	}
+}
@@ -0,0 +1,323 @@
+package ical
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"towd/src-server/ical/event"
+)
+
+// Identifies an event in a calendar: its UID, and the RECURRENCE-ID of the
+// occurrence a child event overrides, 0 for a master event
+type EventKey struct {
+	UID          string
+	RecurrenceID int64
+}
+
+// A change of an event between two calendars
+type EventChange struct {
+	Key EventKey
+	// The event in the old calendar, nil if it was added
+	Old *event.EventInfo
+	// The event in the new calendar, nil if it was removed
+	New *event.EventInfo
+	// The properties that differ, e.g. SUMMARY or RRULE, empty if the event
+	// was added or removed
+	Properties []string
+
+	// the version of the event applied by Merge
+	master *event.MasterEvent
+	child  *event.ChildEvent
+}
+
+// The differences between two versions of a calendar, sorted by UID then
+// RECURRENCE-ID
+type CalendarDiff struct {
+	Added    []EventChange
+	Removed  []EventChange
+	Modified []EventChange
+	// The events modified in the new calendar while their old version is more
+	// recent, by SEQUENCE then LAST-MODIFIED. The old version is kept.
+	Outdated []EventChange
+}
+
+// Check if the calendars hold the same events
+func (d CalendarDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// an event of a calendar, either a master or a child event
+type diffEntry struct {
+	info   *event.EventInfo
+	master *event.MasterEvent
+	child  *event.ChildEvent
+}
+
+// Compare the events of two versions of a calendar, e.g. before and after an
+// external calendar is refreshed. The events are matched by UID and
+// RECURRENCE-ID. When both versions of an event differ, the one with the
+// higher SEQUENCE wins, then the one modified last (LAST-MODIFIED), then the
+// new one. The properties not describing the event, e.g. DTSTAMP, are ignored.
+// Example usage:
+//
+//	diff := ical.Diff(oldCalendar, newCalendar)
+//	for _, change := range diff.Modified {
+//	    fmt.Println(change.New.GetSummary(), change.Properties)
+//	}
+//	mergedCalendar, err := ical.Merge(oldCalendar, diff)
+func Diff(oldCal *Calendar, newCal *Calendar) CalendarDiff {
+	oldEntries := diffEntries(oldCal)
+	newEntries := diffEntries(newCal)
+	diff := CalendarDiff{}
+
+	for _, key := range sortedKeys(oldEntries) {
+		if _, ok := newEntries[key]; !ok {
+			diff.Removed = append(diff.Removed, EventChange{
+				Key: key,
+				Old: oldEntries[key].info,
+			})
+		}
+	}
+	for _, key := range sortedKeys(newEntries) {
+		newEntry := newEntries[key]
+		oldEntry, ok := oldEntries[key]
+		if !ok {
+			diff.Added = append(diff.Added, EventChange{
+				Key:    key,
+				New:    newEntry.info,
+				master: newEntry.master,
+				child:  newEntry.child,
+			})
+			continue
+		}
+
+		properties := changedProperties(oldEntry, newEntry)
+		if len(properties) == 0 {
+			continue
+		}
+		change := EventChange{
+			Key:        key,
+			Old:        oldEntry.info,
+			New:        newEntry.info,
+			Properties: properties,
+			master:     newEntry.master,
+			child:      newEntry.child,
+		}
+		if supersedes(oldEntry.info, newEntry.info) {
+			change.master, change.child = oldEntry.master, oldEntry.child
+			diff.Outdated = append(diff.Outdated, change)
+		} else {
+			diff.Modified = append(diff.Modified, change)
+		}
+	}
+	return diff
+}
+
+// Apply the differences to a calendar, usually the old calendar given to
+// Diff. The calendar isn't modified, a new one is returned with the same
+// properties, timezones, todos and free/busy times. The child events which no
+// longer match their master event, e.g. because its recurrence rule changed,
+// are dropped.
+func Merge(cal *Calendar, diff CalendarDiff) (*Calendar, error) {
+	merged := NewCalendar()
+	merged.id = cal.id
+	merged.prodID = cal.prodID
+	merged.method = cal.method
+	merged.name = cal.name
+	merged.description = cal.description
+	for tzid, tz := range cal.timezones {
+		merged.timezones[tzid] = tz
+	}
+	for id, todo := range cal.todos {
+		merged.todos[id] = todo
+	}
+	merged.freeBusys = append(merged.freeBusys, cal.freeBusys...)
+
+	entries := diffEntries(cal)
+	for _, change := range diff.Removed {
+		delete(entries, change.Key)
+	}
+	for _, changes := range [][]EventChange{diff.Added, diff.Modified} {
+		for _, change := range changes {
+			if change.master == nil && change.child == nil {
+				return nil, fmt.Errorf("ical.Merge: change of event %s isn't from ical.Diff", change.Key.UID)
+			}
+			entries[change.Key] = diffEntry{master: change.master, child: change.child}
+		}
+	}
+
+	// the master events are copied without their child events, which are
+	// added back from the entries
+	keys := sortedKeys(entries)
+	for _, key := range keys {
+		if entries[key].master == nil {
+			continue
+		}
+		undecidedEvent := entries[key].master.ToUndecidedEvent()
+		decidedEvent, err := undecidedEvent.DecideEventType()
+		if err != nil {
+			return nil, fmt.Errorf("ical.Merge: event %s: %w", key.UID, err)
+		}
+		masterEvent, ok := decidedEvent.(event.MasterEvent)
+		if !ok {
+			return nil, fmt.Errorf("ical.Merge: event %s isn't a master event", key.UID)
+		}
+		merged.masterEvents[key.UID] = &masterEvent
+	}
+	for _, key := range keys {
+		childEvent := entries[key].child
+		if childEvent == nil {
+			continue
+		}
+		masterEvent, ok := merged.masterEvents[key.UID]
+		if !ok {
+			slog.Warn("ical.Merge: child event dropped, no master event", "uid", key.UID, "recurrenceID", key.RecurrenceID)
+			continue
+		}
+		if err := masterEvent.AddChildEvent(childEvent); err != nil {
+			slog.Warn("ical.Merge: child event dropped", "uid", key.UID, "recurrenceID", key.RecurrenceID, "error", err)
+		}
+	}
+	return &merged, nil
+}
+
+// Get the master and child events of the calendar by their key
+func diffEntries(cal *Calendar) map[EventKey]diffEntry {
+	entries := make(map[EventKey]diffEntry)
+	for uid, masterEvent := range cal.masterEvents {
+		entries[EventKey{UID: uid}] = diffEntry{info: &masterEvent.EventInfo, master: masterEvent}
+		masterEvent.IterateChildEvents(func(id string, childEvent *event.ChildEvent) error {
+			entries[EventKey{UID: uid, RecurrenceID: childEvent.GetRecurrenceID()}] = diffEntry{info: &childEvent.EventInfo, child: childEvent}
+			return nil
+		})
+	}
+	return entries
+}
+
+func sortedKeys(entries map[EventKey]diffEntry) []EventKey {
+	keys := make([]EventKey, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].UID != keys[j].UID {
+			return keys[i].UID < keys[j].UID
+		}
+		return keys[i].RecurrenceID < keys[j].RecurrenceID
+	})
+	return keys
+}
+
+// Check if an event is more recent than another version of it: a higher
+// SEQUENCE, or the same SEQUENCE and a later LAST-MODIFIED
+func supersedes(info *event.EventInfo, otherInfo *event.EventInfo) bool {
+	if info.GetSequence() != otherInfo.GetSequence() {
+		return info.GetSequence() > otherInfo.GetSequence()
+	}
+	return info.GetUpdatedAt() != 0 && otherInfo.GetUpdatedAt() != 0 &&
+		info.GetUpdatedAt() > otherInfo.GetUpdatedAt()
+}
+
+// Get the names of the properties that differ between two versions of an
+// event
+func changedProperties(oldEntry diffEntry, newEntry diffEntry) []string {
+	oldInfo, newInfo := oldEntry.info, newEntry.info
+	properties := make([]string, 0)
+	check := func(name string, isSame bool) {
+		if !isSame {
+			properties = append(properties, name)
+		}
+	}
+
+	check("SUMMARY", oldInfo.GetSummary() == newInfo.GetSummary())
+	check("DESCRIPTION", oldInfo.GetDescription() == newInfo.GetDescription())
+	check("LOCATION", oldInfo.GetLocation() == newInfo.GetLocation())
+	check("URL", oldInfo.GetURL() == newInfo.GetURL())
+	check("DTSTART", oldInfo.GetStartDate() == newInfo.GetStartDate() &&
+		oldInfo.GetDateKind() == newInfo.GetDateKind() && oldInfo.GetTzid() == newInfo.GetTzid())
+	check("DTEND", oldInfo.GetEndDate() == newInfo.GetEndDate())
+	check("STATUS", oldInfo.GetStatus() == newInfo.GetStatus())
+	check("CATEGORIES", slices.Equal(oldInfo.GetCategories(), newInfo.GetCategories()))
+	check("PRIORITY", oldInfo.GetPriority() == newInfo.GetPriority())
+	check("CLASS", oldInfo.GetClass() == newInfo.GetClass())
+	check("TRANSP", oldInfo.GetTransp() == newInfo.GetTransp())
+	check("GEO", (oldInfo.GetGeo() == nil && newInfo.GetGeo() == nil) ||
+		(oldInfo.GetGeo() != nil && newInfo.GetGeo() != nil && *oldInfo.GetGeo() == *newInfo.GetGeo()))
+	check("ATTACH", slices.Equal(oldInfo.GetAttach(), newInfo.GetAttach()))
+	check("ORGANIZER", oldInfo.GetOrganizer() == newInfo.GetOrganizer() && oldInfo.GetOrganizerCn() == newInfo.GetOrganizerCn())
+	check("ATTENDEE", attendeesToIcal(oldInfo) == attendeesToIcal(newInfo))
+	check("VALARM", alarmsToIcal(oldInfo) == alarmsToIcal(newInfo))
+
+	// recurrence
+	switch {
+	case oldEntry.master != nil && newEntry.master != nil:
+		check("RRULE", oldEntry.master.GetRRule() == newEntry.master.GetRRule())
+		check("EXDATE", slices.Equal(recurrenceDates(oldEntry.master.IterateExDates), recurrenceDates(newEntry.master.IterateExDates)))
+		check("RDATE", slices.Equal(recurrenceDates(oldEntry.master.IterateRDates), recurrenceDates(newEntry.master.IterateRDates)))
+	case oldEntry.child != nil && newEntry.child != nil:
+		check("RECURRENCE-ID", oldEntry.child.IsThisAndFuture() == newEntry.child.IsThisAndFuture())
+	}
+
+	// the unsupported properties, by name
+	oldCustom, newCustom := customPropertyNames(oldInfo), customPropertyNames(newInfo)
+	names := make([]string, 0, len(oldCustom)+len(newCustom))
+	for name := range oldCustom {
+		names = append(names, name)
+	}
+	for name := range newCustom {
+		if _, ok := oldCustom[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check(name, slices.Equal(oldCustom[name], newCustom[name]))
+	}
+	return properties
+}
+
+func attendeesToIcal(info *event.EventInfo) string {
+	var sb strings.Builder
+	attendees := info.GetAttendee()
+	for i := range attendees {
+		attendees[i].ToIcal(func(s string) { sb.WriteString(s) })
+	}
+	return sb.String()
+}
+
+func alarmsToIcal(info *event.EventInfo) string {
+	var sb strings.Builder
+	alarms := info.GetAlarm()
+	for i := range alarms {
+		alarms[i].ToIcal(func(s string) {
+			// the alarms without UID get a random one when parsed
+			if !strings.HasPrefix(s, "UID:") {
+				sb.WriteString(s)
+			}
+		})
+	}
+	return sb.String()
+}
+
+func recurrenceDates(iterate func(func(int64))) []int64 {
+	dates := make([]int64, 0)
+	iterate(func(date int64) {
+		dates = append(dates, date)
+	})
+	slices.Sort(dates)
+	return dates
+}
+
+// Group the custom properties of the event by name, e.g. X-WR-ALARMUID
+func customPropertyNames(info *event.EventInfo) map[string][]string {
+	names := make(map[string][]string)
+	for _, property := range info.GetCustomProperties() {
+		name, _, _ := strings.Cut(property, ":")
+		name, _, _ = strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+		names[name] = append(names[name], property)
+	}
+	return names
+}
@@ -2,6 +2,7 @@ package ical
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -26,9 +27,17 @@ func (e *CustomError) Error() string {
 	var sb strings.Builder
 	sb.WriteString(e.msg)
 	if len(e.args) > 0 {
+		keys := make([]string, 0, len(e.args))
+		for key := range e.args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
 		sb.WriteString(" |")
-		for key, value := range e.args {
-			sb.WriteString(key + ": " + fmt.Sprintf("%v", value))
+		for i, key := range keys {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(" " + key + ": " + fmt.Sprintf("%v", e.args[key]))
 		}
 	}
 	return sb.String()
@@ -45,3 +54,29 @@ func (e *CustomError) GetArgs() []any {
 	}
 	return temp
 }
+
+// Get the underlying error, if any, so that errors.Is and errors.As can see
+// through the custom error
+func (e *CustomError) Unwrap() error {
+	if err, ok := e.args["err"].(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Convert the error into an error diagnostic, at the line it was found at if
+// known
+func (e *CustomError) Diagnostic() Diagnostic {
+	line, _ := e.args["line"].(int)
+	column, _ := e.args["column"].(int)
+	msg := e.msg
+	if err, ok := e.args["err"].(error); ok {
+		msg += ": " + err.Error()
+	}
+	return Diagnostic{
+		Severity: DiagnosticSeverityError,
+		Line:     line,
+		Column:   column,
+		Message:  msg,
+	}
+}
@@ -4,14 +4,16 @@ package event
 type ChildEvent struct {
 	EventInfo
 
-	recurrenceID int64
+	recurrenceID  int64
+	thisAndFuture bool
 }
 
 // Turn a ChildEvent into an UndecidedEvent for modification.
 func (e *ChildEvent) ToUndecidedEvent() UndecidedEvent {
 	return UndecidedEvent{
-		EventInfo:    e.EventInfo,
-		recurrenceID: e.recurrenceID,
+		EventInfo:     e.EventInfo,
+		recurrenceID:  e.recurrenceID,
+		thisAndFuture: e.thisAndFuture,
 	}
 }
 
@@ -19,3 +21,10 @@ func (e *ChildEvent) ToUndecidedEvent() UndecidedEvent {
 func (e *ChildEvent) GetRecurrenceID() int64 {
 	return e.recurrenceID
 }
+
+// Check if the event overrides the following occurrences as well, i.e.
+// RECURRENCE-ID;RANGE=THISANDFUTURE. The following occurrences take its
+// properties, and are moved and resized the same way it is.
+func (e *ChildEvent) IsThisAndFuture() bool {
+	return e.thisAndFuture
+}
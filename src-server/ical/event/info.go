@@ -3,11 +3,43 @@ package event
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 	"towd/src-server/ical/structured"
 	"towd/src-server/ical/utils"
 )
 
+type (
+	EventStatus string
+	EventClass  string
+	EventTransp string
+)
+
+var (
+	EventStatusTentative EventStatus = "TENTATIVE"
+	EventStatusConfirmed EventStatus = "CONFIRMED"
+	EventStatusCancelled EventStatus = "CANCELLED"
+
+	EventClassPublic       EventClass = "PUBLIC"
+	EventClassPrivate      EventClass = "PRIVATE"
+	EventClassConfidential EventClass = "CONFIDENTIAL"
+
+	EventTranspOpaque      EventTransp = "OPAQUE"      // busy
+	EventTranspTransparent EventTransp = "TRANSPARENT" // free
+)
+
+// A geographic position, in degrees (iCalendar GEO)
+type Geo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// A document linked to the event by its URI (iCalendar ATTACH)
+type Attachment struct {
+	URI     string `json:"uri"`
+	FmtType string `json:"fmtType,omitempty"` // media type, e.g. application/pdf
+}
+
 // Purely for reusing the same property in all types of events.
 // - Only getters are available as
 //   - this struct is being used in UndecidedEvent, MasterEvent, and ChildEvent.
@@ -25,11 +57,24 @@ type EventInfo struct {
 	url         string
 	startDate   int64
 	endDate     int64
+	hasDuration bool // DURATION was given instead of DTEND, and is written back
+	tzid        string
+	timezone    *structured.Timezone // the VTIMEZONE defining tzid, if the IANA database doesn't know it
+	dateKind    utils.DateKind       // DATE or FLOATING, the others follow tzid
 	createdAt   int64
 	updatedAt   int64
 
+	status     EventStatus
+	categories []string
+	priority   int // 1 is the highest, 9 the lowest, 0 undefined
+	class      EventClass
+	transp     EventTransp
+	geo        *Geo
+	attach     []Attachment
+
 	attendee         []structured.Attendee
-	organizer        string
+	organizer        string // cal-address, e.g. mailto:john@example.com
+	organizerCn      string
 	alarm            []structured.Alarm
 	sequence         int
 	customProperties []string
@@ -70,7 +115,60 @@ func (e *EventInfo) GetEndDate() int64 {
 	return e.endDate
 }
 
-// Get the event updated date
+// Check if the event's end was given as a DURATION instead of a DTEND
+func (e *EventInfo) HasDuration() bool {
+	return e.hasDuration
+}
+
+// Get the timezone ID the event's dates were written in, empty if UTC
+func (e *EventInfo) GetTzid() string {
+	return e.tzid
+}
+
+// Get the VTIMEZONE defining the event's TZID, nil if the IANA database knows
+// it or if the event doesn't have one
+func (e *EventInfo) GetTimezone() *structured.Timezone {
+	return e.timezone
+}
+
+// Get the location the event's dates are in: the one of its TZID, from its
+// VTIMEZONE or the IANA database. The DATE and floating dates are stored as
+// if they were in UTC, so they recur in UTC, away from any daylight saving
+// time change. Returns false if the TZID can't be resolved.
+func (e *EventInfo) getTimeLocation() (*time.Location, bool) {
+	if e.GetDateKind() != utils.DateKindTzid {
+		return time.UTC, true
+	}
+	if e.timezone != nil {
+		if loc, err := e.timezone.Location(); err == nil {
+			return loc, true
+		}
+	}
+	if loc, err := time.LoadLocation(e.tzid); err == nil {
+		return loc, true
+	}
+	return time.UTC, false
+}
+
+// Get the type of the event's dates, shared by all of them. A TZID is ignored
+// by the DATE and floating dates.
+func (e *EventInfo) GetDateKind() utils.DateKind {
+	switch {
+	case e.dateKind == utils.DateKindDate || e.dateKind == utils.DateKindFloating:
+		return e.dateKind
+	case e.tzid != "":
+		return utils.DateKindTzid
+	default:
+		return utils.DateKindUTC
+	}
+}
+
+// Check if the event lasts whole days, i.e. its dates are DATE values
+func (e *EventInfo) IsWholeDay() bool {
+	return e.dateKind == utils.DateKindDate
+}
+
+// Get the event created date
 func (e *EventInfo) GetCreatedAt() int64 {
 	return e.createdAt
 }
@@ -80,6 +178,41 @@ func (e *EventInfo) GetUpdatedAt() int64 {
 	return e.updatedAt
 }
 
+// Get the event status, empty if undefined
+func (e *EventInfo) GetStatus() EventStatus {
+	return e.status
+}
+
+// Get the event categories
+func (e *EventInfo) GetCategories() []string {
+	return e.categories
+}
+
+// Get the event priority, from 1 (highest) to 9 (lowest), 0 if undefined
+func (e *EventInfo) GetPriority() int {
+	return e.priority
+}
+
+// Get the event access classification, empty if undefined, i.e. PUBLIC
+func (e *EventInfo) GetClass() EventClass {
+	return e.class
+}
+
+// Get the event time transparency, empty if undefined, i.e. OPAQUE
+func (e *EventInfo) GetTransp() EventTransp {
+	return e.transp
+}
+
+// Get the event geographic position, nil if undefined
+func (e *EventInfo) GetGeo() *Geo {
+	return e.geo
+}
+
+// Get the event attachments
+func (e *EventInfo) GetAttach() []Attachment {
+	return e.attach
+}
+
 // Get the event attendees
 func (e *EventInfo) GetAttendee() []structured.Attendee {
 	return e.attendee
@@ -90,6 +223,11 @@ func (e *EventInfo) GetOrganizer() string {
 	return e.organizer
 }
 
+// Get the event organizer's common name
+func (e *EventInfo) GetOrganizerCn() string {
+	return e.organizerCn
+}
+
 // Get the event alarms
 func (e *EventInfo) GetAlarm() []structured.Alarm {
 	return e.alarm
@@ -115,6 +253,8 @@ func (e *EventInfo) validate() error {
 		return fmt.Errorf("start date must be before end date")
 	case e.sequence < 0:
 		return fmt.Errorf("sequence must be non-negative")
+	case e.priority < 0 || e.priority > 9:
+		return fmt.Errorf("priority must be between 0 and 9")
 	default:
 		return nil
 	}
@@ -136,20 +276,55 @@ func (e *EventInfo) toIcal(writer func(string)) error {
 
 	// basic properties
 	writer("UID:" + e.id + "\n")
-	writer("SUMMARY:" + e.summary + "\n")
+	writer("SUMMARY:" + utils.EscapeText(e.summary) + "\n")
 	if e.description != "" {
-		writer("DESCRIPTION:" + e.description + "\n")
+		writer("DESCRIPTION:" + utils.EscapeText(e.description) + "\n")
 	}
 	if e.location != "" {
-		writer("LOCATION:" + e.location + "\n")
+		writer("LOCATION:" + utils.EscapeText(e.location) + "\n")
 	}
 	if e.url != "" {
 		writer("URL:" + e.url + "\n")
 	}
+	if e.status != "" {
+		writer("STATUS:" + string(e.status) + "\n")
+	}
+	if len(e.categories) > 0 {
+		categories := make([]string, len(e.categories))
+		for i, category := range e.categories {
+			categories[i] = utils.EscapeText(category)
+		}
+		writer("CATEGORIES:" + strings.Join(categories, ",") + "\n")
+	}
+	if e.priority != 0 {
+		writer("PRIORITY:" + strconv.Itoa(e.priority) + "\n")
+	}
+	if e.class != "" {
+		writer("CLASS:" + string(e.class) + "\n")
+	}
+	if e.transp != "" {
+		writer("TRANSP:" + string(e.transp) + "\n")
+	}
+	if e.geo != nil {
+		writer(fmt.Sprintf("GEO:%s;%s\n",
+			strconv.FormatFloat(e.geo.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(e.geo.Longitude, 'f', -1, 64)))
+	}
+	for _, attachment := range e.attach {
+		var params []utils.Param
+		if attachment.FmtType != "" {
+			params = append(params, utils.Param{Name: "FMTTYPE", Values: []string{attachment.FmtType}})
+		}
+		writer(utils.JoinContentLine("ATTACH", params, attachment.URI) + "\n")
+	}
 
 	// dates
-	writer("DTSTART:" + utils.Unix2Datetime(e.startDate) + "\n")
-	writer("DTEND:" + utils.Unix2Datetime(e.endDate) + "\n")
+	writer(e.formatDatetime("DTSTART", e.startDate) + "\n")
+	if e.hasDuration {
+		writer("DURATION:" + utils.Seconds2Duration(e.endDate-e.startDate) + "\n")
+	} else {
+		writer(e.formatDatetime("DTEND", e.endDate) + "\n")
+	}
 	writer("DTSTAMP:" + time.Now().Format("20060102T150405Z") + "\n")
 	writer("CREATED:" + time.Now().Format("20060102T150405Z") + "\n")
 	if e.updatedAt != 0 {
@@ -164,7 +339,11 @@ func (e *EventInfo) toIcal(writer func(string)) error {
 		}
 	}
 	if e.organizer != "" {
-		writer("ORGANIZER:" + e.organizer + "\n")
+		var params []utils.Param
+		if e.organizerCn != "" {
+			params = append(params, utils.Param{Name: "CN", Values: []string{e.organizerCn}})
+		}
+		writer(utils.JoinContentLine("ORGANIZER", params, e.organizer) + "\n")
 	}
 
 	// miscellaneous
@@ -182,3 +361,15 @@ func (e *EventInfo) toIcal(writer func(string)) error {
 
 	return nil
 }
+
+// Format a date-time property with the type of the event's dates. For example:
+//   - DTSTART;VALUE=DATE:20220101
+//   - DTSTART;TZID=Europe/Paris:20220101T000000
+//   - DTSTART:20220101T000000Z
+func (e *EventInfo) formatDatetime(name string, unixTime int64) string {
+	loc, ok := e.getTimeLocation()
+	if !ok {
+		loc = nil
+	}
+	return utils.FormatDatetime(name, unixTime, e.GetDateKind(), e.tzid, loc)
+}
@@ -3,7 +3,7 @@ package event
 import (
 	"fmt"
 	"log/slog"
-	"strings"
+	"time"
 	"towd/src-server/ical/utils"
 
 	"github.com/xyedo/rrule"
@@ -25,22 +25,37 @@ func (e *MasterEvent) GetRRuleSet() (*rrule.Set, error) {
 		return nil, nil
 	}
 
-	var sb strings.Builder
-	sb.WriteString("DTSTART:" + utils.Unix2Datetime(e.startDate) + "\n")
-	sb.WriteString("RRULE:" + e.rruleString + "\n")
+	// the dates are written in the location of the event, which may come
+	// from a VTIMEZONE the recurrence rule parser doesn't know about
+	loc, _ := e.getTimeLocation()
+	lines := []string{
+		"DTSTART:" + utils.Unix2LocalDatetime(e.startDate, loc),
+		"RRULE:" + e.rruleString,
+	}
 	for _, exdate := range e.exDates {
-		sb.WriteString("EXDATE:" + utils.Unix2Datetime(exdate) + "\n")
+		lines = append(lines, "EXDATE:"+utils.Unix2LocalDatetime(exdate, loc))
 	}
 	for _, rdate := range e.rDates {
-		sb.WriteString("RDATE:" + utils.Unix2Datetime(rdate) + "\n")
+		lines = append(lines, "RDATE:"+utils.Unix2LocalDatetime(rdate, loc))
 	}
-	rruleSet, err := rrule.StrToRRuleSet(sb.String())
+	rruleSet, err := rrule.StrSliceToRRuleSetInLoc(lines, loc)
 	if err != nil {
 		return nil, fmt.Errorf("(*MasterEvent).GetRRuleSet: %w", err)
 	}
 	return rruleSet, nil
 }
 
+// Get the recurrence rule, e.g. FREQ=WEEKLY;COUNT=4, empty if the event
+// doesn't recur
+func (e *MasterEvent) GetRRule() string {
+	return e.rruleString
+}
+
+// Check if the event has a recurrence rule
+func (e *MasterEvent) IsRecurring() bool {
+	return e.rruleString != ""
+}
+
 // Iterate over the exdates and apply a function to each
 func (e *MasterEvent) IterateExDates(fn func(int64)) {
 	for _, exDate := range e.exDates {
@@ -64,22 +79,16 @@ func (e *MasterEvent) AddChildEvent(childEvent *ChildEvent) error {
 	if rruleSet == nil {
 		return fmt.Errorf("(*MasterEvent).AddChildEvent: master event does not have a rrule, child event cannot be added")
 	}
-	allDates := func() map[int64]struct{} {
-		allDates := make(map[int64]struct{})
-		for _, date := range rruleSet.All() {
-			allDates[date.Unix()] = struct{}{}
-		}
-		return allDates
-	}()
-
-	if _, ok := allDates[childEvent.GetRecurrenceID()]; !ok {
-		return fmt.Errorf("MasterEvent.AddChildEvent: rec-id (%d) not in rrule (%s)", childEvent.GetRecurrenceID(), func() string {
-			var parsedRRuleSet []string
-			for date := range allDates {
-				parsedRRuleSet = append(parsedRRuleSet, fmt.Sprintf("%d", date))
-			}
-			return strings.Join(parsedRRuleSet, ",")
-		}())
+	// the recurrence ID may be an EXDATE too, e.g. Outlook excludes the moved
+	// occurrences and Google the cancelled ones
+	datesSet := &rrule.Set{}
+	datesSet.RRule(rruleSet.GetRRule())
+	datesSet.SetRDates(rruleSet.GetRDate())
+	// only walk the recurrence rule around the recurrence ID, the rule may
+	// have no end
+	recurrenceID := time.Unix(childEvent.GetRecurrenceID(), 0)
+	if date := rruleSetFrom(datesSet, recurrenceID).After(recurrenceID, true); date.Unix() != recurrenceID.Unix() {
+		return fmt.Errorf("(*MasterEvent).AddChildEvent: rec-id (%d) not in rrule (%s)", childEvent.GetRecurrenceID(), e.rruleString)
 	}
 
 	e.childEvents = append(e.childEvents, childEvent)
@@ -89,7 +98,9 @@ func (e *MasterEvent) AddChildEvent(childEvent *ChildEvent) error {
 // Iterate over the child events and apply a function to each
 func (e *MasterEvent) IterateChildEvents(fn func(id string, event *ChildEvent) error) error {
 	for _, childEvent := range e.childEvents {
-		return fn(childEvent.GetID(), childEvent)
+		if err := fn(childEvent.GetID(), childEvent); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -119,20 +130,25 @@ func (e *MasterEvent) ToIcal(writer func(string)) {
 		writer("RRULE:" + e.rruleString + "\n")
 	}
 	for _, exdate := range e.exDates {
-		writer("EXDATE:" + utils.Unix2Datetime(exdate) + "\n")
+		writer(e.formatDatetime("EXDATE", exdate) + "\n")
 	}
 	for _, rdate := range e.rDates {
-		writer("RDATE:" + utils.Unix2Datetime(rdate) + "\n")
+		writer(e.formatDatetime("RDATE", rdate) + "\n")
 	}
+	writer("END:VEVENT\n")
 
-	// child events
+	// child events, sharing the UID of the master event
 	for _, childEvent := range e.childEvents {
 		writer("BEGIN:VEVENT\n")
 		if err := childEvent.EventInfo.toIcal(writer); err != nil {
 			slog.Warn("MasterEvent.ToIcal: can't write basic properties for child event", "error", err)
 			return
 		}
-		writer("RECURRENCE-ID:" + utils.Unix2Datetime(childEvent.recurrenceID) + "\n")
+		if childEvent.thisAndFuture {
+			writer(childEvent.formatDatetime("RECURRENCE-ID;RANGE=THISANDFUTURE", childEvent.recurrenceID) + "\n")
+		} else {
+			writer(childEvent.formatDatetime("RECURRENCE-ID", childEvent.recurrenceID) + "\n")
+		}
 		writer("END:VEVENT\n")
 	}
 }
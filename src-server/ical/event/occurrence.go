@@ -0,0 +1,274 @@
+package event
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xyedo/rrule"
+)
+
+// A single occurrence of an event. All dates are unix timestamps in UTC.
+type Occurrence struct {
+	// The date the recurrence rule gives to the occurrence, which identifies
+	// it even when a child event moved it
+	RecurrenceID int64
+	StartDate    int64
+	EndDate      int64
+	// The information of the master event, or of the child event overriding
+	// the occurrence
+	Info *EventInfo
+}
+
+// Iterate lazily over the occurrences overlapping the [from, to) window,
+// sorted by start date. EXDATEs and RDATEs are applied, and the occurrences
+// overridden by a child event are replaced by it, wherever it moved them to.
+// A RANGE=THISANDFUTURE child event overrides the following occurrences too,
+// until the next one. Example usage:
+//
+//	next, err := masterEvent.Occurrences(from, to)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for occurrence, ok := next(); ok; occurrence, ok = next() {
+//	    fmt.Println(occurrence.StartDate)
+//	}
+func (e *MasterEvent) Occurrences(from time.Time, to time.Time) (func() (Occurrence, bool), error) {
+	fromUnix, toUnix := from.Unix(), to.Unix()
+	duration := max(e.endDate-e.startDate, 0)
+	overlaps := func(startDate int64, endDate int64) bool {
+		if endDate <= startDate {
+			return startDate >= fromUnix && startDate < toUnix
+		}
+		return startDate < toUnix && endDate > fromUnix
+	}
+
+	rruleSet, err := e.GetRRuleSet()
+	if err != nil {
+		return nil, fmt.Errorf("(*MasterEvent).Occurrences: %w", err)
+	}
+
+	// the single child events can move their occurrence anywhere, so they're
+	// checked against the window on their own. The RANGE=THISANDFUTURE ones
+	// are applied to the dates of the recurrence rule instead.
+	overridden := make(map[int64]struct{}, len(e.childEvents))
+	pending := make(occurrenceHeap, 0)
+	ranges := make([]*ChildEvent, 0)
+	for _, childEvent := range e.childEvents {
+		if childEvent.thisAndFuture {
+			ranges = append(ranges, childEvent)
+			continue
+		}
+		overridden[childEvent.recurrenceID] = struct{}{}
+		startDate, endDate := childEvent.startDate, childEvent.endDate
+		if endDate == 0 {
+			endDate = startDate + duration
+		}
+		if overlaps(startDate, endDate) {
+			pending = append(pending, Occurrence{
+				RecurrenceID: childEvent.recurrenceID,
+				StartDate:    startDate,
+				EndDate:      endDate,
+				Info:         &childEvent.EventInfo,
+			})
+		}
+	}
+	heap.Init(&pending)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].recurrenceID < ranges[j].recurrenceID
+	})
+
+	// a range can move its occurrences before the date the rule gives them,
+	// the rule is walked that much further. It can also move them, or make
+	// them last, after it: the rule is walked from that much earlier.
+	earliestShift, latestEnd := int64(0), duration
+	for _, childEvent := range ranges {
+		shift := childEvent.startDate - childEvent.recurrenceID
+		earliestShift = min(earliestShift, shift)
+		if childEvent.endDate != 0 {
+			latestEnd = max(latestEnd, shift+childEvent.endDate-childEvent.startDate)
+		} else {
+			latestEnd = max(latestEnd, shift+duration)
+		}
+	}
+	nextDate := func() func() (time.Time, bool) {
+		if rruleSet != nil {
+			// the dates before the window are skipped without being walked
+			return rruleSetFrom(rruleSet, time.Unix(fromUnix-latestEnd, 0)).Iterator()
+		}
+		// a non-recurring event only occurs once
+		isDone := false
+		return func() (time.Time, bool) {
+			if isDone {
+				return time.Time{}, false
+			}
+			isDone = true
+			return time.Unix(e.startDate, 0), true
+		}
+	}()
+	toOccurrence := func(date int64) Occurrence {
+		// the latest range starting at or before the date, if any
+		index := sort.Search(len(ranges), func(i int) bool {
+			return ranges[i].recurrenceID > date
+		}) - 1
+		if index < 0 {
+			return Occurrence{
+				RecurrenceID: date,
+				StartDate:    date,
+				EndDate:      date + duration,
+				Info:         &e.EventInfo,
+			}
+		}
+		childEvent := ranges[index]
+		startDate := date + childEvent.startDate - childEvent.recurrenceID
+		endDate := startDate + duration
+		if childEvent.endDate != 0 {
+			endDate = startDate + childEvent.endDate - childEvent.startDate
+		}
+		return Occurrence{
+			RecurrenceID: date,
+			StartDate:    startDate,
+			EndDate:      endDate,
+			Info:         &childEvent.EventInfo,
+		}
+	}
+
+	// the dates of the recurrence rule come sorted, so the iteration stops at
+	// the first one that can't start within the window anymore
+	date, hasDate := nextDate()
+	advance := func() {
+		date, hasDate = nextDate()
+		hasDate = hasDate && date.Unix()+earliestShift < toUnix
+	}
+	hasDate = hasDate && date.Unix()+earliestShift < toUnix
+
+	return func() (Occurrence, bool) {
+		// nothing coming from the rule can start before its next date
+		// shifted by the earliest range, so the pending occurrences starting
+		// before that are final
+		for hasDate && (len(pending) == 0 || date.Unix()+earliestShift < pending[0].StartDate) {
+			recurrenceID := date.Unix()
+			advance()
+			if _, ok := overridden[recurrenceID]; ok {
+				continue
+			}
+			if occurrence := toOccurrence(recurrenceID); overlaps(occurrence.StartDate, occurrence.EndDate) {
+				heap.Push(&pending, occurrence)
+			}
+		}
+		if len(pending) == 0 {
+			return Occurrence{}, false
+		}
+		return heap.Pop(&pending).(Occurrence), true
+	}, nil
+}
+
+// The occurrences waiting to be iterated over, the earliest first
+type occurrenceHeap []Occurrence
+
+func (h occurrenceHeap) Len() int           { return len(h) }
+func (h occurrenceHeap) Less(i, j int) bool { return h[i].StartDate < h[j].StartDate }
+func (h occurrenceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *occurrenceHeap) Push(x any)        { *h = append(*h, x.(Occurrence)) }
+func (h *occurrenceHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Get a recurrence set giving the same dates as the given one from the start of
+// the period, e.g. the week, holding the date on. The rule is moved forward by
+// whole intervals, the first one starting at the beginning of its period, with
+// the values its DTSTART implied made explicit. Iterating over the set then
+// costs as much for an old series as for a new one. The set is returned as is
+// if it can't be moved: the COUNT rules have to be walked from their DTSTART,
+// and the sub-daily ones are rare enough not to bother.
+func rruleSetFrom(rruleSet *rrule.Set, date time.Time) *rrule.Set {
+	rule := rruleSet.GetRRule()
+	if rule == nil || rule.OrigOptions.Count != 0 {
+		return rruleSet
+	}
+	opts := rule.OrigOptions
+	dtstart := rule.GetDTStart()
+	loc := dtstart.Location()
+	date = date.In(loc)
+	interval := max(opts.Interval, 1)
+	// the number of days between two dates, regardless of DST
+	daysBetween := func(a time.Time, b time.Time) int {
+		a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+		b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+		return int(b.Sub(a).Hours() / 24)
+	}
+
+	var periods int
+	var periodStart func(n int) time.Time
+	switch opts.Freq {
+	case rrule.YEARLY:
+		periods = date.Year() - dtstart.Year()
+		periodStart = func(n int) time.Time {
+			return time.Date(dtstart.Year()+n, time.January, 1, 0, 0, 0, 0, loc)
+		}
+	case rrule.MONTHLY:
+		periods = (date.Year()-dtstart.Year())*12 + int(date.Month()-dtstart.Month())
+		periodStart = func(n int) time.Time {
+			return time.Date(dtstart.Year(), dtstart.Month()+time.Month(n), 1, 0, 0, 0, 0, loc)
+		}
+	case rrule.WEEKLY:
+		// the weeks begin on WKST, Monday being 0
+		weekStartOffset := (int(dtstart.Weekday()) + 6 - opts.Wkst.Day() + 7) % 7
+		periods = (daysBetween(dtstart, date) + weekStartOffset) / 7
+		periodStart = func(n int) time.Time {
+			return time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()-weekStartOffset+7*n, 0, 0, 0, 0, loc)
+		}
+	case rrule.DAILY:
+		periods = daysBetween(dtstart, date)
+		periodStart = func(n int) time.Time {
+			return time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()+n, 0, 0, 0, 0, loc)
+		}
+	default:
+		return rruleSet
+	}
+	// the first period may be partial, e.g. a week starting on DTSTART
+	periods = periods / interval * interval
+	if periods <= 0 {
+		return rruleSet
+	}
+
+	// the same defaults as rrule.NewRRule, taken from the original DTSTART
+	if len(opts.Byweekno) == 0 && len(opts.Byyearday) == 0 && len(opts.Bymonthday) == 0 &&
+		len(opts.Byweekday) == 0 && len(opts.Byeaster) == 0 {
+		switch opts.Freq {
+		case rrule.YEARLY:
+			if len(opts.Bymonth) == 0 {
+				opts.Bymonth = []int{int(dtstart.Month())}
+			}
+			opts.Bymonthday = []int{dtstart.Day()}
+		case rrule.MONTHLY:
+			opts.Bymonthday = []int{dtstart.Day()}
+		case rrule.WEEKLY:
+			opts.Byweekday = []rrule.Weekday{[]rrule.Weekday{rrule.SU, rrule.MO, rrule.TU, rrule.WE, rrule.TH, rrule.FR, rrule.SA}[dtstart.Weekday()]}
+		}
+	}
+	if len(opts.Byhour) == 0 {
+		opts.Byhour = []int{dtstart.Hour()}
+	}
+	if len(opts.Byminute) == 0 {
+		opts.Byminute = []int{dtstart.Minute()}
+	}
+	if len(opts.Bysecond) == 0 {
+		opts.Bysecond = []int{dtstart.Second()}
+	}
+	opts.Dtstart = periodStart(periods)
+	movedRule, err := rrule.NewRRule(opts)
+	if err != nil {
+		return rruleSet
+	}
+
+	movedSet := &rrule.Set{}
+	movedSet.RRule(movedRule)
+	movedSet.SetRDates(rruleSet.GetRDate())
+	movedSet.SetExDates(rruleSet.GetExDate())
+	return movedSet
+}
@@ -0,0 +1,371 @@
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"towd/src-server/ical"
+)
+
+// Real-world exception patterns, as exported by Google Calendar and Outlook,
+// and the occurrences they expand to. The occurrences are written as
+// "start - end summary [status]" in UTC.
+func TestOccurrences(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		from        time.Time
+		to          time.Time
+		occurrences []string
+	}{
+		{
+			name: "Google: a single instance moved",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Google Inc//Google Calendar 70.9054//EN
+VERSION:2.0
+CALSCALE:GREGORIAN
+METHOD:PUBLISH
+X-WR-CALNAME:Team
+X-WR-TIMEZONE:America/New_York
+BEGIN:VTIMEZONE
+TZID:America/New_York
+X-LIC-LOCATION:America/New_York
+BEGIN:DAYLIGHT
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+TZNAME:EDT
+DTSTART:19700308T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+TZNAME:EST
+DTSTART:19701101T020000
+RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+DTSTART;TZID=America/New_York:20250303T100000
+DTEND;TZID=America/New_York:20250303T103000
+RRULE:FREQ=WEEKLY;BYDAY=MO
+DTSTAMP:20250401T000000Z
+UID:5f0c1a2b3c4d5e6f7g8h9i0j@google.com
+CREATED:20250301T000000Z
+LAST-MODIFIED:20250305T000000Z
+SEQUENCE:0
+STATUS:CONFIRMED
+SUMMARY:Weekly sync
+TRANSP:OPAQUE
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;TZID=America/New_York:20250318T150000
+DTEND;TZID=America/New_York:20250318T160000
+DTSTAMP:20250401T000000Z
+UID:5f0c1a2b3c4d5e6f7g8h9i0j@google.com
+RECURRENCE-ID;TZID=America/New_York:20250317T100000
+CREATED:20250301T000000Z
+LAST-MODIFIED:20250310T000000Z
+SEQUENCE:1
+STATUS:CONFIRMED
+SUMMARY:Weekly sync (moved to Tuesday)
+TRANSP:OPAQUE
+END:VEVENT
+END:VCALENDAR
+`,
+			from: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				// the DST change of March 9 keeps the local time
+				"2025-03-03 15:00 - 15:30 Weekly sync [CONFIRMED]",
+				"2025-03-10 14:00 - 14:30 Weekly sync [CONFIRMED]",
+				"2025-03-18 19:00 - 20:00 Weekly sync (moved to Tuesday) [CONFIRMED]",
+				"2025-03-24 14:00 - 14:30 Weekly sync [CONFIRMED]",
+			},
+		},
+		{
+			name: "Google: a cancelled instance and a deleted one",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Google Inc//Google Calendar 70.9054//EN
+VERSION:2.0
+CALSCALE:GREGORIAN
+BEGIN:VEVENT
+DTSTART:20250106T090000Z
+DTEND:20250106T093000Z
+RRULE:FREQ=WEEKLY;BYDAY=MO
+EXDATE:20250113T090000Z
+EXDATE:20250127T090000Z
+DTSTAMP:20250201T000000Z
+UID:0a1b2c3d4e5f@google.com
+SEQUENCE:0
+STATUS:CONFIRMED
+SUMMARY:Standup
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20250113T090000Z
+DTEND:20250113T093000Z
+DTSTAMP:20250201T000000Z
+UID:0a1b2c3d4e5f@google.com
+RECURRENCE-ID:20250113T090000Z
+SEQUENCE:1
+STATUS:CANCELLED
+SUMMARY:Standup
+END:VEVENT
+END:VCALENDAR
+`,
+			from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 2, 4, 0, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				"2025-01-06 09:00 - 09:30 Standup [CONFIRMED]",
+				// the cancelled instance stays, to be shown as such
+				"2025-01-13 09:00 - 09:30 Standup [CANCELLED]",
+				"2025-01-20 09:00 - 09:30 Standup [CONFIRMED]",
+				"2025-02-03 09:00 - 09:30 Standup [CONFIRMED]",
+			},
+		},
+		{
+			name: "Outlook: several instances changed",
+			input: `BEGIN:VCALENDAR
+METHOD:PUBLISH
+PRODID:Microsoft Exchange Server 2010
+VERSION:2.0
+X-WR-CALNAME:Calendar
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+RRULE:FREQ=DAILY;UNTIL=20250110T080000Z;INTERVAL=1;BYDAY=MO,TU,WE,TH,FR;WKST=MO
+EXDATE;TZID=W. Europe Standard Time:20250108T090000
+UID:040000008200E00074C5B7101A82E00800000000D0A1B2C3D4E5DB01000000000000000010000000
+SUMMARY:Daily
+DTSTART;TZID=W. Europe Standard Time:20250106T090000
+DTEND;TZID=W. Europe Standard Time:20250106T091500
+CLASS:PUBLIC
+PRIORITY:5
+DTSTAMP:20250110T000000Z
+TRANSP:OPAQUE
+STATUS:CONFIRMED
+SEQUENCE:0
+LOCATION:Teams
+X-MICROSOFT-CDO-BUSYSTATUS:BUSY
+END:VEVENT
+BEGIN:VEVENT
+UID:040000008200E00074C5B7101A82E00800000000D0A1B2C3D4E5DB01000000000000000010000000
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250107T090000
+SUMMARY:Daily (demo)
+DTSTART;TZID=W. Europe Standard Time:20250107T140000
+DTEND;TZID=W. Europe Standard Time:20250107T150000
+CLASS:PUBLIC
+PRIORITY:5
+DTSTAMP:20250110T000000Z
+TRANSP:OPAQUE
+STATUS:CONFIRMED
+SEQUENCE:1
+LOCATION:Room 4
+X-MICROSOFT-CDO-BUSYSTATUS:BUSY
+END:VEVENT
+BEGIN:VEVENT
+UID:040000008200E00074C5B7101A82E00800000000D0A1B2C3D4E5DB01000000000000000010000000
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250109T090000
+SUMMARY:Daily (moved after Friday's)
+DTSTART;TZID=W. Europe Standard Time:20250110T113000
+DTEND;TZID=W. Europe Standard Time:20250110T114500
+DTSTAMP:20250110T000000Z
+STATUS:CONFIRMED
+SEQUENCE:1
+END:VEVENT
+BEGIN:VEVENT
+UID:040000008200E00074C5B7101A82E00800000000D0A1B2C3D4E5DB01000000000000000010000000
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250110T090000
+SUMMARY:Daily (short)
+DTSTART;TZID=W. Europe Standard Time:20250110T090000
+DTEND;TZID=W. Europe Standard Time:20250110T090500
+DTSTAMP:20250110T000000Z
+STATUS:TENTATIVE
+SEQUENCE:1
+END:VEVENT
+END:VCALENDAR
+`,
+			from: time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				"2025-01-06 08:00 - 08:15 Daily [CONFIRMED]",
+				"2025-01-07 13:00 - 14:00 Daily (demo) [CONFIRMED]",
+				"2025-01-10 08:00 - 08:05 Daily (short) [TENTATIVE]",
+				"2025-01-10 10:30 - 10:45 Daily (moved after Friday's) [CONFIRMED]",
+			},
+		},
+		{
+			name: "Outlook: instances changed after the end of summer time",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN
+VERSION:2.0
+METHOD:PUBLISH
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+RRULE:FREQ=DAILY;UNTIL=20251031T090000Z;INTERVAL=1;BYDAY=MO,TU,WE,TH,FR;WKST=MO
+EXDATE;TZID=W. Europe Standard Time:20251029T100000
+UID:040000008200E00074C5B7101A82E00800000000F1E2D3C4B5A6DC01000000000000000010000000
+SUMMARY:Sync
+DTSTART;TZID=W. Europe Standard Time:20251020T100000
+DTEND;TZID=W. Europe Standard Time:20251020T103000
+DTSTAMP:20251001T000000Z
+STATUS:CONFIRMED
+SEQUENCE:0
+END:VEVENT
+BEGIN:VEVENT
+UID:040000008200E00074C5B7101A82E00800000000F1E2D3C4B5A6DC01000000000000000010000000
+RECURRENCE-ID;TZID=W. Europe Standard Time:20251030T100000
+SUMMARY:Sync (afternoon)
+DTSTART;TZID=W. Europe Standard Time:20251030T150000
+DTEND;TZID=W. Europe Standard Time:20251030T153000
+DTSTAMP:20251001T000000Z
+STATUS:CONFIRMED
+SEQUENCE:1
+END:VEVENT
+END:VCALENDAR
+`,
+			from: time.Date(2025, 10, 23, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				"2025-10-23 08:00 - 08:30 Sync [CONFIRMED]",
+				"2025-10-24 08:00 - 08:30 Sync [CONFIRMED]",
+				"2025-10-27 09:00 - 09:30 Sync [CONFIRMED]",
+				"2025-10-28 09:00 - 09:30 Sync [CONFIRMED]",
+				"2025-10-30 14:00 - 14:30 Sync (afternoon) [CONFIRMED]",
+				"2025-10-31 09:00 - 09:30 Sync [CONFIRMED]",
+			},
+		},
+		{
+			name: "RANGE=THISANDFUTURE splits",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Ranges//EN
+VERSION:2.0
+BEGIN:VEVENT
+UID:retro@example.com
+DTSTART:20250106T160000Z
+DTEND:20250106T170000Z
+RRULE:FREQ=WEEKLY;BYDAY=MO
+SUMMARY:Retro
+END:VEVENT
+BEGIN:VEVENT
+UID:retro@example.com
+RECURRENCE-ID;RANGE=THISANDFUTURE:20250120T160000Z
+DTSTART:20250121T150000Z
+DTEND:20250121T163000Z
+SUMMARY:Retro (Tuesdays)
+END:VEVENT
+BEGIN:VEVENT
+UID:retro@example.com
+RECURRENCE-ID:20250127T160000Z
+DTSTART:20250129T150000Z
+DTEND:20250129T160000Z
+SUMMARY:Retro (Wednesday once)
+END:VEVENT
+BEGIN:VEVENT
+UID:retro@example.com
+RECURRENCE-ID;RANGE=THISANDFUTURE:20250210T160000Z
+DTSTART:20250210T080000Z
+DTEND:20250210T090000Z
+SUMMARY:Retro (mornings)
+END:VEVENT
+END:VCALENDAR
+`,
+			from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 2, 18, 0, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				"2025-01-06 16:00 - 17:00 Retro []",
+				"2025-01-13 16:00 - 17:00 Retro []",
+				"2025-01-21 15:00 - 16:30 Retro (Tuesdays) []",
+				"2025-01-29 15:00 - 16:00 Retro (Wednesday once) []",
+				"2025-02-04 15:00 - 16:30 Retro (Tuesdays) []",
+				"2025-02-10 08:00 - 09:00 Retro (mornings) []",
+				"2025-02-17 08:00 - 09:00 Retro (mornings) []",
+			},
+		},
+		{
+			name: "RANGE=THISANDFUTURE years after DTSTART",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Ranges//EN
+VERSION:2.0
+BEGIN:VEVENT
+UID:review@example.com
+DTSTART:20200106T160000Z
+DTEND:20200106T170000Z
+RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO
+SUMMARY:Review
+END:VEVENT
+BEGIN:VEVENT
+UID:review@example.com
+RECURRENCE-ID;RANGE=THISANDFUTURE:20220103T160000Z
+DTSTART:20220103T130000Z
+DTEND:20220103T140000Z
+SUMMARY:Review (early)
+END:VEVENT
+END:VCALENDAR
+`,
+			// the window ends as the next occurrence starts, which is left out
+			from: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2030, 2, 4, 13, 0, 0, 0, time.UTC),
+			occurrences: []string{
+				"2030-01-07 13:00 - 14:00 Review (early) []",
+				"2030-01-21 13:00 - 14:00 Review (early) []",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := strings.ReplaceAll(tt.input, "\n", "\r\n")
+			cal, diagnostics, customErr := ical.Parse(context.Background(), strings.NewReader(input), ical.ParseOptions{Strict: true})
+			if customErr != nil {
+				t.Fatalf("Parse: %s", customErr)
+			}
+			if errorCount := ical.CountDiagnostics(diagnostics, ical.DiagnosticSeverityError); errorCount > 0 {
+				t.Fatalf("Parse: %d errors: %v", errorCount, diagnostics)
+			}
+
+			occurrences := make([]string, 0)
+			next := cal.ExpandBetween(tt.from, tt.to)
+			for occurrence, ok := next(); ok; occurrence, ok = next() {
+				occurrences = append(occurrences, fmt.Sprintf("%s - %s %s [%s]",
+					time.Unix(occurrence.StartDate, 0).UTC().Format("2006-01-02 15:04"),
+					time.Unix(occurrence.EndDate, 0).UTC().Format("15:04"),
+					occurrence.Info.GetSummary(),
+					occurrence.Info.GetStatus(),
+				))
+			}
+			if !slices.Equal(occurrences, tt.occurrences) {
+				t.Errorf("occurrences:\n%s\nwant:\n%s", strings.Join(occurrences, "\n"), strings.Join(tt.occurrences, "\n"))
+			}
+		})
+	}
+}
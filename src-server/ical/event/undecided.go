@@ -1,6 +1,7 @@
 package event
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -15,10 +16,18 @@ import (
 type UndecidedEvent struct {
 	EventInfo
 
+	// the DURATION, turned into the end date once the start date is known
+	duration int64
+
 	rruleString  string
 	exDate       []int64
 	rDate        []int64
 	recurrenceID int64
+	// RECURRENCE-ID;RANGE=THISANDFUTURE, the child event overrides the
+	// following occurrences as well
+	thisAndFuture bool
+
+	tzidResolver utils.TzidResolver
 }
 
 // Create a new undecided event with new UID
@@ -73,6 +82,42 @@ func (e *UndecidedEvent) SetEndDate(endDate int64) *UndecidedEvent {
 	return e
 }
 
+// Set the event duration in seconds instead of its end date. The end date is
+// inferred from it when deciding the event type, and DURATION is written
+// instead of DTEND.
+func (e *UndecidedEvent) SetDuration(duration int64) *UndecidedEvent {
+	e.duration = duration
+	e.hasDuration = true
+	e.endDate = 0
+	return e
+}
+
+// Set the timezone ID the event's dates should be written in
+func (e *UndecidedEvent) SetTzid(tzid string) *UndecidedEvent {
+	e.tzid = tzid
+	return e
+}
+
+// Set the VTIMEZONE defining the event's TZID, when the IANA database doesn't
+// know it, e.g. Outlook's "W. Europe Standard Time"
+func (e *UndecidedEvent) SetTimezone(timezone *structured.Timezone) *UndecidedEvent {
+	e.timezone = timezone
+	return e
+}
+
+// Set the type of the event's dates, e.g. DATE for a whole-day event
+func (e *UndecidedEvent) SetDateKind(kind utils.DateKind) *UndecidedEvent {
+	e.dateKind = kind
+	return e
+}
+
+// Set the resolver used for TZIDs that aren't in the IANA database, e.g. the
+// VTIMEZONE blocks of the calendar being parsed
+func (e *UndecidedEvent) SetTzidResolver(resolver utils.TzidResolver) *UndecidedEvent {
+	e.tzidResolver = resolver
+	return e
+}
+
 // Set the event created date
 func (e *UndecidedEvent) SetCreatedAt(createdAt int64) *UndecidedEvent {
 	e.createdAt = createdAt
@@ -85,6 +130,48 @@ func (e *UndecidedEvent) SetUpdatedAt(lastModified int64) *UndecidedEvent {
 	return e
 }
 
+// Set the event status
+func (e *UndecidedEvent) SetStatus(status EventStatus) *UndecidedEvent {
+	e.status = status
+	return e
+}
+
+// Set the event categories
+func (e *UndecidedEvent) SetCategories(categories []string) *UndecidedEvent {
+	e.categories = categories
+	return e
+}
+
+// Set the event priority, from 1 (highest) to 9 (lowest), 0 if undefined
+func (e *UndecidedEvent) SetPriority(priority int) *UndecidedEvent {
+	e.priority = priority
+	return e
+}
+
+// Set the event access classification
+func (e *UndecidedEvent) SetClass(class EventClass) *UndecidedEvent {
+	e.class = class
+	return e
+}
+
+// Set the event time transparency
+func (e *UndecidedEvent) SetTransp(transp EventTransp) *UndecidedEvent {
+	e.transp = transp
+	return e
+}
+
+// Set the event geographic position, nil to unset it
+func (e *UndecidedEvent) SetGeo(geo *Geo) *UndecidedEvent {
+	e.geo = geo
+	return e
+}
+
+// Add an attachment to the event
+func (e *UndecidedEvent) AddAttach(attachment Attachment) *UndecidedEvent {
+	e.attach = append(e.attach, attachment)
+	return e
+}
+
 // Set the event attendees
 func (e *UndecidedEvent) SetAttendee(attendee []structured.Attendee) *UndecidedEvent {
 	e.attendee = attendee
@@ -103,6 +190,12 @@ func (e *UndecidedEvent) SetOrganizer(organizer string) *UndecidedEvent {
 	return e
 }
 
+// Set the event organizer's common name
+func (e *UndecidedEvent) SetOrganizerCn(organizerCn string) *UndecidedEvent {
+	e.organizerCn = organizerCn
+	return e
+}
+
 // Set the event alarms
 func (e *UndecidedEvent) SetAlarm(alarm []structured.Alarm) *UndecidedEvent {
 	e.alarm = alarm
@@ -156,6 +249,12 @@ func (e *UndecidedEvent) SetRecurrenceID(recurrenceID int64) *UndecidedEvent {
 	return e
 }
 
+// Make the recurrence ID override the following occurrences as well
+func (e *UndecidedEvent) SetThisAndFuture(thisAndFuture bool) *UndecidedEvent {
+	e.thisAndFuture = thisAndFuture
+	return e
+}
+
 // Add an iCalendar property to the event.
 // Unhandled properties will be stored in the customProperties array.
 func (e *UndecidedEvent) AddIcalProperty(property string) error {
@@ -175,13 +274,40 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 		e.attendee = append(e.attendee, attendee)
 		return nil
 	case strings.HasPrefix(property, "ORGANIZER"):
-		e.organizer = strings.TrimPrefix(property, "ORGANIZER:")
+		_, params, calAddress, err := utils.SplitContentLine(property)
+		if err != nil {
+			return fmt.Errorf("invalid ORGANIZER: %w", err)
+		}
+		e.organizer = strings.TrimSpace(calAddress)
+		for _, param := range params {
+			if param.Name == "CN" {
+				e.organizerCn = strings.Join(param.Values, ",")
+			}
+		}
 		return nil
 	case strings.HasPrefix(property, "ATTACH"):
-		e.customProperties = append(e.customProperties, property)
+		_, params, value, err := utils.SplitContentLine(property)
+		if err != nil {
+			return fmt.Errorf("invalid ATTACH: %w", err)
+		}
+		attachment := Attachment{URI: strings.TrimSpace(value)}
+		for _, param := range params {
+			switch param.Name {
+			case "VALUE", "ENCODING":
+				// inline binary content is kept as it is, it isn't a URI
+				e.customProperties = append(e.customProperties, property)
+				return nil
+			case "FMTTYPE":
+				attachment.FmtType = strings.Join(param.Values, ",")
+			}
+		}
+		if _, err := url.Parse(attachment.URI); err != nil || attachment.URI == "" {
+			return fmt.Errorf("invalid ATTACH")
+		}
+		e.attach = append(e.attach, attachment)
 		return nil
 	case strings.HasPrefix(property, "DTSTART"):
-		parsedDate, err := utils.Datetime2Unix(property)
+		parsedDate, kind, err := utils.ParseDatetime(property, e.tzidResolver)
 		if err != nil {
 			return err
 		}
@@ -189,23 +315,48 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 			return fmt.Errorf("DTSTART must be before DTEND")
 		}
 		e.startDate = parsedDate
+		e.dateKind = kind
+		e.tzid = ""
+		if kind == utils.DateKindTzid {
+			e.tzid = utils.GetParam(property, "TZID")
+		}
 		return nil
 	case strings.HasPrefix(property, "DTEND"):
-		parsedDate, err := utils.Datetime2Unix(property)
+		parsedDate, err := utils.Datetime2Unix(property, e.tzidResolver)
 		if err != nil {
 			return err
 		}
 		if e.startDate != 0 && parsedDate < e.startDate {
 			return fmt.Errorf("DTEND must be after DTSTART")
 		}
+		if e.hasDuration {
+			return fmt.Errorf("DTEND can't be set along with DURATION")
+		}
 		e.endDate = parsedDate
 		return nil
+	case strings.HasPrefix(property, "DURATION"):
+		_, _, value, err := utils.SplitContentLine(property)
+		if err != nil {
+			return err
+		}
+		duration, err := utils.Duration2Seconds(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		if duration < 0 {
+			return fmt.Errorf("DURATION must be positive")
+		}
+		if e.endDate != 0 {
+			return fmt.Errorf("DURATION can't be set along with DTEND")
+		}
+		e.SetDuration(duration)
+		return nil
 	case strings.HasPrefix(property, "EXDATE"):
-		parsedDate, err := utils.Datetime2Unix(property)
+		parsedDates, _, err := utils.ParseDatetimeList(property, e.tzidResolver)
 		if err != nil {
 			return err
 		}
-		e.exDate = append(e.exDate, parsedDate)
+		e.exDate = append(e.exDate, parsedDates...)
 		return nil
 	case strings.HasPrefix(property, "DTSTAMP"):
 		return nil
@@ -224,18 +375,21 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 		e.updatedAt = parsedDate
 		return nil
 	case strings.HasPrefix(property, "RDATE"):
-		parsedDate, err := utils.Datetime2Unix(property)
+		parsedDates, _, err := utils.ParseDatetimeList(property, e.tzidResolver)
 		if err != nil {
 			return err
 		}
-		e.rDate = append(e.rDate, parsedDate)
+		e.rDate = append(e.rDate, parsedDates...)
 		return nil
 	case strings.HasPrefix(property, "RECURRENCE-ID"):
-		parsedDate, err := utils.Datetime2Unix(property)
+		parsedDate, err := utils.Datetime2Unix(property, e.tzidResolver)
 		if err != nil {
 			return err
 		}
 		e.recurrenceID = parsedDate
+		// THISANDPRIOR is deprecated (RFC5545 section 3.2.13), so it
+		// overrides the single occurrence
+		e.thisAndFuture = strings.EqualFold(utils.GetParam(property, "RANGE"), "THISANDFUTURE")
 		return nil
 	}
 
@@ -243,18 +397,19 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 	if len(slice) != 2 {
 		return nil
 	}
-	key := strings.ToUpper(strings.TrimSpace(slice[0]))
+	// parameters such as LANGUAGE or ALTREP are dropped
+	key := strings.ToUpper(strings.TrimSpace(strings.SplitN(slice[0], ";", 2)[0]))
 	val := strings.TrimSpace(slice[1])
 
 	switch key {
 	case "UID":
 		e.id = val
 	case "SUMMARY":
-		e.summary = val
+		e.summary = utils.UnescapeText(val)
 	case "DESCRIPTION":
-		e.description = val
+		e.description = utils.UnescapeText(val)
 	case "LOCATION":
-		e.location = val
+		e.location = utils.UnescapeText(val)
 	case "URL":
 		if _, err := url.ParseRequestURI(val); err != nil {
 			return fmt.Errorf("invalid URL")
@@ -266,13 +421,52 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 			return fmt.Errorf("invalid SEQUENCE")
 		}
 		e.sequence = sequence
-	case "RRULE":
-		switch {
-		case e.startDate == 0:
-			return fmt.Errorf("RRULE requires a start date")
-		case e.recurrenceID != 0:
-			return fmt.Errorf("RRULE and RECURRENCE-ID are mutually exclusive")
+	case "STATUS":
+		switch status := EventStatus(strings.ToUpper(val)); status {
+		case EventStatusTentative, EventStatusConfirmed, EventStatusCancelled:
+			e.status = status
+		default:
+			return fmt.Errorf("invalid STATUS: %s", val)
+		}
+	case "CATEGORIES":
+		// the property can be repeated
+		e.categories = append(e.categories, utils.SplitText(val)...)
+	case "PRIORITY":
+		priority, err := strconv.Atoi(val)
+		if err != nil || priority < 0 || priority > 9 {
+			return fmt.Errorf("invalid PRIORITY: %s", val)
+		}
+		e.priority = priority
+	case "CLASS":
+		switch class := EventClass(strings.ToUpper(val)); class {
+		case EventClassPublic, EventClassPrivate, EventClassConfidential:
+			e.class = class
+		default:
+			// the unknown classes are treated as PRIVATE (RFC5545 section 3.8.1.3)
+			e.class = EventClassPrivate
+		}
+	case "TRANSP":
+		switch transp := EventTransp(strings.ToUpper(val)); transp {
+		case EventTranspOpaque, EventTranspTransparent:
+			e.transp = transp
+		default:
+			return fmt.Errorf("invalid TRANSP: %s", val)
+		}
+	case "GEO":
+		parts := strings.Split(val, ";")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid GEO: %s", val)
 		}
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if latErr != nil || lonErr != nil ||
+			latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return fmt.Errorf("invalid GEO: %s", val)
+		}
+		e.geo = &Geo{Latitude: latitude, Longitude: longitude}
+	case "RRULE":
+		// the properties come in any order, e.g. Outlook writes RRULE before
+		// DTSTART, so it's checked against them in DecideEventType
 		e.rruleString = val
 	default:
 		e.customProperties = append(e.customProperties, property)
@@ -280,8 +474,24 @@ func (e *UndecidedEvent) AddIcalProperty(property string) error {
 	return nil
 }
 
+// Infer the end date of the event if it has none (RFC5545 section 3.6.1):
+// from the DURATION, else a whole-day event lasts one day and a timed event
+// ends when it starts
+func (e *UndecidedEvent) inferEndDate() {
+	switch {
+	case e.endDate != 0 || e.startDate == 0:
+	case e.hasDuration:
+		e.endDate = e.startDate + e.duration
+	case e.IsWholeDay():
+		e.endDate = e.startDate + 24*60*60
+	default:
+		e.endDate = e.startDate
+	}
+}
+
 // Convert the template event into a master or child event
 func (e *UndecidedEvent) DecideEventType() (interface{}, error) {
+	e.inferEndDate()
 	if err := e.validate(); err != nil {
 		return nil, err
 	}
@@ -301,12 +511,17 @@ func (e *UndecidedEvent) DecideEventType() (interface{}, error) {
 		return nil, fmt.Errorf("rdate only works with recurring events")
 
 	case e.recurrenceID == 0:
-		return MasterEvent{
+		masterEvent := MasterEvent{
 			EventInfo:   e.EventInfo,
 			rruleString: e.rruleString,
 			exDates:     e.exDate,
 			rDates:      e.rDate,
-		}, nil
+		}
+		// the rule is checked along with DTSTART, EXDATE and RDATE
+		if _, err := masterEvent.GetRRuleSet(); err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s: %w", e.rruleString, errors.Unwrap(err))
+		}
+		return masterEvent, nil
 
 	// to be a child event has a more strict condition; the template event
 	// needs to have a recurrence-id and must not have exdate, rdate or rruleSet
@@ -314,8 +529,9 @@ func (e *UndecidedEvent) DecideEventType() (interface{}, error) {
 	case e.recurrenceID != 0 && (e.rruleString == "") &&
 		(len(e.exDate) == 0) && (len(e.rDate) == 0):
 		return ChildEvent{
-			EventInfo:    e.EventInfo,
-			recurrenceID: e.recurrenceID,
+			EventInfo:     e.EventInfo,
+			recurrenceID:  e.recurrenceID,
+			thisAndFuture: e.thisAndFuture,
 		}, nil
 	default:
 		return nil, fmt.Errorf("cannot decide event type")
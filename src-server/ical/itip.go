@@ -0,0 +1,129 @@
+package ical
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"towd/src-server/ical/structured"
+	"towd/src-server/ical/utils"
+)
+
+// iTIP (RFC5546) scheduling messages are regular iCalendar objects carrying a
+// METHOD property, telling the receiver what to do with the components.
+
+type Method string
+
+var (
+	MethodPublish Method = "PUBLISH"
+	MethodRequest Method = "REQUEST"
+	MethodReply   Method = "REPLY"
+	MethodCancel  Method = "CANCEL"
+)
+
+// The answer of one or more attendees to an event invitation
+type ItipReply struct {
+	EventID      string
+	RecurrenceID int64 // 0 if the reply is about the whole event
+	Sequence     int
+	Attendees    []structured.Attendee
+}
+
+// Read the replies out of an iTIP REPLY message.
+//
+// A REPLY only has to hold the UID, the ORGANIZER and the replying ATTENDEE
+// of each event, which would be rejected as an incomplete event by the regular
+// parser, so this one only looks at the properties it needs.
+func ParseItipReply(ctx context.Context, r io.Reader) ([]ItipReply, *CustomError) {
+	lines := newLineReader(&boundedReader{ctx: ctx, r: r, remaining: DefaultMaxSize}, DefaultMaxSize)
+
+	replies := make([]ItipReply, 0)
+	var method Method
+	var reply *ItipReply
+	for {
+		contentLine, ok := lines.next()
+		if !ok {
+			break
+		}
+		line := contentLine.text
+		lineNo, column := contentLine.position(0)
+		valueLineNo, valueColumn := contentLine.valuePosition()
+		if line == "" {
+			continue
+		}
+		name, _, value, err := utils.SplitContentLine(line)
+		if err != nil {
+			return nil, NewCustomError("invalid content line", map[string]any{
+				"line":    lineNo,
+				"column":  column,
+				"content": line,
+				"err":     err,
+			})
+		}
+
+		switch {
+		case name == "METHOD" && reply == nil:
+			method = Method(strings.ToUpper(strings.TrimSpace(value)))
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			reply = &ItipReply{}
+		case name == "END" && strings.EqualFold(value, "VEVENT") && reply != nil:
+			if reply.EventID == "" {
+				return nil, NewCustomError("missing UID", map[string]any{
+					"line":   lineNo,
+					"column": column,
+				})
+			}
+			replies = append(replies, *reply)
+			reply = nil
+		case reply == nil:
+		case name == "UID":
+			reply.EventID = strings.TrimSpace(value)
+		case name == "SEQUENCE":
+			sequence, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || sequence < 0 {
+				return nil, NewCustomError("invalid SEQUENCE", map[string]any{
+					"line":    valueLineNo,
+					"column":  valueColumn,
+					"content": line,
+				})
+			}
+			reply.Sequence = sequence
+		case name == "RECURRENCE-ID":
+			recurrenceID, err := utils.Datetime2Unix(line)
+			if err != nil {
+				return nil, NewCustomError("invalid RECURRENCE-ID", map[string]any{
+					"line":    valueLineNo,
+					"column":  valueColumn,
+					"content": line,
+					"err":     err,
+				})
+			}
+			reply.RecurrenceID = recurrenceID
+		case name == "ATTENDEE":
+			attendee := structured.NewAttendee()
+			if err := attendee.FromIcal(line); err != nil {
+				return nil, NewCustomError("invalid ATTENDEE", map[string]any{
+					"line":    valueLineNo,
+					"column":  valueColumn,
+					"content": line,
+					"err":     err,
+				})
+			}
+			reply.Attendees = append(reply.Attendees, attendee)
+		}
+	}
+
+	if err := lines.err(); err != nil {
+		return nil, NewCustomError("can't read the input", map[string]any{
+			"line": lines.lineCount,
+			"err":  err,
+		})
+	}
+	if method != MethodReply {
+		return nil, NewCustomError(fmt.Sprintf("expected METHOD:%s", MethodReply), map[string]any{
+			"method": method,
+		})
+	}
+	return replies, nil
+}
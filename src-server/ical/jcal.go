@@ -0,0 +1,561 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"towd/src-server/ical/utils"
+)
+
+// jCal (RFC7265) is the JSON representation of iCalendar. Both directions go
+// through the text format, so everything the parser and the serializer keep
+// (custom properties included) survives the conversion.
+
+// The value type of the properties when no VALUE parameter is given. Unknown
+// properties (e.g. X-*) are written with the "unknown" type and their raw
+// value.
+var jcalDefaultTypes = map[string]string{
+	"ACTION":           "text",
+	"ATTACH":           "uri",
+	"ATTENDEE":         "cal-address",
+	"CALSCALE":         "text",
+	"CATEGORIES":       "text",
+	"CLASS":            "text",
+	"COMMENT":          "text",
+	"COMPLETED":        "date-time",
+	"CONTACT":          "text",
+	"CREATED":          "date-time",
+	"DESCRIPTION":      "text",
+	"DTEND":            "date-time",
+	"DTSTAMP":          "date-time",
+	"DTSTART":          "date-time",
+	"DUE":              "date-time",
+	"DURATION":         "duration",
+	"EXDATE":           "date-time",
+	"EXRULE":           "recur",
+	"FREEBUSY":         "period",
+	"GEO":              "float",
+	"LAST-MODIFIED":    "date-time",
+	"LOCATION":         "text",
+	"METHOD":           "text",
+	"ORGANIZER":        "cal-address",
+	"PERCENT-COMPLETE": "integer",
+	"PRIORITY":         "integer",
+	"PRODID":           "text",
+	"RDATE":            "date-time",
+	"RECURRENCE-ID":    "date-time",
+	"RELATED-TO":       "text",
+	"REPEAT":           "integer",
+	"REQUEST-STATUS":   "text",
+	"RESOURCES":        "text",
+	"RRULE":            "recur",
+	"SEQUENCE":         "integer",
+	"STATUS":           "text",
+	"SUMMARY":          "text",
+	"TRANSP":           "text",
+	"TRIGGER":          "duration",
+	"TZID":             "text",
+	"TZNAME":           "text",
+	"TZOFFSETFROM":     "utc-offset",
+	"TZOFFSETTO":       "utc-offset",
+	"TZURL":            "uri",
+	"UID":              "text",
+	"URL":              "uri",
+	"VERSION":          "text",
+}
+
+// Properties holding a comma separated list of values
+var jcalMultiValued = map[string]struct{}{
+	"CATEGORIES": {},
+	"EXDATE":     {},
+	"FREEBUSY":   {},
+	"RDATE":      {},
+	"RESOURCES":  {},
+}
+
+// Properties holding a semicolon separated structured value
+var jcalStructured = map[string]struct{}{
+	"GEO":            {},
+	"REQUEST-STATUS": {},
+}
+
+// The integer parts of a RECUR value, the other parts are strings
+var jcalRecurIntegers = map[string]struct{}{
+	"COUNT":      {},
+	"INTERVAL":   {},
+	"BYSECOND":   {},
+	"BYMINUTE":   {},
+	"BYHOUR":     {},
+	"BYMONTHDAY": {},
+	"BYYEARDAY":  {},
+	"BYWEEKNO":   {},
+	"BYMONTH":    {},
+	"BYSETPOS":   {},
+}
+
+// Marshal a Calendar{} struct into a jCal document.
+func (cal *Calendar) ToJCal() ([]byte, error) {
+	root, err := cal.toJCalTree()
+	if err != nil {
+		return nil, fmt.Errorf("(*Calendar).ToJCal: %w", err)
+	}
+	result, err := json.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("(*Calendar).ToJCal: %w", err)
+	}
+	return result, nil
+}
+
+// Unmarshal a jCal document into a Calendar{} struct.
+func FromJCal(r io.Reader) (*Calendar, *CustomError) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var root []any
+	if err := decoder.Decode(&root); err != nil {
+		return nil, NewCustomError("can't decode jCal", map[string]any{
+			"err": err,
+		})
+	}
+	return fromJCalTree(root)
+}
+
+// Build the jCal tree of the calendar, also used as the intermediate
+// representation of xCal. Numbers are int or float64.
+func (cal *Calendar) toJCalTree() ([]any, error) {
+	var buf bytes.Buffer
+	if err := cal.ToIcal(&buf); err != nil {
+		return nil, err
+	}
+
+	lineReader := newLineReader(&buf, buf.Len())
+	lines := make([]string, 0)
+	for {
+		contentLine, ok := lineReader.next()
+		if !ok {
+			break
+		}
+		if contentLine.text != "" {
+			lines = append(lines, contentLine.text)
+		}
+	}
+
+	// each component is [name, properties, sub-components]
+	var root []any
+	stack := make([][]any, 0)
+	for lineNumber, line := range lines {
+		name, params, value, err := utils.SplitContentLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+
+		switch name {
+		case "BEGIN":
+			stack = append(stack, []any{strings.ToLower(value), []any{}, []any{}})
+			continue
+		case "END":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", lineNumber+1, value)
+			}
+			component := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				root = component
+				continue
+			}
+			parent := stack[len(stack)-1]
+			parent[2] = append(parent[2].([]any), component)
+			continue
+		}
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("line %d: property outside of a component", lineNumber+1)
+		}
+
+		property, err := icalPropertyToJCal(name, params, value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+		component := stack[len(stack)-1]
+		component[1] = append(component[1].([]any), property)
+	}
+	if root == nil || len(stack) != 0 {
+		return nil, fmt.Errorf("unbalanced BEGIN/END")
+	}
+	return root, nil
+}
+
+// Parse a jCal tree into a Calendar{} struct. Numbers must be json.Number.
+func fromJCalTree(root []any) (*Calendar, *CustomError) {
+
+	lines := make([]string, 0)
+	if err := jcalComponentToIcal(root, func(line string) {
+		lines = append(lines, line)
+	}); err != nil {
+		return nil, NewCustomError("invalid jCal", map[string]any{
+			"err": err,
+		})
+	}
+	if len(lines) == 0 || lines[0] != "BEGIN:VCALENDAR" {
+		return nil, NewCustomError("jCal root must be a vcalendar component", map[string]any{})
+	}
+
+	joined := strings.Join(lines, "\n")
+	cal, _, customErr := parseLines(newLineReader(strings.NewReader(joined), len(joined)), true)
+	return cal, customErr
+}
+
+// Convert a content line into a jCal property: [name, params, type, values...]
+func icalPropertyToJCal(name string, params []utils.Param, rawValue string) ([]any, error) {
+	valueType, ok := jcalDefaultTypes[name]
+	if !ok {
+		valueType = "unknown"
+	}
+
+	jcalParams := make(map[string]any)
+	for _, param := range params {
+		if param.Name == "VALUE" && len(param.Values) == 1 {
+			valueType = strings.ToLower(param.Values[0])
+			continue
+		}
+		if len(param.Values) == 1 {
+			jcalParams[strings.ToLower(param.Name)] = param.Values[0]
+		} else {
+			jcalParams[strings.ToLower(param.Name)] = param.Values
+		}
+	}
+
+	property := []any{strings.ToLower(name), jcalParams, valueType}
+	if _, ok := jcalStructured[name]; ok && valueType != "unknown" {
+		parts := make([]any, 0)
+		for _, part := range splitUnescaped(rawValue, ';') {
+			value, err := icalValueToJCal(valueType, part)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			parts = append(parts, value)
+		}
+		return append(property, parts), nil
+	}
+
+	rawValues := []string{rawValue}
+	if _, ok := jcalMultiValued[name]; ok {
+		rawValues = splitUnescaped(rawValue, ',')
+	}
+	for _, raw := range rawValues {
+		value, err := icalValueToJCal(valueType, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		property = append(property, value)
+	}
+	return property, nil
+}
+
+// Convert a single raw value into its jCal representation
+func icalValueToJCal(valueType string, raw string) (any, error) {
+	switch valueType {
+	case "text":
+		return utils.UnescapeText(raw), nil
+	case "date":
+		if len(raw) != 8 {
+			return nil, fmt.Errorf("invalid date: %s", raw)
+		}
+		return raw[0:4] + "-" + raw[4:6] + "-" + raw[6:8], nil
+	case "date-time":
+		if len(raw) != 15 && len(raw) != 16 {
+			return nil, fmt.Errorf("invalid date-time: %s", raw)
+		}
+		return raw[0:4] + "-" + raw[4:6] + "-" + raw[6:11] + ":" + raw[11:13] + ":" + raw[13:], nil
+	case "time":
+		if len(raw) != 6 && len(raw) != 7 {
+			return nil, fmt.Errorf("invalid time: %s", raw)
+		}
+		return raw[0:2] + ":" + raw[2:4] + ":" + raw[4:], nil
+	case "utc-offset":
+		if len(raw) != 5 && len(raw) != 7 {
+			return nil, fmt.Errorf("invalid utc-offset: %s", raw)
+		}
+		result := raw[0:3] + ":" + raw[3:5]
+		if len(raw) == 7 {
+			result += ":" + raw[5:7]
+		}
+		return result, nil
+	case "period":
+		start, end, ok := strings.Cut(raw, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid period: %s", raw)
+		}
+		jcalStart, err := icalValueToJCal("date-time", start)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(end, "P") {
+			jcalEnd, err := icalValueToJCal("date-time", end)
+			if err != nil {
+				return nil, err
+			}
+			end = jcalEnd.(string)
+		}
+		return jcalStart.(string) + "/" + end, nil
+	case "integer":
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %s", raw)
+		}
+		return value, nil
+	case "float":
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float: %s", raw)
+		}
+		return value, nil
+	case "boolean":
+		return strings.EqualFold(raw, "TRUE"), nil
+	case "recur":
+		recur := make(map[string]any)
+		for _, part := range strings.Split(raw, ";") {
+			key, value, ok := strings.Cut(part, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid recur part: %s", part)
+			}
+			key = strings.ToUpper(key)
+
+			values := make([]any, 0)
+			for _, v := range strings.Split(value, ",") {
+				switch {
+				case key == "UNTIL" && len(v) == 8:
+					values = append(values, v[0:4]+"-"+v[4:6]+"-"+v[6:8])
+				case key == "UNTIL":
+					jcalUntil, err := icalValueToJCal("date-time", v)
+					if err != nil {
+						return nil, err
+					}
+					values = append(values, jcalUntil)
+				default:
+					if _, ok := jcalRecurIntegers[key]; ok {
+						number, err := strconv.Atoi(v)
+						if err != nil {
+							return nil, fmt.Errorf("invalid recur %s: %s", key, v)
+						}
+						values = append(values, number)
+					} else {
+						values = append(values, v)
+					}
+				}
+			}
+			if len(values) == 1 {
+				recur[strings.ToLower(key)] = values[0]
+			} else {
+				recur[strings.ToLower(key)] = values
+			}
+		}
+		return recur, nil
+	default:
+		// binary, cal-address, duration, uri and unknown are kept as-is
+		return raw, nil
+	}
+}
+
+// Convert a jCal component into content lines
+func jcalComponentToIcal(component []any, writer func(string)) error {
+	if len(component) != 3 {
+		return fmt.Errorf("component must have 3 elements, got %d", len(component))
+	}
+	name, ok := component[0].(string)
+	if !ok {
+		return fmt.Errorf("component name must be a string")
+	}
+	properties, ok := component[1].([]any)
+	if !ok {
+		return fmt.Errorf("%s: properties must be an array", name)
+	}
+	subComponents, ok := component[2].([]any)
+	if !ok {
+		return fmt.Errorf("%s: sub-components must be an array", name)
+	}
+
+	name = strings.ToUpper(name)
+	writer("BEGIN:" + name)
+	for _, rawProperty := range properties {
+		property, ok := rawProperty.([]any)
+		if !ok {
+			return fmt.Errorf("%s: property must be an array", name)
+		}
+		line, err := jcalPropertyToIcal(property)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		writer(line)
+	}
+	for _, rawSubComponent := range subComponents {
+		subComponent, ok := rawSubComponent.([]any)
+		if !ok {
+			return fmt.Errorf("%s: sub-component must be an array", name)
+		}
+		if err := jcalComponentToIcal(subComponent, writer); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	writer("END:" + name)
+	return nil
+}
+
+// Convert a jCal property into a content line
+func jcalPropertyToIcal(property []any) (string, error) {
+	if len(property) < 4 {
+		return "", fmt.Errorf("property must have at least 4 elements, got %d", len(property))
+	}
+	name, ok := property[0].(string)
+	if !ok {
+		return "", fmt.Errorf("property name must be a string")
+	}
+	name = strings.ToUpper(name)
+	jcalParams, ok := property[1].(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("%s: parameters must be an object", name)
+	}
+	valueType, ok := property[2].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: type must be a string", name)
+	}
+	valueType = strings.ToLower(valueType)
+
+	params := make([]utils.Param, 0, len(jcalParams)+1)
+	for paramName, rawValue := range jcalParams {
+		param := utils.Param{Name: strings.ToUpper(paramName)}
+		switch value := rawValue.(type) {
+		case string:
+			param.Values = []string{value}
+		case []any:
+			for _, v := range value {
+				s, ok := v.(string)
+				if !ok {
+					return "", fmt.Errorf("%s: parameter %s must hold strings", name, paramName)
+				}
+				param.Values = append(param.Values, s)
+			}
+		default:
+			return "", fmt.Errorf("%s: parameter %s must be a string or an array", name, paramName)
+		}
+		params = append(params, param)
+	}
+	// the order of a JSON object isn't meaningful, keep the output stable
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+	defaultType, ok := jcalDefaultTypes[name]
+	if !ok {
+		defaultType = "unknown"
+	}
+	if valueType != defaultType && valueType != "unknown" {
+		params = append(params, utils.Param{Name: "VALUE", Values: []string{strings.ToUpper(valueType)}})
+	}
+
+	separator := ","
+	values := property[3:]
+	if _, ok := jcalStructured[name]; ok && len(values) == 1 {
+		if parts, ok := values[0].([]any); ok {
+			separator = ";"
+			values = parts
+		}
+	}
+	rawValues := make([]string, 0, len(values))
+	for _, value := range values {
+		raw, err := jcalValueToIcal(valueType, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		rawValues = append(rawValues, raw)
+	}
+
+	return utils.JoinContentLine(name, params, strings.Join(rawValues, separator)), nil
+}
+
+// Convert a single jCal value into its raw iCalendar representation
+func jcalValueToIcal(valueType string, value any) (string, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case map[string]any:
+		if valueType != "recur" {
+			return "", fmt.Errorf("unexpected object for %s value", valueType)
+		}
+		return jcalRecurToIcal(v)
+	case string:
+		switch valueType {
+		case "text":
+			return utils.EscapeText(v), nil
+		case "date", "date-time", "time", "period":
+			return strings.NewReplacer("-", "", ":", "").Replace(v), nil
+		case "utc-offset":
+			// the sign is part of the value, e.g. -05:00
+			return strings.ReplaceAll(v, ":", ""), nil
+		default:
+			return v, nil
+		}
+	default:
+		return "", fmt.Errorf("unexpected %T for %s value", value, valueType)
+	}
+}
+
+// Convert a jCal RECUR object into a raw RRULE value, FREQ first
+func jcalRecurToIcal(recur map[string]any) (string, error) {
+	keys := make([]string, 0, len(recur))
+	for key := range recur {
+		if !strings.EqualFold(key, "freq") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := recur["freq"]; ok {
+		keys = append([]string{"freq"}, keys...)
+	}
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		var values []any
+		if array, ok := recur[key].([]any); ok {
+			values = array
+		} else {
+			values = []any{recur[key]}
+		}
+
+		rawValues := make([]string, 0, len(values))
+		for _, value := range values {
+			raw, err := jcalValueToIcal("recur-part", value)
+			if err != nil {
+				return "", fmt.Errorf("recur %s: %w", key, err)
+			}
+			if strings.EqualFold(key, "until") {
+				raw = strings.NewReplacer("-", "", ":", "").Replace(raw)
+			}
+			rawValues = append(rawValues, raw)
+		}
+		parts = append(parts, strings.ToUpper(key)+"="+strings.Join(rawValues, ","))
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+// Split a raw value on a separator, ignoring the backslash-escaped ones
+func splitUnescaped(raw string, separator byte) []string {
+	result := make([]string, 0, 1)
+	start := 0
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case separator:
+			result = append(result, raw[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, raw[start:])
+}
@@ -0,0 +1,129 @@
+package ical
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrTooLarge = errors.New("ical: input exceeds the maximum size")
+
+// An io.Reader failing once the context is done or once more than the
+// remaining bytes are read
+type boundedReader struct {
+	ctx       context.Context
+	r         io.Reader
+	remaining int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if b.remaining <= 0 {
+		// only fail if there's something left to read
+		var probe [1]byte
+		n, err := b.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// An unfolded content line, remembering where it comes from
+type contentLine struct {
+	text  string
+	line  int   // the line the content line starts on, 1-based
+	folds []int // the offsets in text where the continuation lines start
+}
+
+// Get the line and column, both 1-based, of a byte offset in the content line
+func (cl contentLine) position(offset int) (int, int) {
+	line, start := cl.line, 0
+	for i, fold := range cl.folds {
+		if offset < fold {
+			break
+		}
+		line, start = cl.line+i+1, fold
+	}
+	column := offset - start + 1
+	if line != cl.line {
+		// the whitespace starting the continuation line
+		column++
+	}
+	return line, column
+}
+
+// Get the line and column of the value of the content line, i.e. right after
+// the first colon that isn't in a quoted parameter value
+func (cl contentLine) valuePosition() (int, int) {
+	isQuoted := false
+	for i := 0; i < len(cl.text); i++ {
+		switch {
+		case cl.text[i] == '"':
+			isQuoted = !isQuoted
+		case cl.text[i] == ':' && !isQuoted:
+			return cl.position(i + 1)
+		}
+	}
+	return cl.position(0)
+}
+
+// Reads the content lines and unfolds them (RFC5545 section 3.1). Both CRLF
+// and LF line breaks are accepted, continuation lines may start with a space
+// or a tab.
+type lineReader struct {
+	scanner    *bufio.Scanner
+	lineCount  int
+	pending    string // the line read ahead to know if the previous one goes on
+	hasPending bool
+}
+
+func newLineReader(r io.Reader, maxLineSize int) *lineReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), max(maxLineSize, 64*1024))
+	return &lineReader{scanner: scanner}
+}
+
+func (lr *lineReader) scan() bool {
+	if !lr.scanner.Scan() {
+		return false
+	}
+	lr.lineCount++
+	lr.pending = lr.scanner.Text()
+	lr.hasPending = true
+	return true
+}
+
+// Get the next content line, false once there's nothing left to read or the
+// reader failed, see err()
+func (lr *lineReader) next() (contentLine, bool) {
+	if !lr.hasPending && !lr.scan() {
+		return contentLine{}, false
+	}
+	cl := contentLine{text: lr.pending, line: lr.lineCount}
+	lr.hasPending = false
+	for lr.scan() {
+		if !strings.HasPrefix(lr.pending, " ") && !strings.HasPrefix(lr.pending, "\t") {
+			break
+		}
+		cl.folds = append(cl.folds, len(cl.text))
+		cl.text += lr.pending[1:]
+		lr.hasPending = false
+	}
+	return cl, true
+}
+
+// Get the error that stopped the reader, nil at the end of the input
+func (lr *lineReader) err() error {
+	return lr.scanner.Err()
+}
@@ -2,102 +2,122 @@ package ical
 
 import (
 	"log/slog"
+	"strings"
 	"time"
 	"towd/src-server/ical/event"
+	"towd/src-server/ical/utils"
 
 	"github.com/google/uuid"
 )
 
 // Pure event information
 type StaticEvent struct {
-	ID          string `json:"id"`         // required
-	StartDate   int64  `json:"start_date"` // required
-	EndDate     int64  `json:"end_date"`   // required
-	IsWholeDay  bool   `json:"is_whole_day"`
-	Title       string `json:"title"` // required
-	Description string `json:"description"`
-	Location    string `json:"location"`
-	URL         string `json:"url"`
-	Organizer   string `json:"organizer"`
+	ID          string   `json:"id"`         // required
+	StartDate   int64    `json:"start_date"` // required
+	EndDate     int64    `json:"end_date"`   // required
+	IsWholeDay  bool     `json:"is_whole_day"`
+	IsFloating  bool     `json:"is_floating"`
+	Title       string   `json:"title"` // required
+	Description string   `json:"description"`
+	Location    string   `json:"location"`
+	URL         string   `json:"url"`
+	Organizer   string   `json:"organizer"`
+	Status      string   `json:"status"`
+	Categories  []string `json:"categories"`
+	Class       string   `json:"class"`
+	Transp      string   `json:"transp"`
+
+	Attendees []StaticAttendee `json:"attendees"`
+}
+
+// Pure attendee information
+type StaticAttendee struct {
+	CalAddress    string   `json:"cal_address"` // required, e.g. mailto:john@example.com
+	Name          string   `json:"name"`
+	CuType        string   `json:"cu_type"`   // required
+	Role          string   `json:"role"`      // required
+	PartStat      string   `json:"part_stat"` // required
+	Rsvp          bool     `json:"rsvp"`
+	DelegatedTo   []string `json:"delegated_to"`
+	DelegatedFrom []string `json:"delegated_from"`
+	SentBy        string   `json:"sent_by"`
 }
 
-func (c *Calendar) ToStaticEvents() []StaticEvent {
+// Get the occurrences of all events, the recurrence rules can go on forever so
+// they're only expanded within the [from, to) window. A non-recurring event is
+// kept wherever it is.
+func (c *Calendar) ToStaticEvents(from time.Time, to time.Time) []StaticEvent {
 	staticEvents := make([]StaticEvent, 0)
 
 	c.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
-		rruleSet, err := masterEvent.GetRRuleSet()
-		switch {
-		case err != nil:
-			slog.Warn("can't get rrule set", "where", "ical.StaticEvent.ToStaticEvents", "error", err)
-		case rruleSet == nil:
+		eventFrom, eventTo := from, to
+		if !masterEvent.IsRecurring() {
+			eventFrom = time.Unix(masterEvent.GetStartDate(), 0)
+			eventTo = time.Unix(max(masterEvent.GetEndDate(), masterEvent.GetStartDate()+1), 0)
+		}
+		next, err := masterEvent.Occurrences(eventFrom, eventTo)
+		if err != nil {
+			slog.Warn("can't expand event", "where", "(*Calendar).ToStaticEvents", "id", id, "error", err)
+			return nil
+		}
+		for occurrence, ok := next(); ok; occurrence, ok = next() {
 			staticEvents = append(staticEvents, StaticEvent{
-				ID:        masterEvent.GetID(),
-				StartDate: masterEvent.GetStartDate(),
-				EndDate:   masterEvent.GetEndDate(),
-				IsWholeDay: func() bool {
-					startDate := time.Unix(masterEvent.GetStartDate(), 0)
-					return startDate.Hour() == 0 && startDate.Minute() == 0
+				ID: func() string {
+					// the occurrences of a recurring event share its ID
+					if masterEvent.IsRecurring() {
+						return uuid.NewString()
+					}
+					return occurrence.Info.GetID()
 				}(),
-				Title:       masterEvent.GetSummary(),
-				Description: masterEvent.GetDescription(),
-				Location:    masterEvent.GetLocation(),
-				URL:         masterEvent.GetURL(),
-				Organizer:   masterEvent.GetOrganizer(),
-			})
-		case rruleSet != nil:
-			// get all dates from rrule set
-			allDates := func() map[int64]struct{} {
-				allDates := make(map[int64]struct{})
-				for _, date := range rruleSet.All() {
-					allDates[date.UTC().Unix()] = struct{}{}
-				}
-				return allDates
-			}()
-
-			startEndDiff := masterEvent.GetEndDate() - masterEvent.GetStartDate()
-
-			// append its child events first and remove corresponding recurrence
-			// IDs from allDates since they're overwriting the master event's
-			// occurrences
-			masterEvent.IterateChildEvents(func(id string, childEvent *event.ChildEvent) error {
-				delete(allDates, childEvent.GetRecurrenceID())
-				staticEvents = append(staticEvents, StaticEvent{
-					ID:        uuid.NewString(),
-					StartDate: childEvent.GetRecurrenceID(),
-					EndDate:   childEvent.GetRecurrenceID() + startEndDiff,
-					IsWholeDay: func() bool {
-						startDate := time.Unix(childEvent.GetRecurrenceID(), 0)
-						return startDate.Hour() == 0 && startDate.Minute() == 0
-					}(),
-					Title:       childEvent.GetSummary(),
-					Description: childEvent.GetDescription(),
-					Location:    childEvent.GetLocation(),
-					URL:         childEvent.GetURL(),
-					Organizer:   childEvent.GetOrganizer(),
-				})
-				return nil
+				StartDate:   occurrence.StartDate,
+				EndDate:     occurrence.EndDate,
+				IsWholeDay:  occurrence.Info.IsWholeDay(),
+				IsFloating:  occurrence.Info.GetDateKind() == utils.DateKindFloating,
+				Title:       occurrence.Info.GetSummary(),
+				Description: occurrence.Info.GetDescription(),
+				Location:    occurrence.Info.GetLocation(),
+				URL:         occurrence.Info.GetURL(),
+				Organizer:   OrganizerName(occurrence.Info),
+				Status:      string(occurrence.Info.GetStatus()),
+				Categories:  occurrence.Info.GetCategories(),
+				Class:       string(occurrence.Info.GetClass()),
+				Transp:      string(occurrence.Info.GetTransp()),
+				Attendees:   staticAttendees(occurrence.Info),
 			})
-
-			// create clones
-			for date := range allDates {
-				staticEvents = append(staticEvents, StaticEvent{
-					ID:        uuid.NewString(),
-					StartDate: date,
-					EndDate:   date + startEndDiff,
-					IsWholeDay: func() bool {
-						startDate := time.Unix(date, 0)
-						return startDate.Hour() == 0 && startDate.Minute() == 0
-					}(),
-					Title:       masterEvent.GetSummary(),
-					Description: masterEvent.GetDescription(),
-					Location:    masterEvent.GetLocation(),
-					URL:         masterEvent.GetURL(),
-					Organizer:   masterEvent.GetOrganizer(),
-				})
-			}
 		}
 		return nil
 	})
 
 	return staticEvents
 }
+
+func staticAttendees(info *event.EventInfo) []StaticAttendee {
+	attendees := make([]StaticAttendee, 0)
+	for _, attendee := range info.GetAttendee() {
+		staticAttendee := StaticAttendee{
+			CalAddress: attendee.GetCalAddress(),
+			Name:       string(attendee.GetCn()),
+			CuType:     string(attendee.GetCuType()),
+			Role:       string(attendee.GetRole()),
+			PartStat:   string(attendee.GetPartStat()),
+			Rsvp:       attendee.GetRsvp(),
+			SentBy:     string(attendee.GetSentBy()),
+		}
+		for _, delegatedTo := range attendee.GetDelegatedTo() {
+			staticAttendee.DelegatedTo = append(staticAttendee.DelegatedTo, string(delegatedTo))
+		}
+		for _, delegatedFrom := range attendee.GetDelegatedFrom() {
+			staticAttendee.DelegatedFrom = append(staticAttendee.DelegatedFrom, string(delegatedFrom))
+		}
+		attendees = append(attendees, staticAttendee)
+	}
+	return attendees
+}
+
+// The organizer's common name if any, its cal-address otherwise
+func OrganizerName(info *event.EventInfo) string {
+	if cn := info.GetOrganizerCn(); cn != "" {
+		return cn
+	}
+	return strings.TrimPrefix(info.GetOrganizer(), "mailto:")
+}
@@ -3,15 +3,17 @@ package structured
 import (
 	"fmt"
 	"log/slog"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"towd/src-server/ical/utils"
 
 	"github.com/google/uuid"
 )
 
 type (
-	AlarmAction string
+	AlarmAction         string
+	AlarmTriggerRelated string
 )
 
 var (
@@ -19,18 +21,25 @@ var (
 	AlarmActionDisplay   AlarmAction = "DISPLAY"
 	AlarmActionEmail     AlarmAction = "EMAIL"
 	AlarmActionProcedure AlarmAction = "PROCEDURE"
+
+	AlarmTriggerRelatedStart AlarmTriggerRelated = "START"
+	AlarmTriggerRelatedEnd   AlarmTriggerRelated = "END"
 )
 
 type Alarm struct {
-	uid         string
-	action      AlarmAction
-	trigger     string
-	duration    string
-	repeat      int
-	attach      string
-	description string
-	summary     string
-	attendee    []Attendee
+	uid    string
+	action AlarmAction
+	// the trigger is either relative to the start or the end of the
+	// component (triggerRelated set), or an absolute date (triggerDate set)
+	triggerOffset  int64 // seconds
+	triggerRelated AlarmTriggerRelated
+	triggerDate    int64
+	duration       int64 // seconds between the repetitions
+	repeat         int
+	attach         string
+	description    string
+	summary        string
+	attendee       []Attendee
 
 	CustomProperties []string
 }
@@ -53,18 +62,60 @@ func (a *Alarm) SetAction(action AlarmAction) *Alarm {
 	return a
 }
 
-// Set the alarm trigger
-func (a *Alarm) SetTrigger(trigger string) *Alarm {
-	a.trigger = trigger
+// Get the alarm UID
+func (a *Alarm) GetUid() string {
+	return a.uid
+}
+
+// Get the alarm action
+func (a *Alarm) GetAction() AlarmAction {
+	return a.action
+}
+
+// Set the alarm trigger, as an offset in seconds from the start or the end
+// of the component, e.g. -900 for 15 minutes before.
+func (a *Alarm) SetTrigger(offset int64, related AlarmTriggerRelated) *Alarm {
+	a.triggerOffset = offset
+	a.triggerRelated = related
+	a.triggerDate = 0
 	return a
 }
 
-// Set the alarm duration
-func (a *Alarm) SetDuration(duration string) *Alarm {
+// Get the alarm trigger offset in seconds, and what it is relative to.
+// The related is empty if the trigger is an absolute date.
+func (a *Alarm) GetTrigger() (int64, AlarmTriggerRelated) {
+	return a.triggerOffset, a.triggerRelated
+}
+
+// Set the alarm trigger to an absolute date, in unix time.
+func (a *Alarm) SetTriggerDate(triggerDate int64) *Alarm {
+	a.triggerOffset = 0
+	a.triggerRelated = ""
+	a.triggerDate = triggerDate
+	return a
+}
+
+// Get the absolute trigger date in unix time, 0 if the trigger is relative.
+func (a *Alarm) GetTriggerDate() int64 {
+	return a.triggerDate
+}
+
+// Set the delay in seconds between the repetitions of the alarm
+func (a *Alarm) SetDuration(duration int64) *Alarm {
 	a.duration = duration
 	return a
 }
 
+// Get the delay in seconds between the repetitions of the alarm
+func (a *Alarm) GetDuration() int64 {
+	return a.duration
+}
+
+// Get the number of times the alarm repeats after the first trigger
+func (a *Alarm) GetRepeat() int {
+	return a.repeat
+}
+
 // Set the alarm repeat
 func (a *Alarm) SetRepeat(repeat int) *Alarm {
 	a.repeat = repeat
@@ -83,6 +134,11 @@ func (a *Alarm) SetDescription(description string) *Alarm {
 	return a
 }
 
+// Get the alarm description
+func (a *Alarm) GetDescription() string {
+	return a.description
+}
+
 // Set the alarm summary
 func (a *Alarm) SetSummary(summary string) *Alarm {
 	a.summary = summary
@@ -102,39 +158,52 @@ func (a *Alarm) AddCustomProperty(property string) *Alarm {
 	return a
 }
 
-func (a *Alarm) validate() error {
-	triggerRgx := regexp.MustCompile(`^(-PT)(\d+)(M|H)$`)
-	durationRgx := regexp.MustCompile(`^(PT)(\d+)(M|H)$`)
-
+func (a *Alarm) Validate() error {
 	switch {
 	case a.uid == "":
 		return fmt.Errorf("UID is required")
 	case a.action == "":
 		return fmt.Errorf("action is required")
-	case a.trigger == "":
+	case a.triggerRelated == "" && a.triggerDate == 0:
 		return fmt.Errorf("trigger is required")
-	case a.duration != "" && a.repeat == 0:
+	case a.duration != 0 && a.repeat == 0:
 		return fmt.Errorf("repeat is required when duration is set")
-	case a.duration == "" && a.repeat != 0:
+	case a.duration == 0 && a.repeat != 0:
 		return fmt.Errorf("duration is required when repeat is set")
-	case (a.trigger != "") && !triggerRgx.MatchString(a.trigger):
-		return fmt.Errorf("trigger format is invalid")
-	case (a.duration != "") && !durationRgx.MatchString(a.duration):
-		return fmt.Errorf("duration format is invalid")
+	case a.duration < 0 || a.repeat < 0:
+		return fmt.Errorf("duration and repeat can't be negative")
 	}
 	return nil
 }
 
+// Get the dates the alarm goes off, the trigger then each repetition, for a
+// component from startDate to endDate (in unix time). A trigger related to
+// the end falls back to the start when the component has no end.
+func (a *Alarm) GetTriggerDates(startDate, endDate int64) []int64 {
+	first := a.triggerDate
+	if a.triggerRelated != "" {
+		first = startDate + a.triggerOffset
+		if a.triggerRelated == AlarmTriggerRelatedEnd && endDate != 0 {
+			first = endDate + a.triggerOffset
+		}
+	}
+	dates := []int64{first}
+	for i := 1; i <= a.repeat; i++ {
+		dates = append(dates, first+int64(i)*a.duration)
+	}
+	return dates
+}
+
 // Add an iCalendar property to the alarm.
 // Unhandled properties will be stored in the CustomProperties array.
-func (a *Alarm) AddIcalProperty(property string) {
+func (a *Alarm) AddIcalProperty(property string) error {
 	slice := strings.SplitN(property, ":", 2)
 	if len(slice) != 2 {
 		a.CustomProperties = append(a.CustomProperties, property)
-		return
+		return nil
 	}
 
-	key := strings.ToUpper(strings.TrimSpace(slice[0]))
+	key := strings.ToUpper(strings.TrimSpace(strings.SplitN(slice[0], ";", 2)[0]))
 	value := strings.TrimSpace(slice[1])
 
 	switch key {
@@ -145,22 +214,46 @@ func (a *Alarm) AddIcalProperty(property string) {
 	case "ATTACH":
 		a.attach = value
 	case "DESCRIPTION":
-		a.description = value
+		a.description = utils.UnescapeText(value)
 	case "DURATION":
-		a.duration = value
+		duration, err := utils.Duration2Seconds(value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid DURATION: %s", value)
+		}
+		a.duration = duration
 	case "REPEAT":
-		if repeat, err := strconv.Atoi(value); err == nil {
-			a.repeat = repeat
-		} else {
-			a.repeat = 0
+		repeat, err := strconv.Atoi(value)
+		if err != nil || repeat < 0 {
+			return fmt.Errorf("invalid REPEAT: %s", value)
 		}
+		a.repeat = repeat
 	case "SUMMARY":
-		a.summary = value
+		a.summary = utils.UnescapeText(value)
 	case "TRIGGER":
-		a.trigger = value
+		if strings.EqualFold(utils.GetParam(property, "VALUE"), "DATE-TIME") {
+			triggerDate, err := utils.Datetime2Unix(property)
+			if err != nil {
+				return fmt.Errorf("invalid TRIGGER: %w", err)
+			}
+			a.SetTriggerDate(triggerDate)
+			break
+		}
+		offset, err := utils.Duration2Seconds(value)
+		if err != nil {
+			return fmt.Errorf("invalid TRIGGER: %w", err)
+		}
+		switch related := AlarmTriggerRelated(strings.ToUpper(utils.GetParam(property, "RELATED"))); related {
+		case "", AlarmTriggerRelatedStart:
+			a.SetTrigger(offset, AlarmTriggerRelatedStart)
+		case AlarmTriggerRelatedEnd:
+			a.SetTrigger(offset, AlarmTriggerRelatedEnd)
+		default:
+			return fmt.Errorf("invalid TRIGGER RELATED: %s", related)
+		}
 	default:
 		a.CustomProperties = append(a.CustomProperties, property)
 	}
+	return nil
 }
 
 // Convert the alarm into an iCalendar string. This method is intended to be used
@@ -168,22 +261,16 @@ func (a *Alarm) AddIcalProperty(property string) {
 //
 //	var sb strings.Builder
 //
-//	if err := structured.NewAlarm().
-//	    SetAction(structured.AlarmActionAudio).
-//	    SetTrigger("20220101T000000Z").
-//	    SetDuration("PT1H").
+//	alarm := structured.NewAlarm()
+//	alarm.SetAction(structured.AlarmActionAudio).
+//	    SetTrigger(-15*60, structured.AlarmTriggerRelatedStart).
+//	    SetDuration(5*60).
 //	    SetRepeat(1).
 //	    SetSummary("Alarm summary").
-//	    AddAttendee(structured.NewAttendee().
-//	        SetCuType(structured.AttendeeCutypeIndividual).
-//	        SetRole(structured.AttendeeRoleReq).
-//	        SetCn(structured.NewCommonName("Alarm Name", "alarm@example.com"))).
 //	    AddCustomProperty("X-MY-CUSTOM-PROPERTY:value").
-//	    ToIcal(&sb); err != nil {
-//	    log.Fatal(err)
-//	}
+//	    ToIcal(func(s string) { sb.WriteString(s) })
 func (a *Alarm) ToIcal(writer func(string)) {
-	if err := a.validate(); err != nil {
+	if err := a.Validate(); err != nil {
 		slog.Warn("Alarm.ToIcal", "err", err)
 		return
 	}
@@ -191,26 +278,34 @@ func (a *Alarm) ToIcal(writer func(string)) {
 	writer("BEGIN:VALARM\n")
 	writer("UID:" + a.uid + "\n")
 	writer("ACTION:" + string(a.action) + "\n")
-	if a.trigger != "" {
-		writer("TRIGGER;VALUE=DATE-TIME:" + a.trigger + "\n")
+	switch {
+	case a.triggerDate != 0:
+		writer("TRIGGER;VALUE=DATE-TIME:" + time.Unix(a.triggerDate, 0).UTC().Format("20060102T150405Z") + "\n")
+	case a.triggerRelated == AlarmTriggerRelatedEnd:
+		writer("TRIGGER;RELATED=END:" + utils.Seconds2Duration(a.triggerOffset) + "\n")
+	default:
+		writer("TRIGGER:" + utils.Seconds2Duration(a.triggerOffset) + "\n")
 	}
-	if a.duration != "" {
-		writer("DURATION:" + a.duration + "\n")
+	if a.duration != 0 {
+		writer("DURATION:" + utils.Seconds2Duration(a.duration) + "\n")
 	}
 	if a.repeat != 0 {
 		writer("REPEAT:" + strconv.Itoa(a.repeat) + "\n")
 	}
 	if a.attach != "" {
-		writer("ATTACH;" + a.attach + "\n")
+		writer("ATTACH:" + a.attach + "\n")
 	}
 	if a.description != "" {
-		writer("DESCRIPTION:" + a.description + "\n")
+		writer("DESCRIPTION:" + utils.EscapeText(a.description) + "\n")
 	}
 	if a.summary != "" {
-		writer("SUMMARY:" + a.summary + "\n")
+		writer("SUMMARY:" + utils.EscapeText(a.summary) + "\n")
 	}
 	for _, attendee := range a.attendee {
 		attendee.ToIcal(writer)
 	}
+	for _, customProperty := range a.CustomProperties {
+		writer(customProperty + "\n")
+	}
 	writer("END:VALARM\n")
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"towd/src-server/ical/utils"
 )
 
 type (
@@ -30,6 +31,7 @@ var (
 	AttendeePartStatDeclined    AttendeeParticipantStatus = "DECLINED"
 	AttendeePartStatTentative   AttendeeParticipantStatus = "TENTATIVE"
 	AttendeePartStatCancelled   AttendeeParticipantStatus = "CANCELLED"
+	AttendeePartStatDelegated   AttendeeParticipantStatus = "DELEGATED"
 	AttendeePartStatXName       AttendeeParticipantStatus = "X-NAME"
 )
 
@@ -44,62 +46,119 @@ type Attendee struct {
 	delegatedFrom []AttendeeCommonName
 	rsvp          bool // Répondez s'il vous plaît
 	sentBy        AttendeeCommonName
+	calAddress    string // e.g. mailto:john@example.com
 
-	customProperties []string
+	customParams []utils.Param
 }
 
 func NewAttendee() Attendee {
 	return Attendee{}
 }
 
+// Get the attendee CUType
+func (a *Attendee) GetCuType() AttendeeCustomertype {
+	return a.cuType
+}
+
 // Set the attendee CUType
 func (a *Attendee) SetCuType(cuType AttendeeCustomertype) *Attendee {
 	a.cuType = cuType
 	return a
 }
 
+// Get the attendee role
+func (a *Attendee) GetRole() AttendeeRole {
+	return a.role
+}
+
 // Set the attendee role
 func (a *Attendee) SetRole(role AttendeeRole) *Attendee {
 	a.role = role
 	return a
 }
 
+// Get the attendee partStat
+func (a *Attendee) GetPartStat() AttendeeParticipantStatus {
+	return a.partStat
+}
+
 // Set the attendee partStat
 func (a *Attendee) SetPartStat(partStat AttendeeParticipantStatus) *Attendee {
 	a.partStat = partStat
 	return a
 }
 
+// Get the attendee CN
+func (a *Attendee) GetCn() AttendeeCommonName {
+	return a.cn
+}
+
 // Set the attendee CN
 func (a *Attendee) SetCn(cn AttendeeCommonName) *Attendee {
 	a.cn = cn
 	return a
 }
 
+// Get the attendee MEMBER
+func (a *Attendee) GetMember() []AttendeeCommonName {
+	return a.member
+}
+
 // Set the attendee MEMBER
 func (a *Attendee) AddMember(member AttendeeCommonName) *Attendee {
 	a.member = append(a.member, member)
 	return a
 }
 
+// Get the attendee DELEGATED-TO
+func (a *Attendee) GetDelegatedTo() []AttendeeCommonName {
+	return a.delegatedTo
+}
+
 // Set the attendee DELEGATED-TO
 func (a *Attendee) AddDelegatedTo(delegatedTo AttendeeCommonName) *Attendee {
 	a.delegatedTo = append(a.delegatedTo, delegatedTo)
 	return a
 }
 
+// Get the attendee DELEGATED-FROM
+func (a *Attendee) GetDelegatedFrom() []AttendeeCommonName {
+	return a.delegatedFrom
+}
+
 // Set the attendee DELEGATED-FROM
 func (a *Attendee) AddDelegatedFrom(delegatedFrom AttendeeCommonName) *Attendee {
 	a.delegatedFrom = append(a.delegatedFrom, delegatedFrom)
 	return a
 }
 
+// Get the attendee RSVP
+func (a *Attendee) GetRsvp() bool {
+	return a.rsvp
+}
+
 // Set the attendee RSVP
 func (a *Attendee) SetRsvp(rsvp bool) *Attendee {
 	a.rsvp = rsvp
 	return a
 }
 
+// Get the attendee address, e.g. mailto:john@example.com
+func (a *Attendee) GetCalAddress() string {
+	return a.calAddress
+}
+
+// Set the attendee address, e.g. mailto:john@example.com
+func (a *Attendee) SetCalAddress(calAddress string) *Attendee {
+	a.calAddress = calAddress
+	return a
+}
+
+// Get the attendee SENT-BY
+func (a *Attendee) GetSentBy() AttendeeCommonName {
+	return a.sentBy
+}
+
 // Set the attendee SENT-BY
 func (a *Attendee) SetSentBy(sentBy AttendeeCommonName) *Attendee {
 	a.sentBy = sentBy
@@ -114,8 +173,8 @@ func (a *Attendee) validate() error {
 		return fmt.Errorf("ROLE is required")
 	case a.partStat == "":
 		return fmt.Errorf("PARTSTAT is required")
-	case a.cn == "":
-		return fmt.Errorf("CN is required")
+	case a.calAddress == "":
+		return fmt.Errorf("cal-address is required")
 	default:
 		return nil
 	}
@@ -130,6 +189,7 @@ func (a *Attendee) validate() error {
 //	    SetCuType(structured.AttendeeCutypeIndividual).
 //	    SetRole(structured.AttendeeRoleReq).
 //	    SetCn(structured.NewCommonName("Attendee Name", "attendee@example.com")).
+//	    SetCalAddress("mailto:attendee@example.com").
 //	    AddMember(structured.NewCommonName("Member Name", "member@example.com")).
 //	    AddDelegatedTo(structured.NewCommonName("Delegated To Name", "delegated@example.com")).
 //	    AddDelegatedFrom(structured.NewCommonName("Delegated From Name", "delegated@example.com")).
@@ -144,34 +204,43 @@ func (a *Attendee) ToIcal(writer func(string)) {
 		return
 	}
 
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("ATTENDEE;CN=%s", a.cn))
+	params := make([]utils.Param, 0)
+	addParam := func(name string, values ...AttendeeCommonName) {
+		param := utils.Param{Name: name}
+		for _, v := range values {
+			param.Values = append(param.Values, string(v))
+		}
+		params = append(params, param)
+	}
+	if a.cn != "" {
+		addParam("CN", a.cn)
+	}
 	if a.cuType != "" {
-		sb.WriteString(";CUTYPE=" + string(a.cuType))
+		addParam("CUTYPE", AttendeeCommonName(a.cuType))
 	}
 	if a.role != "" {
-		sb.WriteString(";ROLE=" + string(a.role))
+		addParam("ROLE", AttendeeCommonName(a.role))
 	}
 	if a.partStat != "" {
-		sb.WriteString(";PARTSTAT=" + string(a.partStat))
+		addParam("PARTSTAT", AttendeeCommonName(a.partStat))
 	}
 	if a.rsvp {
-		sb.WriteString(";RSVP=TRUE")
+		addParam("RSVP", "TRUE")
 	}
-	for _, m := range a.member {
-		sb.WriteString(";MEMBER=" + string(m))
+	if len(a.member) > 0 {
+		addParam("MEMBER", a.member...)
 	}
-	for _, d := range a.delegatedTo {
-		sb.WriteString(";DELEGATED-TO=" + string(d))
+	if len(a.delegatedTo) > 0 {
+		addParam("DELEGATED-TO", a.delegatedTo...)
 	}
-	for _, d := range a.delegatedFrom {
-		sb.WriteString(";DELEGATED-FROM=" + string(d))
+	if len(a.delegatedFrom) > 0 {
+		addParam("DELEGATED-FROM", a.delegatedFrom...)
 	}
 	if a.sentBy != "" {
-		sb.WriteString(";SENT-BY=" + string(a.sentBy))
+		addParam("SENT-BY", a.sentBy)
 	}
-	sb.WriteString("\n")
-	writer(sb.String())
+	params = append(params, a.customParams...)
+	writer(utils.JoinContentLine("ATTENDEE", params, a.calAddress) + "\n")
 }
 
 // Parse an iCalendar string into an Attendee{} struct. Example usage:
@@ -181,16 +250,21 @@ func (a *Attendee) ToIcal(writer func(string)) {
 //	    log.Fatal(err)
 //	}
 func (a *Attendee) FromIcal(data string) error {
-	data = strings.TrimPrefix(data, "ATTENDEE;")
-	slice := strings.Split(data, ";")
-	for _, s := range slice {
-		// split by =
-		parts := strings.SplitN(s, "=", 2)
-		if len(parts) != 2 {
-			a.customProperties = append(a.customProperties, s)
-			continue
-		}
-		key, value := parts[0], parts[1]
+	name, params, calAddress, err := utils.SplitContentLine(data)
+	if err != nil {
+		return err
+	}
+	if name != "ATTENDEE" {
+		return fmt.Errorf("not an ATTENDEE property: %s", name)
+	}
+	a.calAddress = strings.TrimSpace(calAddress)
+	// RFC5545 section 3.2 defaults, replies from most clients omit them
+	a.cuType = AttendeeCutypeIndividual
+	a.role = AttendeeRoleReq
+	a.partStat = AttendeePartStatNeedsAction
+
+	for _, param := range params {
+		key, value := param.Name, strings.Join(param.Values, ",")
 		switch key {
 		case "CN":
 			if value == "" {
@@ -239,21 +313,29 @@ func (a *Attendee) FromIcal(data string) error {
 				a.partStat = AttendeePartStatTentative
 			case "CANCELLED":
 				a.partStat = AttendeePartStatCancelled
+			case "DELEGATED":
+				a.partStat = AttendeePartStatDelegated
 			case "X-NAME":
 				a.partStat = AttendeePartStatXName
 			default:
 				return fmt.Errorf("invalid PARTSTAT: %s", value)
 			}
 		case "MEMBER":
-			a.member = append(a.member, AttendeeCommonName(value))
+			for _, v := range param.Values {
+				a.member = append(a.member, AttendeeCommonName(v))
+			}
 		case "DELEGATED-TO":
-			a.delegatedTo = append(a.delegatedTo, AttendeeCommonName(value))
+			for _, v := range param.Values {
+				a.delegatedTo = append(a.delegatedTo, AttendeeCommonName(v))
+			}
 		case "DELEGATED-FROM":
-			a.delegatedFrom = append(a.delegatedFrom, AttendeeCommonName(value))
+			for _, v := range param.Values {
+				a.delegatedFrom = append(a.delegatedFrom, AttendeeCommonName(v))
+			}
 		case "SENT-BY":
 			a.sentBy = AttendeeCommonName(value)
 		default:
-			a.customProperties = append(a.customProperties, fmt.Sprintf("%s=%s", key, value))
+			a.customParams = append(a.customParams, param)
 		}
 	}
 	if err := a.validate(); err != nil {
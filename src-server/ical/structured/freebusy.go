@@ -0,0 +1,125 @@
+package structured
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A time interval, as unix timestamps in UTC
+type Period struct {
+	Start int64
+	End   int64
+}
+
+// A VFREEBUSY component, only holding busy intervals so that nothing about the
+// events themselves is disclosed.
+type FreeBusy struct {
+	id        string
+	startDate int64
+	endDate   int64
+	busy      []Period
+}
+
+// Create a VFREEBUSY covering the given time range
+func NewFreeBusy(startDate int64, endDate int64) FreeBusy {
+	return FreeBusy{
+		id:        uuid.New().String(),
+		startDate: startDate,
+		endDate:   endDate,
+	}
+}
+
+// Get the free/busy UID
+func (fb *FreeBusy) GetID() string {
+	return fb.id
+}
+
+// Set the free/busy UID
+func (fb *FreeBusy) SetID(id string) *FreeBusy {
+	fb.id = id
+	return fb
+}
+
+// Get the start of the covered time range
+func (fb *FreeBusy) GetStartDate() int64 {
+	return fb.startDate
+}
+
+// Get the end of the covered time range
+func (fb *FreeBusy) GetEndDate() int64 {
+	return fb.endDate
+}
+
+// Mark a time interval as busy. The interval is clamped to the covered time
+// range, and merged with the overlapping or adjacent busy intervals.
+func (fb *FreeBusy) AddBusy(start int64, end int64) *FreeBusy {
+	start, end = max(start, fb.startDate), min(end, fb.endDate)
+	if start >= end {
+		return fb
+	}
+
+	busy := append(fb.busy, Period{Start: start, End: end})
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].Start < busy[j].Start
+	})
+	merged := busy[:1]
+	for _, period := range busy[1:] {
+		last := &merged[len(merged)-1]
+		if period.Start <= last.End {
+			last.End = max(last.End, period.End)
+			continue
+		}
+		merged = append(merged, period)
+	}
+	fb.busy = merged
+	return fb
+}
+
+// Get the busy intervals, sorted and non-overlapping
+func (fb *FreeBusy) GetBusy() []Period {
+	return fb.busy
+}
+
+func (fb *FreeBusy) Validate() error {
+	switch {
+	case fb.id == "":
+		return fmt.Errorf("UID is required")
+	case fb.startDate == 0 || fb.endDate == 0:
+		return fmt.Errorf("DTSTART and DTEND are required")
+	case fb.startDate >= fb.endDate:
+		return fmt.Errorf("DTSTART must be before DTEND")
+	default:
+		return nil
+	}
+}
+
+// Convert the free/busy into an iCalendar string. This method is intended to
+// be used internally only.
+func (fb *FreeBusy) ToIcal(writer func(string)) {
+	if err := fb.Validate(); err != nil {
+		slog.Warn("FreeBusy.ToIcal", "err", err)
+		return
+	}
+	formatDate := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).UTC().Format("20060102T150405Z")
+	}
+
+	writer("BEGIN:VFREEBUSY\n")
+	writer("UID:" + fb.id + "\n")
+	writer("DTSTAMP:" + formatDate(time.Now().Unix()) + "\n")
+	writer("DTSTART:" + formatDate(fb.startDate) + "\n")
+	writer("DTEND:" + formatDate(fb.endDate) + "\n")
+	if len(fb.busy) > 0 {
+		periods := make([]string, len(fb.busy))
+		for i, period := range fb.busy {
+			periods[i] = formatDate(period.Start) + "/" + formatDate(period.End)
+		}
+		writer("FREEBUSY;FBTYPE=BUSY:" + strings.Join(periods, ",") + "\n")
+	}
+	writer("END:VFREEBUSY\n")
+}
@@ -0,0 +1,720 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"towd/src-server/ical/utils"
+
+	"github.com/xyedo/rrule"
+)
+
+type (
+	TimezoneObservanceType string
+)
+
+var (
+	TimezoneObservanceStandard TimezoneObservanceType = "STANDARD"
+	TimezoneObservanceDaylight TimezoneObservanceType = "DAYLIGHT"
+)
+
+// A STANDARD or DAYLIGHT sub-component of a VTIMEZONE.
+type TimezoneObservance struct {
+	kind        TimezoneObservanceType
+	dtStart     time.Time // wall clock, stored as if it was UTC
+	offsetFrom  int       // seconds east of UTC
+	offsetTo    int       // seconds east of UTC
+	tzName      string
+	rruleString string
+	rDates      []time.Time // wall clock, stored as if it was UTC
+
+	customProperties []string
+}
+
+type Timezone struct {
+	tzid        string
+	observances []TimezoneObservance
+
+	customProperties []string
+
+	// built from the observances on first use, see Location
+	location *time.Location
+}
+
+func NewTimezone() Timezone {
+	return Timezone{}
+}
+
+func NewTimezoneObservance(kind TimezoneObservanceType) TimezoneObservance {
+	return TimezoneObservance{
+		kind: kind,
+	}
+}
+
+// Generate a VTIMEZONE from Go's tzdata, starting at the beginning of `from`'s
+// year. The transitions repeating every year on the same weekday of the same
+// month are written as yearly rules, bounded by an UNTIL once the zone stops
+// following them, so the VTIMEZONE also covers the recurrences going past
+// `to`. The other transitions get an observance each.
+func NewTimezoneFromLocation(loc *time.Location, from time.Time, to time.Time) Timezone {
+	tz := Timezone{tzid: loc.String()}
+
+	start := time.Date(from.UTC().Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	// scan past today as well, so the rules still followed are open-ended and
+	// the ones abandoned since `to` get their UNTIL
+	end := time.Date(max(to.UTC().Year(), time.Now().Year())+2, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	kindOf := func(t time.Time) TimezoneObservanceType {
+		if t.In(loc).IsDST() {
+			return TimezoneObservanceDaylight
+		}
+		return TimezoneObservanceStandard
+	}
+
+	name, offset := start.In(loc).Zone()
+	tz.observances = append(tz.observances, TimezoneObservance{
+		kind:       kindOf(start),
+		dtStart:    start.Add(time.Duration(offset) * time.Second),
+		offsetFrom: offset,
+		offsetTo:   offset,
+		tzName:     name,
+	})
+
+	// the transitions sharing everything but their year, one year apart
+	type run struct {
+		observance TimezoneObservance
+		key        string
+		last       time.Time // UTC
+		count      int
+	}
+	runs := make([]*run, 0)
+	for cursor := start; cursor.Before(end); cursor = cursor.Add(24 * time.Hour) {
+		next := cursor.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset == offset {
+			continue
+		}
+
+		// binary search for the first second having the new offset
+		lo, hi := cursor, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+			if _, midOffset := mid.In(loc).Zone(); midOffset == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		newName, newOffset := hi.In(loc).Zone()
+		observance := TimezoneObservance{
+			kind:       kindOf(hi),
+			dtStart:    hi.Add(time.Duration(offset) * time.Second),
+			offsetFrom: offset,
+			offsetTo:   newOffset,
+			tzName:     newName,
+		}
+		offset = newOffset
+
+		byDay := yearlyByDay(observance.dtStart)
+		key := fmt.Sprintf("%s %d %d %s %d %s %s", observance.kind, observance.offsetFrom, observance.offsetTo,
+			observance.tzName, observance.dtStart.Month(), byDay, observance.dtStart.Format("150405"))
+		extended := false
+		for _, r := range runs {
+			if r.key == key && r.last.Year()+1 == hi.Year() {
+				r.last = hi
+				r.count++
+				extended = true
+				break
+			}
+		}
+		if !extended {
+			runs = append(runs, &run{observance: observance, key: key, last: hi, count: 1})
+		}
+	}
+
+	for _, r := range runs {
+		if r.count > 1 {
+			r.observance.rruleString = fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s",
+				r.observance.dtStart.Month(), yearlyByDay(r.observance.dtStart))
+			// open-ended if still followed at the end of the scan
+			if r.last.Year() < end.Year()-1 {
+				r.observance.rruleString += ";UNTIL=" + r.last.Format("20060102T150405Z")
+			}
+		}
+		tz.observances = append(tz.observances, r.observance)
+	}
+
+	return tz
+}
+
+// Get the BYDAY of a yearly rule matching a date: its weekday, numbered from
+// the end of the month when it's the last one of the month, e.g. -1SU.
+func yearlyByDay(date time.Time) string {
+	weekday := strings.ToUpper(date.Weekday().String()[:2])
+	daysInMonth := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if date.Day()+7 > daysInMonth {
+		return "-1" + weekday
+	}
+	return fmt.Sprintf("%d%s", (date.Day()-1)/7+1, weekday)
+}
+
+// Get the timezone ID
+func (tz *Timezone) GetTzid() string {
+	return tz.tzid
+}
+
+// Set the timezone ID
+func (tz *Timezone) SetTzid(tzid string) *Timezone {
+	tz.tzid = tzid
+	return tz
+}
+
+// Add a STANDARD or DAYLIGHT observance to the timezone
+func (tz *Timezone) AddObservance(observance TimezoneObservance) *Timezone {
+	tz.observances = append(tz.observances, observance)
+	tz.location = nil
+	return tz
+}
+
+// Iterate over the observances and apply a function to each
+func (tz *Timezone) IterateObservances(fn func(observance *TimezoneObservance)) {
+	for i := range tz.observances {
+		fn(&tz.observances[i])
+	}
+}
+
+// Add an iCalendar property to the timezone.
+// Unhandled properties will be stored in the customProperties array.
+func (tz *Timezone) AddIcalProperty(property string) {
+	slice := strings.SplitN(property, ":", 2)
+	if len(slice) != 2 {
+		tz.customProperties = append(tz.customProperties, property)
+		return
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(slice[0]))
+	value := strings.TrimSpace(slice[1])
+
+	switch key {
+	case "TZID":
+		tz.tzid = value
+	default:
+		tz.customProperties = append(tz.customProperties, property)
+	}
+}
+
+func (tz *Timezone) Validate() error {
+	switch {
+	case tz.tzid == "":
+		return fmt.Errorf("TZID is required")
+	case len(tz.observances) == 0:
+		return fmt.Errorf("at least one STANDARD or DAYLIGHT block is required")
+	}
+	for _, observance := range tz.observances {
+		if err := observance.validate(); err != nil {
+			return fmt.Errorf("%s: %w", observance.kind, err)
+		}
+	}
+	return nil
+}
+
+// Convert a wall clock time, stored as if it was UTC, into a unix timestamp
+// using the offset of the observance in effect at that time.
+func (tz *Timezone) ToUnix(wallClock time.Time) (int64, error) {
+	if len(tz.observances) == 0 {
+		return 0, fmt.Errorf("timezone %s has no observance", tz.tzid)
+	}
+
+	var inEffect *TimezoneObservance
+	var latestOnset time.Time
+	for i := range tz.observances {
+		onset, err := tz.observances[i].lastOnset(wallClock)
+		if err != nil {
+			return 0, err
+		}
+		if !onset.IsZero() && (inEffect == nil || onset.After(latestOnset)) {
+			inEffect = &tz.observances[i]
+			latestOnset = onset
+		}
+	}
+
+	// before the first onset, the offset is the one the earliest observance
+	// is transitioning from
+	offset := 0
+	if inEffect != nil {
+		offset = inEffect.offsetTo
+	} else {
+		earliest := tz.observances[0]
+		for _, observance := range tz.observances[1:] {
+			if observance.dtStart.Before(earliest.dtStart) {
+				earliest = observance
+			}
+		}
+		offset = earliest.offsetFrom
+	}
+
+	return wallClock.Unix() - int64(offset), nil
+}
+
+// Get the location the timezone describes, so that Go computes the local
+// times, e.g. the dates of a recurrence rule, the way the VTIMEZONE does. The
+// onsets of the observances are written out as transitions until the last
+// change of rules, the yearly rules in use after it are turned into a POSIX
+// TZ string covering the following years.
+func (tz *Timezone) Location() (*time.Location, error) {
+	if tz.location != nil {
+		return tz.location, nil
+	}
+	if err := tz.Validate(); err != nil {
+		return nil, fmt.Errorf("(*Timezone).Location: %w", err)
+	}
+
+	// the rules still in use after the last change, e.g. the latest DTSTART
+	openRules := make([]*TimezoneObservance, 0)
+	lastChange := time.Time{}
+	for i := range tz.observances {
+		observance := &tz.observances[i]
+		if observance.dtStart.After(lastChange) {
+			lastChange = observance.dtStart
+		}
+		for _, rDate := range observance.rDates {
+			if rDate.After(lastChange) {
+				lastChange = rDate
+			}
+		}
+		if observance.rruleString == "" {
+			continue
+		}
+		option, err := observance.option()
+		if err != nil {
+			return nil, fmt.Errorf("(*Timezone).Location: %w", err)
+		}
+		switch {
+		case option.Count == 0 && option.Until.IsZero():
+			openRules = append(openRules, observance)
+		case option.Count == 0:
+			if option.Until.After(lastChange) {
+				lastChange = option.Until
+			}
+		default:
+			rule, err := rrule.NewRRule(*option)
+			if err != nil {
+				return nil, fmt.Errorf("(*Timezone).Location: invalid RRULE: %w", err)
+			}
+			if onsets := rule.All(); len(onsets) > 0 && onsets[len(onsets)-1].After(lastChange) {
+				lastChange = onsets[len(onsets)-1]
+			}
+		}
+	}
+	footer, ok := posixTZ(openRules)
+	end := time.Date(lastChange.Year()+2, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if !ok {
+		// Go can't follow the rules on its own, write their onsets out
+		// until long after any event
+		end = time.Date(max(end.Year(), 2100), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// the local time types: the one in use before the first onset, then one
+	// per name, offset and DST flag
+	type localTimeType struct {
+		offset int
+		isDST  bool
+		name   string
+	}
+	types := make([]localTimeType, 0)
+	typeIndex := func(typ localTimeType) int {
+		for i, other := range types[1:] {
+			if other == typ {
+				return i + 1
+			}
+		}
+		types = append(types, typ)
+		return len(types) - 1
+	}
+	observanceType := func(observance *TimezoneObservance) localTimeType {
+		name := observance.tzName
+		if name == "" {
+			name = utils.Seconds2UTCOffset(observance.offsetTo)
+		}
+		return localTimeType{observance.offsetTo, observance.kind == TimezoneObservanceDaylight, name}
+	}
+
+	type transition struct {
+		when      int64
+		typeIndex int
+	}
+	transitions := make([]transition, 0)
+	earliest := &tz.observances[0]
+	for i := range tz.observances {
+		if tz.observances[i].dtStart.Before(earliest.dtStart) {
+			earliest = &tz.observances[i]
+		}
+	}
+	before := localTimeType{earliest.offsetFrom, false, utils.Seconds2UTCOffset(earliest.offsetFrom)}
+	for i := range tz.observances {
+		if tz.observances[i].offsetTo == earliest.offsetFrom {
+			before = observanceType(&tz.observances[i])
+			break
+		}
+	}
+	types = append(types, before)
+	for i := range tz.observances {
+		observance := &tz.observances[i]
+		onsets, err := observance.onsetsUntil(end)
+		if err != nil {
+			return nil, fmt.Errorf("(*Timezone).Location: %w", err)
+		}
+		index := typeIndex(observanceType(observance))
+		for _, onset := range onsets {
+			transitions = append(transitions, transition{onset.Unix() - int64(observance.offsetFrom), index})
+		}
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].when < transitions[j].when
+	})
+
+	// TZif version 2 (RFC8536), the 32-bit block is left empty as Go only
+	// reads the 64-bit one
+	var abbreviations bytes.Buffer
+	nameIndexes := make(map[string]int)
+	for _, typ := range types {
+		if _, ok := nameIndexes[typ.name]; !ok {
+			nameIndexes[typ.name] = abbreviations.Len()
+			abbreviations.WriteString(typ.name + "\x00")
+		}
+	}
+	var data bytes.Buffer
+	writeHeader := func(timeCount int, typeCount int, charCount int) {
+		data.WriteString("TZif2")
+		data.Write(make([]byte, 15))
+		for _, count := range []int{0, 0, 0, timeCount, typeCount, charCount} {
+			binary.Write(&data, binary.BigEndian, uint32(count))
+		}
+	}
+	writeHeader(0, 0, 0)
+	writeHeader(len(transitions), len(types), abbreviations.Len())
+	for _, transition := range transitions {
+		binary.Write(&data, binary.BigEndian, transition.when)
+	}
+	for _, transition := range transitions {
+		data.WriteByte(byte(transition.typeIndex))
+	}
+	for _, typ := range types {
+		binary.Write(&data, binary.BigEndian, int32(typ.offset))
+		if typ.isDST {
+			data.WriteByte(1)
+		} else {
+			data.WriteByte(0)
+		}
+		data.WriteByte(byte(nameIndexes[typ.name]))
+	}
+	data.Write(abbreviations.Bytes())
+	data.WriteString("\n" + footer + "\n")
+
+	location, err := time.LoadLocationFromTZData(tz.tzid, data.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("(*Timezone).Location: %w", err)
+	}
+	tz.location = location
+	return location, nil
+}
+
+// The names POSIX TZ strings accept without quoting them
+var posixNamePattern = regexp.MustCompile(`^[A-Za-z]{3,}$`)
+
+// Turn the yearly rules of a STANDARD and a DAYLIGHT observance into a POSIX
+// TZ string, e.g. CET-1CEST,M3.5.0/2,M10.5.0/3. No rule needs no string, the
+// other rules can't be turned into one.
+func posixTZ(rules []*TimezoneObservance) (string, bool) {
+	if len(rules) == 0 {
+		return "", true
+	}
+	if len(rules) != 2 || rules[0].kind == rules[1].kind {
+		return "", false
+	}
+	standard, daylight := rules[0], rules[1]
+	if standard.kind == TimezoneObservanceDaylight {
+		standard, daylight = daylight, standard
+	}
+
+	name := func(observance *TimezoneObservance) string {
+		if posixNamePattern.MatchString(observance.tzName) {
+			return observance.tzName
+		}
+		return "<" + utils.Seconds2UTCOffset(observance.offsetTo) + ">"
+	}
+	// POSIX offsets are west of UTC
+	offset := func(observance *TimezoneObservance) string {
+		seconds := -observance.offsetTo
+		sign := ""
+		if seconds < 0 {
+			sign = "-"
+			seconds = -seconds
+		}
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, seconds/3600, seconds%3600/60, seconds%60)
+	}
+	// e.g. M3.5.0/2:00:00 for the last Sunday of March at 02:00
+	date := func(observance *TimezoneObservance) (string, bool) {
+		option, err := rrule.StrToROption(observance.rruleString)
+		if err != nil || option.Freq != rrule.YEARLY || option.Interval > 1 ||
+			len(option.Bymonth) != 1 || len(option.Byweekday) != 1 ||
+			len(option.Bysetpos) != 0 || len(option.Bymonthday) != 0 || len(option.Byyearday) != 0 ||
+			len(option.Byweekno) != 0 || len(option.Byhour) != 0 || len(option.Byminute) != 0 ||
+			len(option.Bysecond) != 0 || len(option.Byeaster) != 0 {
+			return "", false
+		}
+		week := option.Byweekday[0].N()
+		switch {
+		case week == -1:
+			week = 5
+		case week < 1 || week > 4:
+			return "", false
+		}
+		clock := observance.dtStart
+		return fmt.Sprintf("M%d.%d.%d/%d:%02d:%02d", option.Bymonth[0], week, (option.Byweekday[0].Day()+1)%7,
+			clock.Hour(), clock.Minute(), clock.Second()), true
+	}
+	start, ok := date(daylight)
+	if !ok {
+		return "", false
+	}
+	end, ok := date(standard)
+	if !ok {
+		return "", false
+	}
+	return name(standard) + offset(standard) + name(daylight) + offset(daylight) + "," + start + "," + end, true
+}
+
+// Convert the timezone into an iCalendar string. This method is intended to be
+// used internally only.
+func (tz *Timezone) ToIcal(writer func(string)) {
+	if err := tz.Validate(); err != nil {
+		slog.Warn("Timezone.ToIcal", "err", err)
+		return
+	}
+
+	writer("BEGIN:VTIMEZONE\n")
+	writer("TZID:" + tz.tzid + "\n")
+	for _, customProperty := range tz.customProperties {
+		writer(customProperty + "\n")
+	}
+	for _, observance := range tz.observances {
+		observance.ToIcal(writer)
+	}
+	writer("END:VTIMEZONE\n")
+}
+
+// Get the observance type, STANDARD or DAYLIGHT
+func (o *TimezoneObservance) GetKind() TimezoneObservanceType {
+	return o.kind
+}
+
+// Get the observance onset, as a wall clock time stored as if it was UTC
+func (o *TimezoneObservance) GetDtStart() time.Time {
+	return o.dtStart
+}
+
+// Get the offset in use before the onset, in seconds east of UTC
+func (o *TimezoneObservance) GetOffsetFrom() int {
+	return o.offsetFrom
+}
+
+// Get the offset in use after the onset, in seconds east of UTC
+func (o *TimezoneObservance) GetOffsetTo() int {
+	return o.offsetTo
+}
+
+// Get the observance name, e.g. CEST
+func (o *TimezoneObservance) GetTzName() string {
+	return o.tzName
+}
+
+// Get the observance recurrence rule
+func (o *TimezoneObservance) GetRRule() string {
+	return o.rruleString
+}
+
+// Get the observance recurrence dates
+func (o *TimezoneObservance) GetRDates() []time.Time {
+	return o.rDates
+}
+
+// Add an iCalendar property to the observance.
+// Unhandled properties will be stored in the customProperties array.
+func (o *TimezoneObservance) AddIcalProperty(property string) error {
+	slice := strings.SplitN(property, ":", 2)
+	if len(slice) != 2 {
+		o.customProperties = append(o.customProperties, property)
+		return nil
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(slice[0]))
+	if i := strings.Index(key, ";"); i != -1 {
+		key = key[:i]
+	}
+	value := strings.TrimSpace(slice[1])
+
+	switch key {
+	case "DTSTART":
+		dtStart, err := time.Parse("20060102T150405", value)
+		if err != nil {
+			return fmt.Errorf("invalid DTSTART: %w", err)
+		}
+		o.dtStart = dtStart
+	case "TZOFFSETFROM":
+		offset, err := utils.UTCOffset2Seconds(value)
+		if err != nil {
+			return fmt.Errorf("invalid TZOFFSETFROM: %w", err)
+		}
+		o.offsetFrom = offset
+	case "TZOFFSETTO":
+		offset, err := utils.UTCOffset2Seconds(value)
+		if err != nil {
+			return fmt.Errorf("invalid TZOFFSETTO: %w", err)
+		}
+		o.offsetTo = offset
+	case "TZNAME":
+		o.tzName = utils.UnescapeText(value)
+	case "RRULE":
+		if _, err := rrule.StrToROption(value); err != nil {
+			return fmt.Errorf("invalid RRULE: %w", err)
+		}
+		o.rruleString = value
+	case "RDATE":
+		for _, rawDate := range strings.Split(value, ",") {
+			rDate, err := time.Parse("20060102T150405", rawDate)
+			if err != nil {
+				return fmt.Errorf("invalid RDATE: %w", err)
+			}
+			o.rDates = append(o.rDates, rDate)
+		}
+	default:
+		o.customProperties = append(o.customProperties, property)
+	}
+	return nil
+}
+
+func (o *TimezoneObservance) validate() error {
+	switch {
+	case o.kind != TimezoneObservanceStandard && o.kind != TimezoneObservanceDaylight:
+		return fmt.Errorf("observance must be STANDARD or DAYLIGHT")
+	case o.dtStart.IsZero():
+		return fmt.Errorf("DTSTART is required")
+	default:
+		return nil
+	}
+}
+
+// Get the latest onset of the observance at or before the given wall clock
+// time, or the zero time if the observance hasn't started yet.
+func (o *TimezoneObservance) lastOnset(wallClock time.Time) (time.Time, error) {
+	if o.dtStart.After(wallClock) {
+		return time.Time{}, nil
+	}
+	latest := o.dtStart
+
+	if o.rruleString != "" {
+		option, err := o.option()
+		if err != nil {
+			return time.Time{}, err
+		}
+		// yearly rules only depend on the month, day and time of DTSTART, so
+		// skip the years we don't care about (Outlook uses DTSTART:1601...)
+		if option.Freq == rrule.YEARLY && option.Count == 0 && option.Interval <= 1 &&
+			wallClock.Year()-1 > o.dtStart.Year() {
+			option.Dtstart = o.dtStart.AddDate(wallClock.Year()-1-o.dtStart.Year(), 0, 0)
+		}
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid RRULE: %w", err)
+		}
+		if onset := rule.Before(wallClock, true); onset.After(latest) {
+			latest = onset
+		}
+	}
+	for _, rDate := range o.rDates {
+		if !rDate.After(wallClock) && rDate.After(latest) {
+			latest = rDate
+		}
+	}
+
+	return latest, nil
+}
+
+var untilUTCPattern = regexp.MustCompile(`(?i)UNTIL=\d{8}T\d{6}Z`)
+
+// Get the options of the recurrence rule of the observance. Its dates are wall
+// clock times stored as if they were UTC, like DTSTART, so a UTC UNTIL is
+// moved to the wall clock time it stands for.
+func (o *TimezoneObservance) option() (*rrule.ROption, error) {
+	option, err := rrule.StrToROption(o.rruleString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRULE: %w", err)
+	}
+	option.Dtstart = o.dtStart
+	if untilUTCPattern.MatchString(o.rruleString) {
+		option.Until = option.Until.Add(time.Duration(o.offsetFrom) * time.Second)
+	}
+	return option, nil
+}
+
+// Get the onsets of the observance up to the given wall clock time, sorted
+func (o *TimezoneObservance) onsetsUntil(end time.Time) ([]time.Time, error) {
+	onsets := make([]time.Time, 0)
+	if o.dtStart.After(end) {
+		return onsets, nil
+	}
+	onsets = append(onsets, o.dtStart)
+	if o.rruleString != "" {
+		option, err := o.option()
+		if err != nil {
+			return nil, err
+		}
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE: %w", err)
+		}
+		onsets = append(onsets, rule.Between(o.dtStart, end, false)...)
+	}
+	for _, rDate := range o.rDates {
+		if !rDate.After(end) && !rDate.Equal(o.dtStart) {
+			onsets = append(onsets, rDate)
+		}
+	}
+	sort.Slice(onsets, func(i, j int) bool {
+		return onsets[i].Before(onsets[j])
+	})
+	return onsets, nil
+}
+
+// Convert the observance into an iCalendar string. This method is intended to
+// be used internally only.
+func (o *TimezoneObservance) ToIcal(writer func(string)) {
+	writer("BEGIN:" + string(o.kind) + "\n")
+	writer("DTSTART:" + o.dtStart.Format("20060102T150405") + "\n")
+	writer("TZOFFSETFROM:" + utils.Seconds2UTCOffset(o.offsetFrom) + "\n")
+	writer("TZOFFSETTO:" + utils.Seconds2UTCOffset(o.offsetTo) + "\n")
+	if o.tzName != "" {
+		writer("TZNAME:" + utils.EscapeText(o.tzName) + "\n")
+	}
+	if o.rruleString != "" {
+		writer("RRULE:" + o.rruleString + "\n")
+	}
+	if len(o.rDates) > 0 {
+		rDates := make([]string, len(o.rDates))
+		for i, rDate := range o.rDates {
+			rDates[i] = rDate.Format("20060102T150405")
+		}
+		writer("RDATE:" + strings.Join(rDates, ",") + "\n")
+	}
+	for _, customProperty := range o.customProperties {
+		writer(customProperty + "\n")
+	}
+	writer("END:" + string(o.kind) + "\n")
+}
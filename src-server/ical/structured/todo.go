@@ -0,0 +1,283 @@
+package structured
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"towd/src-server/ical/utils"
+
+	"github.com/google/uuid"
+)
+
+type (
+	TodoStatus string
+)
+
+var (
+	TodoStatusNeedsAction TodoStatus = "NEEDS-ACTION"
+	TodoStatusInProcess   TodoStatus = "IN-PROCESS"
+	TodoStatusCompleted   TodoStatus = "COMPLETED"
+	TodoStatusCancelled   TodoStatus = "CANCELLED"
+)
+
+// A VTODO component. All dates are unix timestamps in UTC, 0 when unset.
+type Todo struct {
+	id              string
+	summary         string
+	description     string
+	startDate       int64
+	due             int64
+	completed       int64
+	status          TodoStatus
+	priority        int // 0 = undefined, 1 = highest, 9 = lowest
+	percentComplete int
+	sequence        int
+	alarm           []Alarm
+
+	tzidResolver     utils.TzidResolver
+	customProperties []string
+}
+
+func NewTodo() Todo {
+	return Todo{
+		id: uuid.New().String(),
+	}
+}
+
+// Get the todo UID
+func (t *Todo) GetID() string {
+	return t.id
+}
+
+// Set the todo UID
+func (t *Todo) SetID(id string) *Todo {
+	t.id = id
+	return t
+}
+
+// Get the todo summary
+func (t *Todo) GetSummary() string {
+	return t.summary
+}
+
+// Set the todo summary
+func (t *Todo) SetSummary(summary string) *Todo {
+	t.summary = summary
+	return t
+}
+
+// Get the todo description
+func (t *Todo) GetDescription() string {
+	return t.description
+}
+
+// Set the todo description
+func (t *Todo) SetDescription(description string) *Todo {
+	t.description = description
+	return t
+}
+
+// Get the todo start date
+func (t *Todo) GetStartDate() int64 {
+	return t.startDate
+}
+
+// Set the todo start date
+func (t *Todo) SetStartDate(startDate int64) *Todo {
+	t.startDate = startDate
+	return t
+}
+
+// Get the todo due date
+func (t *Todo) GetDue() int64 {
+	return t.due
+}
+
+// Set the todo due date
+func (t *Todo) SetDue(due int64) *Todo {
+	t.due = due
+	return t
+}
+
+// Get the date the todo was completed at
+func (t *Todo) GetCompleted() int64 {
+	return t.completed
+}
+
+// Set the date the todo was completed at
+func (t *Todo) SetCompleted(completed int64) *Todo {
+	t.completed = completed
+	return t
+}
+
+// Get the todo status
+func (t *Todo) GetStatus() TodoStatus {
+	return t.status
+}
+
+// Set the todo status
+func (t *Todo) SetStatus(status TodoStatus) *Todo {
+	t.status = status
+	return t
+}
+
+// Get the todo priority, 0 if undefined
+func (t *Todo) GetPriority() int {
+	return t.priority
+}
+
+// Set the todo priority, 0 if undefined
+func (t *Todo) SetPriority(priority int) *Todo {
+	t.priority = priority
+	return t
+}
+
+// Get the todo completion percentage
+func (t *Todo) GetPercentComplete() int {
+	return t.percentComplete
+}
+
+// Set the todo completion percentage
+func (t *Todo) SetPercentComplete(percentComplete int) *Todo {
+	t.percentComplete = percentComplete
+	return t
+}
+
+// Add an alarm to the todo
+func (t *Todo) AddAlarm(alarm Alarm) *Todo {
+	t.alarm = append(t.alarm, alarm)
+	return t
+}
+
+// Set the resolver used for TZIDs unknown to the IANA database
+func (t *Todo) SetTzidResolver(resolver utils.TzidResolver) *Todo {
+	t.tzidResolver = resolver
+	return t
+}
+
+// Add an iCalendar property to the todo.
+// Unhandled properties will be stored in the customProperties array.
+func (t *Todo) AddIcalProperty(property string) error {
+	slice := strings.SplitN(property, ":", 2)
+	if len(slice) != 2 {
+		t.customProperties = append(t.customProperties, property)
+		return nil
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(strings.SplitN(slice[0], ";", 2)[0]))
+	value := strings.TrimSpace(slice[1])
+
+	switch key {
+	case "UID":
+		t.id = value
+	case "SUMMARY":
+		t.summary = utils.UnescapeText(value)
+	case "DESCRIPTION":
+		t.description = utils.UnescapeText(value)
+	case "DTSTART", "DUE", "COMPLETED":
+		parsedDate, err := utils.Datetime2Unix(property, t.tzidResolver)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		switch key {
+		case "DTSTART":
+			t.startDate = parsedDate
+		case "DUE":
+			t.due = parsedDate
+		case "COMPLETED":
+			t.completed = parsedDate
+		}
+	case "STATUS":
+		switch status := TodoStatus(strings.ToUpper(value)); status {
+		case TodoStatusNeedsAction, TodoStatusInProcess, TodoStatusCompleted, TodoStatusCancelled:
+			t.status = status
+		default:
+			return fmt.Errorf("invalid STATUS: %s", value)
+		}
+	case "PRIORITY":
+		priority, err := strconv.Atoi(value)
+		if err != nil || priority < 0 || priority > 9 {
+			return fmt.Errorf("invalid PRIORITY: %s", value)
+		}
+		t.priority = priority
+	case "PERCENT-COMPLETE":
+		percentComplete, err := strconv.Atoi(value)
+		if err != nil || percentComplete < 0 || percentComplete > 100 {
+			return fmt.Errorf("invalid PERCENT-COMPLETE: %s", value)
+		}
+		t.percentComplete = percentComplete
+	case "SEQUENCE":
+		sequence, err := strconv.Atoi(value)
+		if err != nil || sequence < 0 {
+			return fmt.Errorf("invalid SEQUENCE: %s", value)
+		}
+		t.sequence = sequence
+	case "DTSTAMP":
+	default:
+		t.customProperties = append(t.customProperties, property)
+	}
+	return nil
+}
+
+func (t *Todo) Validate() error {
+	switch {
+	case t.id == "":
+		return fmt.Errorf("UID is required")
+	case t.startDate != 0 && t.due != 0 && t.startDate > t.due:
+		return fmt.Errorf("DTSTART must be before DUE")
+	default:
+		return nil
+	}
+}
+
+// Convert the todo into an iCalendar string. This method is intended to be
+// used internally only.
+func (t *Todo) ToIcal(writer func(string)) {
+	if err := t.Validate(); err != nil {
+		slog.Warn("Todo.ToIcal", "err", err)
+		return
+	}
+	formatDate := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).UTC().Format("20060102T150405Z")
+	}
+
+	writer("BEGIN:VTODO\n")
+	writer("UID:" + t.id + "\n")
+	writer("DTSTAMP:" + formatDate(time.Now().Unix()) + "\n")
+	if t.summary != "" {
+		writer("SUMMARY:" + utils.EscapeText(t.summary) + "\n")
+	}
+	if t.description != "" {
+		writer("DESCRIPTION:" + utils.EscapeText(t.description) + "\n")
+	}
+	if t.startDate != 0 {
+		writer("DTSTART:" + formatDate(t.startDate) + "\n")
+	}
+	if t.due != 0 {
+		writer("DUE:" + formatDate(t.due) + "\n")
+	}
+	if t.completed != 0 {
+		writer("COMPLETED:" + formatDate(t.completed) + "\n")
+	}
+	if t.status != "" {
+		writer("STATUS:" + string(t.status) + "\n")
+	}
+	if t.priority != 0 {
+		writer("PRIORITY:" + strconv.Itoa(t.priority) + "\n")
+	}
+	if t.percentComplete != 0 {
+		writer("PERCENT-COMPLETE:" + strconv.Itoa(t.percentComplete) + "\n")
+	}
+	if t.sequence > 0 {
+		writer("SEQUENCE:" + strconv.Itoa(t.sequence) + "\n")
+	}
+	for _, customProperty := range t.customProperties {
+		writer(customProperty + "\n")
+	}
+	for _, alarm := range t.alarm {
+		alarm.ToIcal(writer)
+	}
+	writer("END:VTODO\n")
+}
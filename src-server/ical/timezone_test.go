@@ -0,0 +1,154 @@
+package ical
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"towd/src-server/ical/structured"
+)
+
+// An Outlook series in a TZID only its VTIMEZONE defines, crossing the change
+// to summer time, with an instance moved after it.
+const outlookDSTCalendar = `BEGIN:VCALENDAR
+PRODID:-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN
+VERSION:2.0
+METHOD:PUBLISH
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:weekly@example.com
+RRULE:FREQ=WEEKLY;COUNT=5;BYDAY=MO
+SUMMARY:Weekly
+DTSTART;TZID=W. Europe Standard Time:20250317T090000
+DTEND;TZID=W. Europe Standard Time:20250317T093000
+DTSTAMP:20250301T000000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250407T090000
+SUMMARY:Weekly (late)
+DTSTART;TZID=W. Europe Standard Time:20250407T110000
+DTEND;TZID=W. Europe Standard Time:20250407T113000
+DTSTAMP:20250301T000000Z
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestVTimezoneDefinedTzid(t *testing.T) {
+	want := []string{
+		"2025-03-17 08:00 Weekly",
+		"2025-03-24 08:00 Weekly",
+		"2025-03-31 07:00 Weekly",
+		"2025-04-07 09:00 Weekly (late)",
+		"2025-04-14 07:00 Weekly",
+	}
+	occurrences := func(cal *Calendar) []string {
+		occurrences := make([]string, 0)
+		next := cal.ExpandBetween(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+		for occurrence, ok := next(); ok; occurrence, ok = next() {
+			occurrences = append(occurrences, time.Unix(occurrence.StartDate, 0).UTC().Format("2006-01-02 15:04")+" "+occurrence.Info.GetSummary())
+		}
+		return occurrences
+	}
+
+	input := strings.ReplaceAll(outlookDSTCalendar, "\n", "\r\n")
+	cal, diagnostics, customErr := Parse(context.Background(), strings.NewReader(input), ParseOptions{Strict: true})
+	if customErr != nil {
+		t.Fatalf("Parse: %s", customErr)
+	}
+	if errorCount := CountDiagnostics(diagnostics, DiagnosticSeverityError); errorCount > 0 {
+		t.Fatalf("Parse: %d errors: %v", errorCount, diagnostics)
+	}
+	if got := occurrences(cal); !slices.Equal(got, want) {
+		t.Errorf("occurrences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the export keeps the TZID and the VTIMEZONE defining it
+	var output bytes.Buffer
+	if err := cal.ToIcal(&output); err != nil {
+		t.Fatalf("ToIcal: %s", err)
+	}
+	exported := strings.ReplaceAll(output.String(), "\r\n ", "")
+	for _, line := range []string{
+		"DTSTART;TZID=W. Europe Standard Time:20250317T090000",
+		"RECURRENCE-ID;TZID=W. Europe Standard Time:20250407T090000",
+		"TZID:W. Europe Standard Time",
+		"RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3",
+	} {
+		if !strings.Contains(exported, line+"\r\n") {
+			t.Errorf("export lacks %q:\n%s", line, exported)
+		}
+	}
+
+	reparsed, _, customErr := Parse(context.Background(), &output, ParseOptions{Strict: true})
+	if customErr != nil {
+		t.Fatalf("Parse export: %s", customErr)
+	}
+	if got := occurrences(reparsed); !slices.Equal(got, want) {
+		t.Errorf("occurrences after export:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// The VTIMEZONEs generated for the events keep matching Go's tzdata long after
+// the event's first occurrence, through the zone's rule changes.
+func TestTimezoneFromLocation(t *testing.T) {
+	tests := []struct {
+		tzid        string
+		from        time.Time
+		observances int
+	}{
+		{tzid: "Europe/Berlin", from: time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC), observances: 3},
+		// the US rules changed in 2007
+		{tzid: "America/New_York", from: time.Date(2000, 1, 3, 14, 0, 0, 0, time.UTC), observances: 5},
+		{tzid: "Australia/Sydney", from: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+		// stopped observing summer time in 2016 and 2019
+		{tzid: "Europe/Istanbul", from: time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{tzid: "America/Sao_Paulo", from: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{tzid: "Asia/Tokyo", from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), observances: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tzid, func(t *testing.T) {
+			want, err := time.LoadLocation(tt.tzid)
+			if err != nil {
+				t.Fatalf("LoadLocation: %s", err)
+			}
+			tz := structured.NewTimezoneFromLocation(want, tt.from, tt.from)
+			var sb strings.Builder
+			tz.ToIcal(func(line string) {
+				sb.WriteString(line)
+			})
+			if observances := strings.Count(sb.String(), "BEGIN:STANDARD") + strings.Count(sb.String(), "BEGIN:DAYLIGHT"); tt.observances > 0 && observances != tt.observances {
+				t.Errorf("%d observances, want %d:\n%s", observances, tt.observances, sb.String())
+			}
+
+			got, err := tz.Location()
+			if err != nil {
+				t.Fatalf("Location: %s\n%s", err, sb.String())
+			}
+			end := time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)
+			for instant := tt.from; instant.Before(end); instant = instant.Add(time.Hour) {
+				_, gotOffset := instant.In(got).Zone()
+				_, wantOffset := instant.In(want).Zone()
+				if gotOffset != wantOffset {
+					t.Fatalf("offset at %s is %d, want %d:\n%s", instant, gotOffset, wantOffset, sb.String())
+				}
+			}
+		})
+	}
+}
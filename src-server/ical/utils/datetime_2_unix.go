@@ -13,61 +13,124 @@ var (
 	UTCTimePattern   = regexp.MustCompile(`^\d{4}\d{2}\d{2}T\d{2}\d{2}\d{2}Z$`)
 )
 
+// The type of a date-time value (RFC5545 sections 3.3.4 and 3.3.5). The DATE
+// and floating values don't depend on any timezone, so they are stored as if
+// they were in UTC: a DATE at midnight UTC, a floating date-time at its wall
+// clock time in UTC.
+type DateKind string
+
+const (
+	DateKindUTC      DateKind = ""         // e.g. 20220101T100000Z
+	DateKindTzid     DateKind = "TZID"     // e.g. TZID=Europe/Paris:20220101T100000
+	DateKindFloating DateKind = "FLOATING" // e.g. 20220101T100000, the same wall clock time everywhere
+	DateKindDate     DateKind = "DATE"     // e.g. VALUE=DATE:20220101, a whole day
+)
+
+// Resolve a TZID declared outside of the IANA database, e.g. by a VTIMEZONE
+// block in the same calendar. `wallClock` holds the local date-time as if it
+// was UTC. Returns false if the TZID is unknown to the resolver.
+type TzidResolver func(tzid string, wallClock time.Time) (int64, bool)
+
 // Parsing fields containing date-time values. For example:
 //   - DTSTART;TZID=Europe/Paris:20220101T000000
 //   - END:20220101T000000Z
 //
 // `DTSTART`, `DTEND` will be ignored; If the datetime doesn't have a postfix "Z"
-//   - if TZID is present, it will be used to parse the datetime
-//   - otherwise, the datetime will be parsed in the local timezone
+//   - if TZID is present, the resolvers are tried first, then the IANA database
+//   - otherwise, it's a floating date-time, parsed as if it was in UTC
 //
 // else, the datetime will be parsed in UTC
-func Datetime2Unix(rawText string) (int64, error) {
-	slice := strings.SplitN(rawText, ":", 2)
-	if len(slice) != 2 {
-		return 0, fmt.Errorf("must be splitable by ':', got %s", rawText)
+func Datetime2Unix(rawText string, resolvers ...TzidResolver) (int64, error) {
+	unixTime, _, err := ParseDatetime(rawText, resolvers...)
+	return unixTime, err
+}
+
+// Same as Datetime2Unix, along with the type of the value
+func ParseDatetime(rawText string, resolvers ...TzidResolver) (int64, DateKind, error) {
+	unixTimes, kind, err := ParseDatetimeList(rawText, resolvers...)
+	if err != nil {
+		return 0, kind, err
+	}
+	if len(unixTimes) != 1 {
+		return 0, kind, fmt.Errorf("expected a single date-time, got %d", len(unixTimes))
+	}
+	return unixTimes[0], kind, nil
+}
+
+// Parse a field holding a comma-separated list of date-time values, e.g.
+// EXDATE:20220101T100000Z,20220108T100000Z, see Datetime2Unix. All the values
+// have the same type.
+func ParseDatetimeList(rawText string, resolvers ...TzidResolver) ([]int64, DateKind, error) {
+	_, params, value, err := SplitContentLine(rawText)
+	if err != nil {
+		return nil, DateKindUTC, err
+	}
+	tzid := ""
+	for _, param := range params {
+		if param.Name == "TZID" && len(param.Values) > 0 {
+			tzid = param.Values[0]
+		}
 	}
 
-	firstPart := slice[0]
-	timePart := slice[1]
+	unixTimes := make([]int64, 0, 1)
+	kind := DateKindUTC
+	for i, timePart := range strings.Split(value, ",") {
+		unixTime, valueKind, err := parseDatetimeValue(strings.TrimSpace(timePart), tzid, resolvers)
+		if err != nil {
+			return nil, valueKind, err
+		}
+		if i > 0 && valueKind != kind {
+			return nil, kind, fmt.Errorf("mixed date-time types: %s and %s", kind, valueKind)
+		}
+		unixTimes = append(unixTimes, unixTime)
+		kind = valueKind
+	}
+	return unixTimes, kind, nil
+}
 
+func parseDatetimeValue(timePart string, tzidString string, resolvers []TzidResolver) (int64, DateKind, error) {
 	switch {
 	case datePattern.MatchString(timePart):
 		result, err := time.Parse("20060102", timePart)
 		if err != nil {
-			return 0, err
+			return 0, DateKindDate, err
 		}
-		return result.UTC().Unix(), nil
+		return result.UTC().Unix(), DateKindDate, nil
+	case localTimePattern.MatchString(timePart) && tzidString == "":
+		result, err := time.Parse("20060102T150405", timePart)
+		if err != nil {
+			return 0, DateKindFloating, err
+		}
+		return result.UTC().Unix(), DateKindFloating, nil
 	case localTimePattern.MatchString(timePart):
-		tzidString := func() string {
-			for _, prop := range strings.Split(firstPart, ";") {
-				if parts := strings.SplitN(prop, "=", 2); len(parts) == 2 {
-					if parts[0] == "TZID" {
-						return parts[1]
-					}
-				}
+		wallClock, err := time.Parse("20060102T150405", timePart)
+		if err != nil {
+			return 0, DateKindTzid, err
+		}
+		for _, resolver := range resolvers {
+			if resolver == nil {
+				continue
+			}
+			if result, ok := resolver(tzidString, wallClock); ok {
+				return result, DateKindTzid, nil
 			}
-			return ""
-		}()
-		if tzidString == "" {
-			return 0, fmt.Errorf("TZID not found")
 		}
 		location, err := time.LoadLocation(tzidString)
 		if err != nil {
-			return 0, fmt.Errorf("invalid TZID: %s", err)
+			return 0, DateKindTzid, fmt.Errorf("invalid TZID: %s", err)
 		}
 		result, error := time.ParseInLocation("20060102T150405", timePart, location)
 		if error != nil {
-			return 0, error
+			return 0, DateKindTzid, error
 		}
-		return result.UTC().Unix(), nil
+		return result.UTC().Unix(), DateKindTzid, nil
 	case UTCTimePattern.MatchString(timePart):
 		result, err := time.Parse("20060102T150405Z", timePart)
 		if err != nil {
-			return 0, err
+			return 0, DateKindUTC, err
 		}
-		return result.Unix(), nil
+		return result.Unix(), DateKindUTC, nil
 	default:
-		return 0, fmt.Errorf("invalid date-time format")
+		return 0, DateKindUTC, fmt.Errorf("invalid date-time format")
 	}
 }
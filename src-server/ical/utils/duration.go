@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W|(\d+D)?(?:T(\d+H)?(\d+M)?(\d+S)?)?)$`)
+
+// Parse a DURATION value (RFC5545 section 3.3.6), e.g. `PT15M`, `-P1D`,
+// `P1DT2H30M` or `P2W`, into a number of seconds. A day is taken as 24 hours.
+func Duration2Seconds(duration string) (int64, error) {
+	match := durationPattern.FindStringSubmatch(duration)
+	// the T must be followed by a time, and at least one part must be set
+	if match == nil || strings.HasSuffix(duration, "T") || strings.Join(match[2:], "") == "" {
+		return 0, fmt.Errorf("invalid duration: %s", duration)
+	}
+	part := func(value string, unit int64) int64 {
+		if value == "" {
+			return 0
+		}
+		number, _ := strconv.ParseInt(strings.TrimRight(value, "DHMS"), 10, 64)
+		return number * unit
+	}
+	seconds := part(match[2], 7*24*3600) +
+		part(match[3], 24*3600) +
+		part(match[4], 3600) +
+		part(match[5], 60) +
+		part(match[6], 1)
+	if match[1] == "-" {
+		seconds = -seconds
+	}
+	return seconds, nil
+}
+
+// Convert a number of seconds into a DURATION value, e.g. `-PT15M` or
+// `P1DT12H`.
+func Seconds2Duration(seconds int64) string {
+	var sb strings.Builder
+	if seconds < 0 {
+		sb.WriteString("-")
+		seconds = -seconds
+	}
+	sb.WriteString("P")
+	if seconds == 0 {
+		sb.WriteString("T0S")
+		return sb.String()
+	}
+	if seconds%(7*24*3600) == 0 {
+		return sb.String() + fmt.Sprintf("%dW", seconds/(7*24*3600))
+	}
+	if days := seconds / (24 * 3600); days > 0 {
+		sb.WriteString(fmt.Sprintf("%dD", days))
+	}
+	if seconds%(24*3600) == 0 {
+		return sb.String()
+	}
+	sb.WriteString("T")
+	if hours := seconds % (24 * 3600) / 3600; hours > 0 {
+		sb.WriteString(fmt.Sprintf("%dH", hours))
+	}
+	if minutes := seconds % 3600 / 60; minutes > 0 {
+		sb.WriteString(fmt.Sprintf("%dM", minutes))
+	}
+	if seconds%60 > 0 {
+		sb.WriteString(fmt.Sprintf("%dS", seconds%60))
+	}
+	return sb.String()
+}
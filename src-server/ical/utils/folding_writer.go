@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Content lines must not be longer than 75 octets, excluding the line break
+// (RFC5545 section 3.1).
+const maxLineOctets = 75
+
+// Buffer the content lines written to it, fold them and stream them into an
+// io.Writer with CRLF line breaks. Lines are expected to end with "\n".
+type FoldingWriter struct {
+	w    *bufio.Writer
+	line strings.Builder
+	err  error
+}
+
+func NewFoldingWriter(w io.Writer) *FoldingWriter {
+	return &FoldingWriter{w: bufio.NewWriter(w)}
+}
+
+// Write a (part of a) content line, usable as the `writer func(string)` of the
+// ToIcal methods. Errors are kept until Flush is called.
+func (fw *FoldingWriter) WriteString(s string) {
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i == -1 {
+			fw.line.WriteString(s)
+			return
+		}
+		fw.line.WriteString(s[:i])
+		fw.writeLine(fw.line.String())
+		fw.line.Reset()
+		s = s[i+1:]
+	}
+}
+
+// Write the remaining incomplete line if any, then flush everything into the
+// underlying io.Writer. Returns the first error encountered while writing.
+func (fw *FoldingWriter) Flush() error {
+	if fw.line.Len() > 0 {
+		fw.writeLine(fw.line.String())
+		fw.line.Reset()
+	}
+	if fw.err == nil {
+		fw.err = fw.w.Flush()
+	}
+	return fw.err
+}
+
+// Fold a line every 75 octets without splitting a multi-byte character, each
+// continuation line starts with a space which counts toward the limit.
+func (fw *FoldingWriter) writeLine(line string) {
+	if fw.err != nil {
+		return
+	}
+	line = strings.TrimSuffix(line, "\r")
+
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, fw.err = fw.w.WriteString(line[:cut] + "\r\n "); fw.err != nil {
+			return
+		}
+		line = line[cut:]
+		limit = maxLineOctets - 1
+	}
+	_, fw.err = fw.w.WriteString(line + "\r\n")
+}
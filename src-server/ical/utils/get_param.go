@@ -0,0 +1,18 @@
+package utils
+
+import "strings"
+
+// Get the value of a property parameter, e.g. `TZID` from
+// `DTSTART;TZID=Europe/Paris:20220101T000000`. Returns an empty string if the
+// parameter is not present.
+func GetParam(property string, key string) string {
+	slice := strings.SplitN(property, ":", 2)
+	for _, param := range strings.Split(slice[0], ";")[1:] {
+		if parts := strings.SplitN(param, "=", 2); len(parts) == 2 {
+			if strings.EqualFold(parts[0], key) {
+				return strings.Trim(parts[1], `"`)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A property parameter, e.g. `MEMBER="mailto:a@example.com","mailto:b@example.com"`
+type Param struct {
+	Name   string   // upper-cased
+	Values []string // unquoted
+}
+
+// Split an unfolded content line into its upper-cased name, its parameters and
+// its raw value. Unlike strings.SplitN(line, ":", 2), colons, semicolons and
+// commas inside quoted parameter values are handled. For example:
+//
+//	ATTENDEE;CN="Doe, John";ROLE=CHAIR:mailto:john@example.com
+//
+// gives ATTENDEE, [{CN [Doe, John]} {ROLE [CHAIR]}], mailto:john@example.com
+func SplitContentLine(line string) (string, []Param, string, error) {
+	i := strings.IndexAny(line, ";:")
+	if i == -1 {
+		return "", nil, "", fmt.Errorf("missing ':' in content line")
+	}
+	name := strings.ToUpper(strings.TrimSpace(line[:i]))
+	if name == "" {
+		return "", nil, "", fmt.Errorf("missing property name")
+	}
+
+	var params []Param
+	for line[i] == ';' {
+		eq := strings.IndexByte(line[i+1:], '=')
+		if eq == -1 {
+			return "", nil, "", fmt.Errorf("missing '=' in parameter")
+		}
+		param := Param{Name: strings.ToUpper(line[i+1 : i+1+eq])}
+
+		j := i + 1 + eq + 1
+		for {
+			if j < len(line) && line[j] == '"' {
+				end := strings.IndexByte(line[j+1:], '"')
+				if end == -1 {
+					return "", nil, "", fmt.Errorf("unterminated quoted parameter value")
+				}
+				param.Values = append(param.Values, line[j+1:j+1+end])
+				j += end + 2
+			} else {
+				end := strings.IndexAny(line[j:], ",;:")
+				if end == -1 {
+					return "", nil, "", fmt.Errorf("missing ':' in content line")
+				}
+				param.Values = append(param.Values, line[j:j+end])
+				j += end
+			}
+			if j >= len(line) {
+				return "", nil, "", fmt.Errorf("missing ':' in content line")
+			}
+			if line[j] != ',' {
+				break
+			}
+			j++
+		}
+		params = append(params, param)
+		i = j
+	}
+	if line[i] != ':' {
+		return "", nil, "", fmt.Errorf("unexpected character %q after parameter", line[i])
+	}
+
+	return name, params, line[i+1:], nil
+}
+
+// Join a name, its parameters and a raw value back into a content line,
+// quoting the parameter values when needed.
+func JoinContentLine(name string, params []Param, value string) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, param := range params {
+		sb.WriteString(";" + param.Name + "=")
+		for i, v := range param.Values {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if strings.ContainsAny(v, ",;:") {
+				sb.WriteString(`"` + v + `"`)
+			} else {
+				sb.WriteString(v)
+			}
+		}
+	}
+	sb.WriteString(":" + value)
+	return sb.String()
+}
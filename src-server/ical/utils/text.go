@@ -0,0 +1,84 @@
+package utils
+
+import "strings"
+
+// Escape a TEXT value (RFC5545 section 3.3.11) before writing it into a
+// content line: backslashes, semicolons, commas and newlines are escaped.
+func EscapeText(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case ';':
+			sb.WriteString(`\;`)
+		case ',':
+			sb.WriteString(`\,`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			// CRLF and lone CR are both written as a single newline
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// Unescape a TEXT value (RFC5545 section 3.3.11) read from a content line.
+// Unknown escape sequences are kept as-is.
+func UnescapeText(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' || i+1 == len(text) {
+			sb.WriteByte(c)
+			continue
+		}
+		switch next := text[i+1]; next {
+		case '\\', ';', ',':
+			sb.WriteByte(next)
+		case 'n', 'N':
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(c)
+			sb.WriteByte(next)
+		}
+		i++
+	}
+	return sb.String()
+}
+
+// Split a list of TEXT values, e.g. the CATEGORIES property, on the commas
+// that aren't escaped, and unescape each value. Blank values are dropped.
+func SplitText(text string) []string {
+	values := make([]string, 0)
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, text[start:i])
+			start = i + 1
+		}
+	}
+	values = append(values, text[start:])
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(UnescapeText(value)); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
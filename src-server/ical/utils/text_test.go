@@ -0,0 +1,160 @@
+package utils_test
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"towd/src-server/ical"
+	"towd/src-server/ical/event"
+	"towd/src-server/ical/utils"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		escaped string
+	}{
+		{"plain", "Standup", "Standup"},
+		{"newline", "Line one\nLine two", `Line one\nLine two`},
+		{"CRLF", "Line one\r\nLine two", `Line one\nLine two`},
+		{"lone CR", "Line one\rLine two", `Line one\nLine two`},
+		{"comma", "Paris, France", `Paris\, France`},
+		{"semicolon", "Review; quarterly", `Review\; quarterly`},
+		{"backslash", `C:\path\n`, `C:\\path\\n`},
+		{"CJK", "会議室、東京", "会議室、東京"},
+		{"emoji", "Launch 🚀, party 🎉", `Launch 🚀\, party 🎉`},
+		{"mixed", "Agenda:\n- 日本語; notes\n- a,b\\c", `Agenda:\n- 日本語\; notes\n- a\,b\\c`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.EscapeText(tt.text); got != tt.escaped {
+				t.Errorf("EscapeText(%q) = %q, want %q", tt.text, got, tt.escaped)
+			}
+		})
+	}
+}
+
+func TestUnescapeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		escaped string
+		text    string
+	}{
+		{"plain", "Standup", "Standup"},
+		{"lowercase newline", `Line one\nLine two`, "Line one\nLine two"},
+		{"uppercase newline", `Line one\NLine two`, "Line one\nLine two"},
+		{"comma", `Paris\, France`, "Paris, France"},
+		{"semicolon", `Review\; quarterly`, "Review; quarterly"},
+		{"backslash", `C:\\path\\n`, `C:\path\n`},
+		{"unknown escape", `a\tb`, `a\tb`},
+		{"trailing backslash", `a\`, `a\`},
+		{"CJK", `会議室\、東京\n二階`, "会議室\\、東京\n二階"},
+		{"emoji", `Launch 🚀\, party 🎉`, "Launch 🚀, party 🎉"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.UnescapeText(tt.escaped); got != tt.text {
+				t.Errorf("UnescapeText(%q) = %q, want %q", tt.escaped, got, tt.text)
+			}
+		})
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"Line one\nLine two\n\nLine four\n",
+		`\n is not a newline, \\ nor \N`,
+		"a,b;c\\d",
+		"日本語の説明\n中文描述\n한국어 설명",
+		"🎉🚀 emoji, with 👩‍👩‍👧 a ZWJ sequence; and 🇫🇷",
+	}
+	for _, text := range texts {
+		if got := utils.UnescapeText(utils.EscapeText(text)); got != text {
+			t.Errorf("UnescapeText(EscapeText(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	got := utils.SplitText(`Work,Team\, core, 日本語 ,,🎉\;party`)
+	want := []string{"Work", "Team, core", "日本語", "🎉;party"}
+	if !slices.Equal(got, want) {
+		t.Errorf("SplitText = %q, want %q", got, want)
+	}
+}
+
+// The TEXT values of an event survive being parsed, written and parsed again,
+// including when the long lines get folded
+func TestEventTextRoundTrip(t *testing.T) {
+	summary := "Review; quarterly, with 日本語 🎉"
+	description := "Agenda:\n- blockers, risks\n- C:\\path\n" + strings.Repeat("長い説明🎉", 20)
+	location := "Room 1, floor 2; 東京"
+	input := strings.ReplaceAll(`BEGIN:VCALENDAR
+PRODID:-//Test//Text//EN
+VERSION:2.0
+X-WR-CALNAME:Team\, shared
+X-WR-CALDESC:Line one\nLine two
+BEGIN:VEVENT
+UID:review@example.com
+DTSTART:20250106T093000Z
+DTEND:20250106T103000Z
+SUMMARY:`+utils.EscapeText(summary)+`
+DESCRIPTION:`+utils.EscapeText(description)+`
+LOCATION:`+utils.EscapeText(location)+`
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n")
+
+	parse := func(input string) (*ical.Calendar, *event.MasterEvent) {
+		t.Helper()
+		cal, _, customErr := ical.Parse(context.Background(), strings.NewReader(input), ical.ParseOptions{Strict: true})
+		if customErr != nil {
+			t.Fatalf("Parse: %s", customErr)
+		}
+		var masterEvent *event.MasterEvent
+		cal.IterateMasterEvents(func(id string, e *event.MasterEvent) error {
+			masterEvent = e
+			return nil
+		})
+		if masterEvent == nil {
+			t.Fatalf("no event parsed from:\n%s", input)
+		}
+		return cal, masterEvent
+	}
+	check := func(cal *ical.Calendar, masterEvent *event.MasterEvent) {
+		t.Helper()
+		if got := cal.GetName(); got != "Team, shared" {
+			t.Errorf("calendar name = %q", got)
+		}
+		if got := cal.GetDescription(); got != "Line one\nLine two" {
+			t.Errorf("calendar description = %q", got)
+		}
+		if got := masterEvent.GetSummary(); got != summary {
+			t.Errorf("summary = %q, want %q", got, summary)
+		}
+		if got := masterEvent.GetDescription(); got != description {
+			t.Errorf("description = %q, want %q", got, description)
+		}
+		if got := masterEvent.GetLocation(); got != location {
+			t.Errorf("location = %q, want %q", got, location)
+		}
+	}
+
+	cal, masterEvent := parse(input)
+	check(cal, masterEvent)
+
+	var output bytes.Buffer
+	if err := cal.ToIcal(&output); err != nil {
+		t.Fatalf("ToIcal: %s", err)
+	}
+	for _, line := range strings.Split(output.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	check(parse(output.String()))
+}
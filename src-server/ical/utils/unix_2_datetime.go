@@ -4,13 +4,54 @@ import (
 	"time"
 )
 
-// Convert a time to a string in iCalendar format: YYYYMMDD or YYYYMMDDTHHMMSSZ
+// Convert a time to a string in iCalendar format: YYYYMMDDTHHMMSSZ
 func Unix2Datetime(unixTime int64) string {
-	t := time.Unix(unixTime, 0).UTC()
+	return time.Unix(unixTime, 0).UTC().Format("20060102T150405Z")
+}
+
+// Convert a DATE value, i.e. a midnight UTC, to a string in iCalendar format:
+// YYYYMMDD
+func Unix2Date(unixTime int64) string {
+	return time.Unix(unixTime, 0).UTC().Format("20060102")
+}
+
+// Convert a time to a local date-time string without the "Z" suffix, in the
+// given location: YYYYMMDDTHHMMSS
+func Unix2LocalDatetime(unixTime int64, loc *time.Location) string {
+	return time.Unix(unixTime, 0).In(loc).Format("20060102T150405")
+}
 
-	hour, min, sec := t.Clock()
-	if hour == 0 && min == 0 && sec == 0 {
-		return t.Format("20060102Z")
+// Format a date-time property holding a value of the given type. For example:
+//   - DTSTART;VALUE=DATE:20220101
+//   - DTSTART;TZID=Europe/Paris:20220101T000000
+//   - DTSTART:20220101T000000 (floating)
+//   - DTSTART:20220101T000000Z
+//
+// A TZID is written in the location it stands for, e.g. built from a
+// VTIMEZONE, it falls back to UTC without one.
+func FormatDatetime(name string, unixTime int64, kind DateKind, tzid string, loc *time.Location) string {
+	switch kind {
+	case DateKindDate:
+		return name + ";VALUE=DATE:" + Unix2Date(unixTime)
+	case DateKindFloating:
+		return name + ":" + Unix2LocalDatetime(unixTime, time.UTC)
 	}
-	return t.Format("20060102T150405Z")
+	if tzid != "" && loc != nil {
+		return JoinContentLine(name, []Param{{Name: "TZID", Values: []string{tzid}}}, Unix2LocalDatetime(unixTime, loc))
+	}
+	return name + ":" + Unix2Datetime(unixTime)
+}
+
+// Get the DATE value of the day a time falls on in the location, i.e. the
+// midnight UTC of that day
+func StartOfDay(unixTime int64, loc *time.Location) int64 {
+	year, month, day := time.Unix(unixTime, 0).In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix()
+}
+
+// Get the instant a DATE or floating value, stored as if it was in UTC,
+// stands for in the location, e.g. the start of the day there
+func WallClock2Unix(unixTime int64, loc *time.Location) int64 {
+	t := time.Unix(unixTime, 0).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc).Unix()
 }
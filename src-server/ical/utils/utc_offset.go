@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var utcOffsetPattern = regexp.MustCompile(`^([+-])(\d{2})(\d{2})(\d{2})?$`)
+
+// Parse a UTC-OFFSET value (e.g. `+0100`, `-0530`, `+013045`) into the number
+// of seconds east of UTC.
+func UTCOffset2Seconds(offset string) (int, error) {
+	match := utcOffsetPattern.FindStringSubmatch(offset)
+	if match == nil {
+		return 0, fmt.Errorf("invalid UTC offset: %s", offset)
+	}
+	hours, _ := strconv.Atoi(match[2])
+	minutes, _ := strconv.Atoi(match[3])
+	seconds := 0
+	if match[4] != "" {
+		seconds, _ = strconv.Atoi(match[4])
+	}
+	total := hours*3600 + minutes*60 + seconds
+	if match[1] == "-" {
+		if total == 0 {
+			return 0, fmt.Errorf("-0000 is not a valid UTC offset")
+		}
+		total = -total
+	}
+	return total, nil
+}
+
+// Convert the number of seconds east of UTC into a UTC-OFFSET value.
+func Seconds2UTCOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	result := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+	if seconds%60 != 0 {
+		result += fmt.Sprintf("%02d", seconds%60)
+	}
+	return result
+}
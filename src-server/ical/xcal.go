@@ -0,0 +1,330 @@
+package ical
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// xCal (RFC6321) is the XML representation of iCalendar. It shares its value
+// formats with jCal, so both directions go through the jCal tree.
+
+const xcalNamespace = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+// The parameters holding a cal-address or a uri instead of a text
+var xcalParamTypes = map[string]string{
+	"altrep":         "uri",
+	"delegated-from": "cal-address",
+	"delegated-to":   "cal-address",
+	"dir":            "uri",
+	"member":         "cal-address",
+	"sent-by":        "cal-address",
+}
+
+// The order of the RECUR parts, as defined in RFC6321 section 3.6.10
+var xcalRecurOrder = []string{
+	"freq", "until", "count", "interval", "bysecond", "byminute", "byhour",
+	"byday", "bymonthday", "byyearday", "byweekno", "bymonth", "bysetpos",
+	"wkst",
+}
+
+// The element names of the GEO and REQUEST-STATUS structured values
+var xcalStructuredParts = map[string][]string{
+	"geo":            {"latitude", "longitude"},
+	"request-status": {"code", "description", "data"},
+}
+
+// A generic XML element
+type xcalNode struct {
+	XMLName xml.Name
+	Nodes   []xcalNode `xml:",any"`
+	Content string     `xml:",chardata"`
+}
+
+// Marshal a Calendar{} struct into an xCal document.
+func (cal *Calendar) ToXCal() ([]byte, error) {
+	root, err := cal.toJCalTree()
+	if err != nil {
+		return nil, fmt.Errorf("(*Calendar).ToXCal: %w", err)
+	}
+	vcalendar, err := jcalComponentToXCal(root)
+	if err != nil {
+		return nil, fmt.Errorf("(*Calendar).ToXCal: %w", err)
+	}
+
+	icalendar := xcalNode{
+		XMLName: xml.Name{Space: xcalNamespace, Local: "icalendar"},
+		Nodes:   []xcalNode{vcalendar},
+	}
+	result, err := xml.MarshalIndent(icalendar, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("(*Calendar).ToXCal: %w", err)
+	}
+	return append([]byte(xml.Header), result...), nil
+}
+
+// Unmarshal an xCal document into a Calendar{} struct.
+func FromXCal(r io.Reader) (*Calendar, *CustomError) {
+	var icalendar xcalNode
+	if err := xml.NewDecoder(r).Decode(&icalendar); err != nil {
+		return nil, NewCustomError("can't decode xCal", map[string]any{
+			"err": err,
+		})
+	}
+	if icalendar.XMLName.Local != "icalendar" || len(icalendar.Nodes) != 1 {
+		return nil, NewCustomError("xCal root must be an icalendar element holding one vcalendar", map[string]any{
+			"root": icalendar.XMLName.Local,
+		})
+	}
+
+	root, err := xcalComponentToJCal(icalendar.Nodes[0])
+	if err != nil {
+		return nil, NewCustomError("invalid xCal", map[string]any{
+			"err": err,
+		})
+	}
+	return fromJCalTree(root)
+}
+
+// Create an element holding a text
+func newXCalLeaf(name string, content string) xcalNode {
+	return xcalNode{XMLName: xml.Name{Local: name}, Content: content}
+}
+
+// Convert a jCal component into an xCal element
+func jcalComponentToXCal(component []any) (xcalNode, error) {
+	name := component[0].(string)
+	node := xcalNode{XMLName: xml.Name{Local: name}}
+
+	properties := xcalNode{XMLName: xml.Name{Local: "properties"}}
+	for _, rawProperty := range component[1].([]any) {
+		property, err := jcalPropertyToXCal(rawProperty.([]any))
+		if err != nil {
+			return xcalNode{}, fmt.Errorf("%s: %w", name, err)
+		}
+		properties.Nodes = append(properties.Nodes, property)
+	}
+	if len(properties.Nodes) > 0 {
+		node.Nodes = append(node.Nodes, properties)
+	}
+
+	components := xcalNode{XMLName: xml.Name{Local: "components"}}
+	for _, rawSubComponent := range component[2].([]any) {
+		subComponent, err := jcalComponentToXCal(rawSubComponent.([]any))
+		if err != nil {
+			return xcalNode{}, fmt.Errorf("%s: %w", name, err)
+		}
+		components.Nodes = append(components.Nodes, subComponent)
+	}
+	if len(components.Nodes) > 0 {
+		node.Nodes = append(node.Nodes, components)
+	}
+
+	return node, nil
+}
+
+// Convert a jCal property into an xCal element
+func jcalPropertyToXCal(property []any) (xcalNode, error) {
+	name := property[0].(string)
+	params := property[1].(map[string]any)
+	valueType := property[2].(string)
+	node := xcalNode{XMLName: xml.Name{Local: name}}
+
+	if len(params) > 0 {
+		paramNames := make([]string, 0, len(params))
+		for paramName := range params {
+			paramNames = append(paramNames, paramName)
+		}
+		sort.Strings(paramNames)
+
+		parameters := xcalNode{XMLName: xml.Name{Local: "parameters"}}
+		for _, paramName := range paramNames {
+			paramType, ok := xcalParamTypes[paramName]
+			if !ok {
+				paramType = "text"
+			}
+			param := xcalNode{XMLName: xml.Name{Local: paramName}}
+			switch value := params[paramName].(type) {
+			case string:
+				param.Nodes = append(param.Nodes, newXCalLeaf(paramType, value))
+			case []string:
+				for _, v := range value {
+					param.Nodes = append(param.Nodes, newXCalLeaf(paramType, v))
+				}
+			}
+			parameters.Nodes = append(parameters.Nodes, param)
+		}
+		node.Nodes = append(node.Nodes, parameters)
+	}
+
+	for _, value := range property[3:] {
+		switch v := value.(type) {
+		case []any:
+			partNames, ok := xcalStructuredParts[name]
+			if !ok || len(v) > len(partNames) {
+				return xcalNode{}, fmt.Errorf("%s: unexpected structured value", name)
+			}
+			for i, part := range v {
+				node.Nodes = append(node.Nodes, newXCalLeaf(partNames[i], fmt.Sprint(part)))
+			}
+		case map[string]any:
+			recur := xcalNode{XMLName: xml.Name{Local: "recur"}}
+			for _, key := range xcalRecurOrder {
+				parts, ok := v[key].([]any)
+				if !ok {
+					parts = []any{v[key]}
+				}
+				for _, part := range parts {
+					if part != nil {
+						recur.Nodes = append(recur.Nodes, newXCalLeaf(key, fmt.Sprint(part)))
+					}
+				}
+			}
+			node.Nodes = append(node.Nodes, recur)
+		default:
+			raw := fmt.Sprint(v)
+			if valueType != "period" {
+				node.Nodes = append(node.Nodes, newXCalLeaf(valueType, raw))
+				continue
+			}
+			start, end, _ := strings.Cut(raw, "/")
+			endName := "end"
+			if strings.HasPrefix(end, "P") {
+				endName = "duration"
+			}
+			node.Nodes = append(node.Nodes, xcalNode{
+				XMLName: xml.Name{Local: "period"},
+				Nodes:   []xcalNode{newXCalLeaf("start", start), newXCalLeaf(endName, end)},
+			})
+		}
+	}
+
+	return node, nil
+}
+
+// Convert an xCal element into a jCal component
+func xcalComponentToJCal(node xcalNode) ([]any, error) {
+	name := strings.ToLower(node.XMLName.Local)
+	properties := make([]any, 0)
+	components := make([]any, 0)
+
+	for _, child := range node.Nodes {
+		switch child.XMLName.Local {
+		case "properties":
+			for _, propertyNode := range child.Nodes {
+				property, err := xcalPropertyToJCal(propertyNode)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				properties = append(properties, property)
+			}
+		case "components":
+			for _, componentNode := range child.Nodes {
+				component, err := xcalComponentToJCal(componentNode)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				components = append(components, component)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unexpected element <%s>", name, child.XMLName.Local)
+		}
+	}
+
+	return []any{name, properties, components}, nil
+}
+
+// Convert an xCal element into a jCal property
+func xcalPropertyToJCal(node xcalNode) ([]any, error) {
+	name := strings.ToLower(node.XMLName.Local)
+	params := make(map[string]any)
+	valueNodes := make([]xcalNode, 0, 1)
+	for _, child := range node.Nodes {
+		if child.XMLName.Local != "parameters" {
+			valueNodes = append(valueNodes, child)
+			continue
+		}
+		for _, paramNode := range child.Nodes {
+			paramValues := make([]any, 0, 1)
+			for _, valueNode := range paramNode.Nodes {
+				paramValues = append(paramValues, valueNode.Content)
+			}
+			paramName := strings.ToLower(paramNode.XMLName.Local)
+			if len(paramValues) == 1 {
+				params[paramName] = paramValues[0]
+			} else {
+				params[paramName] = paramValues
+			}
+		}
+	}
+	if len(valueNodes) == 0 {
+		return nil, fmt.Errorf("%s: missing value", name)
+	}
+
+	// GEO and REQUEST-STATUS have their parts directly under the property
+	if partNames, ok := xcalStructuredParts[name]; ok && valueNodes[0].XMLName.Local == partNames[0] {
+		parts := make([]any, 0, len(partNames))
+		for _, valueNode := range valueNodes {
+			if len(parts) == len(partNames) || valueNode.XMLName.Local != partNames[len(parts)] {
+				return nil, fmt.Errorf("%s: unexpected element <%s>", name, valueNode.XMLName.Local)
+			}
+			if name == "geo" {
+				parts = append(parts, json.Number(strings.TrimSpace(valueNode.Content)))
+			} else {
+				parts = append(parts, valueNode.Content)
+			}
+		}
+		return []any{name, params, jcalDefaultTypes[strings.ToUpper(name)], parts}, nil
+	}
+
+	valueType := strings.ToLower(valueNodes[0].XMLName.Local)
+	property := []any{name, params, valueType}
+	for _, valueNode := range valueNodes {
+		if strings.ToLower(valueNode.XMLName.Local) != valueType {
+			return nil, fmt.Errorf("%s: mixed value types <%s> and <%s>", name, valueType, valueNode.XMLName.Local)
+		}
+
+		switch valueType {
+		case "recur":
+			recur := make(map[string]any)
+			for _, partNode := range valueNode.Nodes {
+				key := strings.ToLower(partNode.XMLName.Local)
+				var part any = partNode.Content
+				if _, ok := jcalRecurIntegers[strings.ToUpper(key)]; ok {
+					part = json.Number(strings.TrimSpace(partNode.Content))
+				}
+				switch existing := recur[key].(type) {
+				case nil:
+					recur[key] = part
+				case []any:
+					recur[key] = append(existing, part)
+				default:
+					recur[key] = []any{existing, part}
+				}
+			}
+			property = append(property, recur)
+		case "period":
+			var start, end string
+			for _, partNode := range valueNode.Nodes {
+				switch partNode.XMLName.Local {
+				case "start":
+					start = partNode.Content
+				case "end", "duration":
+					end = partNode.Content
+				}
+			}
+			property = append(property, start+"/"+end)
+		case "integer", "float":
+			property = append(property, json.Number(strings.TrimSpace(valueNode.Content)))
+		case "boolean":
+			property = append(property, strings.TrimSpace(valueNode.Content) == "true")
+		default:
+			property = append(property, valueNode.Content)
+		}
+	}
+
+	return property, nil
+}
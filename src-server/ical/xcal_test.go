@@ -0,0 +1,271 @@
+package ical
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"towd/src-server/ical/event"
+	"towd/src-server/ical/structured"
+)
+
+func TestXCalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "timezone, recurrence and child event",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Round trip//EN
+VERSION:2.0
+X-WR-CALNAME:Team
+BEGIN:VTIMEZONE
+TZID:Europe/Paris
+BEGIN:STANDARD
+DTSTART:19701025T030000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+TZNAME:CET
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:19700329T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+TZNAME:CEST
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:standup@example.com
+DTSTART;TZID=Europe/Paris:20250106T093000
+DTEND;TZID=Europe/Paris:20250106T094500
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20250331T000000Z
+EXDATE;TZID=Europe/Paris:20250108T093000,20250113T093000
+SUMMARY:Standup
+END:VEVENT
+BEGIN:VEVENT
+UID:standup@example.com
+RECURRENCE-ID;TZID=Europe/Paris:20250110T093000
+DTSTART;TZID=Europe/Paris:20250110T110000
+DTEND;TZID=Europe/Paris:20250110T111500
+SUMMARY:Standup (moved)
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+		{
+			name: "whole-day events",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Round trip//EN
+VERSION:2.0
+X-WR-CALNAME:Holidays
+BEGIN:VEVENT
+UID:labour-day@example.com
+DTSTART;VALUE=DATE:20250501
+DTEND;VALUE=DATE:20250502
+RRULE:FREQ=YEARLY
+EXDATE;VALUE=DATE:20260501
+SUMMARY:Labour day
+TRANSP:TRANSPARENT
+END:VEVENT
+BEGIN:VEVENT
+UID:offsite@example.com
+DTSTART;VALUE=DATE:20250612
+DTEND;VALUE=DATE:20250614
+SUMMARY:Offsite
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+		{
+			name: "escaped text",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Round trip//EN
+VERSION:2.0
+X-WR-CALNAME:Team\, shared
+X-WR-CALDESC:Line one\nLine two
+BEGIN:VEVENT
+UID:review@example.com
+DTSTART:20250106T093000Z
+DTEND:20250106T103000Z
+SUMMARY:Review\; quarterly
+DESCRIPTION:Agenda:\n- blockers\, risks\n- C:\\path\n- 日本語の議題 🎉
+LOCATION:Room 1\, floor 2
+CATEGORIES:Work,Team\, core
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+		{
+			name: "custom properties and alarm",
+			input: `BEGIN:VCALENDAR
+PRODID:-//Test//Round trip//EN
+VERSION:2.0
+X-WR-CALNAME:Custom
+BEGIN:VEVENT
+UID:launch@example.com
+DTSTART:20250106T093000Z
+DTEND:20250106T103000Z
+SUMMARY:Launch
+URL:https://example.com/launch
+PRIORITY:1
+CLASS:PRIVATE
+GEO:48.85;2.35
+X-CUSTOM-FLAG;X-PARAM=yes:some value
+X-MICROSOFT-CDO-BUSYSTATUS:OOF
+BEGIN:VALARM
+UID:launch-alarm@example.com
+ACTION:DISPLAY
+DESCRIPTION:Launch soon
+TRIGGER;RELATED=END:-PT10M
+X-ALARM-NOTE:custom
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, _, customErr := Parse(context.Background(), strings.NewReader(tt.input), ParseOptions{Strict: true})
+			if customErr != nil {
+				t.Fatalf("Parse: %s", customErr)
+			}
+			xcal, err := cal.ToXCal()
+			if err != nil {
+				t.Fatalf("ToXCal: %s", err)
+			}
+			roundTripped, customErr := FromXCal(bytes.NewReader(xcal))
+			if customErr != nil {
+				t.Fatalf("FromXCal: %s\n%s", customErr, xcal)
+			}
+			var output bytes.Buffer
+			if err := roundTripped.ToIcal(&output); err != nil {
+				t.Fatalf("ToIcal: %s", err)
+			}
+
+			if got, want := canonicalIcal(output.String()), canonicalIcal(tt.input); got != want {
+				t.Errorf("round trip changed the calendar\ngot:\n%s\nwant:\n%s\nxCal:\n%s", got, want, xcal)
+			}
+		})
+	}
+}
+
+// Offsets west of UTC keep their sign through xCal, as do the event dates
+// resolved with them.
+func TestXCalNegativeOffsets(t *testing.T) {
+	input := `BEGIN:VCALENDAR
+PRODID:-//Test//Round trip//EN
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:America/New_York
+BEGIN:DAYLIGHT
+DTSTART:20070311T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+TZNAME:EDT
+END:DAYLIGHT
+BEGIN:STANDARD
+DTSTART:20071104T020000
+RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+TZNAME:EST
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:review@example.com
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=America/New_York:20250106T090000
+DTEND;TZID=America/New_York:20250106T100000
+SUMMARY:Review
+END:VEVENT
+END:VCALENDAR
+`
+	cal, _, customErr := Parse(context.Background(), strings.NewReader(input), ParseOptions{Strict: true})
+	if customErr != nil {
+		t.Fatalf("Parse: %s", customErr)
+	}
+	xcal, err := cal.ToXCal()
+	if err != nil {
+		t.Fatalf("ToXCal: %s", err)
+	}
+	roundTripped, customErr := FromXCal(bytes.NewReader(xcal))
+	if customErr != nil {
+		t.Fatalf("FromXCal: %s\n%s", customErr, xcal)
+	}
+
+	tz, ok := roundTripped.GetTimezone("America/New_York")
+	if !ok {
+		t.Fatalf("no VTIMEZONE after the round trip:\n%s", xcal)
+	}
+	offsets := make([]string, 0)
+	tz.IterateObservances(func(observance *structured.TimezoneObservance) {
+		offsets = append(offsets, fmt.Sprintf("%s %d %d", observance.GetKind(), observance.GetOffsetFrom(), observance.GetOffsetTo()))
+	})
+	if want := []string{"DAYLIGHT -18000 -14400", "STANDARD -14400 -18000"}; !slices.Equal(offsets, want) {
+		t.Errorf("offsets %v, want %v\n%s", offsets, want, xcal)
+	}
+
+	roundTripped.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+		if got, want := time.Unix(masterEvent.GetStartDate(), 0).UTC(), time.Date(2025, 1, 6, 14, 0, 0, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("start %s, want %s", got, want)
+		}
+		return nil
+	})
+	if roundTripped.GetMasterEventCount() != 1 {
+		t.Errorf("%d events, want 1", roundTripped.GetMasterEventCount())
+	}
+}
+
+// Rewrite an iCalendar stream so that two equivalent ones are equal: the lines
+// are unfolded, the properties and the sub-components of each component are
+// sorted, as are the parts of the recurrence rules, the EXDATEs and RDATEs
+// are written one per line, and the DTSTAMP and CREATED properties, written
+// at export time, are dropped.
+func canonicalIcal(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+
+	type component struct {
+		lines    []string
+		children []string
+	}
+	stack := []*component{{}}
+	for _, line := range strings.Split(text, "\n") {
+		current := stack[len(stack)-1]
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "BEGIN:"):
+			stack = append(stack, &component{})
+		case strings.HasPrefix(line, "END:"):
+			sort.Strings(current.lines)
+			sort.Strings(current.children)
+			stack = stack[:len(stack)-1]
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, "BEGIN:"+strings.TrimPrefix(line, "END:")+"\n"+
+				strings.Join(current.lines, "")+strings.Join(current.children, "")+line+"\n")
+		case strings.HasPrefix(line, "DTSTAMP:"), strings.HasPrefix(line, "CREATED:"):
+		case strings.HasPrefix(line, "RRULE:"):
+			parts := strings.Split(strings.TrimPrefix(line, "RRULE:"), ";")
+			sort.Strings(parts)
+			current.lines = append(current.lines, "RRULE:"+strings.Join(parts, ";")+"\n")
+		case strings.HasPrefix(line, "EXDATE"), strings.HasPrefix(line, "RDATE"):
+			// one date per line
+			separator := strings.LastIndex(line, ":")
+			for _, date := range strings.Split(line[separator+1:], ",") {
+				current.lines = append(current.lines, line[:separator+1]+date+"\n")
+			}
+		default:
+			current.lines = append(current.lines, line+"\n")
+		}
+	}
+	return strings.Join(stack[0].children, "")
+}
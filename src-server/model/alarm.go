@@ -0,0 +1,64 @@
+package model
+
+import (
+	"towd/src-server/ical/structured"
+
+	"github.com/uptrace/bun"
+)
+
+// A reminder of an event (iCalendar VALARM). It applies to every occurrence
+// of a recurring event.
+type Alarm struct {
+	bun.BaseModel `bun:"table:alarms"`
+
+	EventID string `bun:"event_id,notnull"` // required
+	Action  string `bun:"action,notnull"`   // required, iCalendar ACTION, e.g. DISPLAY
+	// The trigger is either an offset in seconds from the START or the END
+	// of the occurrence, or an absolute date when TriggerRelated is blank
+	TriggerOffset      int64  `bun:"trigger_offset"`
+	TriggerRelated     string `bun:"trigger_related"`
+	TriggerDateUnixUTC int64  `bun:"trigger_date"`
+	Repeat             int    `bun:"repeat"`
+	Duration           int64  `bun:"duration"` // seconds between the repetitions
+	Description        string `bun:"description"`
+
+	Event *Event `bun:"rel:belongs-to,join:event_id=id"`
+}
+
+// Create an alarm of the event from an iCalendar alarm
+func AlarmFromIcal(alarm *structured.Alarm, eventID string) Alarm {
+	triggerOffset, triggerRelated := alarm.GetTrigger()
+	return Alarm{
+		EventID:            eventID,
+		Action:             string(alarm.GetAction()),
+		TriggerOffset:      triggerOffset,
+		TriggerRelated:     string(triggerRelated),
+		TriggerDateUnixUTC: alarm.GetTriggerDate(),
+		Repeat:             alarm.GetRepeat(),
+		Duration:           alarm.GetDuration(),
+		Description:        alarm.GetDescription(),
+	}
+}
+
+// The alarm as an iCalendar alarm
+func (a *Alarm) ToIcalAlarm() structured.Alarm {
+	alarm := structured.NewAlarm()
+	alarm.
+		SetAction(structured.AlarmAction(a.Action)).
+		SetDuration(a.Duration).
+		SetRepeat(a.Repeat).
+		SetDescription(a.Description)
+	if a.TriggerRelated == "" {
+		alarm.SetTriggerDate(a.TriggerDateUnixUTC)
+	} else {
+		alarm.SetTrigger(a.TriggerOffset, structured.AlarmTriggerRelated(a.TriggerRelated))
+	}
+	return alarm
+}
+
+// Get the dates the alarm goes off for an occurrence from startDate to
+// endDate (in unix time), see (*structured.Alarm).GetTriggerDates
+func (a *Alarm) TriggerDates(startDate, endDate int64) []int64 {
+	alarm := a.ToIcalAlarm()
+	return alarm.GetTriggerDates(startDate, endDate)
+}
@@ -1,14 +1,203 @@
 package model
 
 import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"towd/src-server/ical/structured"
+
 	"github.com/uptrace/bun"
 )
 
 type Attendee struct {
 	bun.BaseModel `bun:"table:attendees"`
 
-	EventID string `bun:"event_id,notnull"` // required
-	Data    string `bun:"data,notnull"`     // required
+	EventID  string `bun:"event_id,notnull"`                         // required
+	Data     string `bun:"data,notnull"`                             // required, e.g. <@1234> or Bob <bob@example.com>
+	UserID   string `bun:"user_id"`                                  // Discord user ID, if the attendee is a Discord user
+	Address  string `bun:"cal_address"`                              // iCalendar cal-address, derived from Data if blank
+	CuType   string `bun:"cu_type"`                                  // iCalendar CUTYPE, INDIVIDUAL if blank
+	Role     string `bun:"role"`                                     // iCalendar ROLE, REQ-PARTICIPANT if blank
+	PartStat string `bun:"part_stat,notnull,default:'NEEDS-ACTION'"` // iCalendar PARTSTAT
+	Rsvp     bool   `bun:"rsvp"`
+
+	DelegatedTo   []string `bun:"delegated_to"`   // cal-addresses
+	DelegatedFrom []string `bun:"delegated_from"` // cal-addresses
+	SentBy        string   `bun:"sent_by"`        // cal-address
 
 	Event *Event `bun:"rel:belongs-to,join:event_id=id"`
 }
+
+var (
+	discordMentionRgx = regexp.MustCompile(`^<@!?(\d+)>$`)
+	discordUserURLRgx = regexp.MustCompile(`^https://discord\.com/users/(\d+)$`)
+	// the names mail.ParseAddress rejects, e.g. Doe, John <john@example.com>
+	nameAddressRgx = regexp.MustCompile(`^(.*?)\s*<([^<>\s]+@[^<>\s]+)>$`)
+)
+
+// Create a required attendee of the event from a Discord mention, an email
+// address or a plain name, as given by the user.
+func NewAttendee(eventID string, data string) Attendee {
+	attendee := Attendee{
+		EventID:  eventID,
+		Data:     strings.TrimSpace(data),
+		CuType:   string(structured.AttendeeCutypeIndividual),
+		Role:     string(structured.AttendeeRoleReq),
+		PartStat: string(structured.AttendeePartStatNeedsAction),
+	}
+	attendee.UserID = attendee.DiscordUserID()
+	return attendee
+}
+
+// Create an attendee of the event from an iCalendar attendee. The Discord
+// users are turned back into mentions.
+func AttendeeFromIcal(attendee *structured.Attendee, eventID string) Attendee {
+	calAddress := attendee.GetCalAddress()
+	cn := string(attendee.GetCn())
+	attendeeModel := Attendee{
+		EventID:  eventID,
+		CuType:   string(attendee.GetCuType()),
+		Role:     string(attendee.GetRole()),
+		PartStat: string(attendee.GetPartStat()),
+		Rsvp:     attendee.GetRsvp(),
+		SentBy:   string(attendee.GetSentBy()),
+		Address:  calAddress,
+	}
+	for _, delegatedTo := range attendee.GetDelegatedTo() {
+		attendeeModel.DelegatedTo = append(attendeeModel.DelegatedTo, string(delegatedTo))
+	}
+	for _, delegatedFrom := range attendee.GetDelegatedFrom() {
+		attendeeModel.DelegatedFrom = append(attendeeModel.DelegatedFrom, string(delegatedFrom))
+	}
+
+	switch match := discordUserURLRgx.FindStringSubmatch(calAddress); {
+	case match != nil:
+		attendeeModel.UserID = match[1]
+		attendeeModel.Data = fmt.Sprintf("<@%s>", match[1])
+	case strings.HasPrefix(strings.ToLower(calAddress), "mailto:") && cn != "":
+		attendeeModel.Data = fmt.Sprintf("%s <%s>", cn, calAddress[len("mailto:"):])
+	case strings.HasPrefix(strings.ToLower(calAddress), "mailto:"):
+		attendeeModel.Data = calAddress[len("mailto:"):]
+	case cn != "":
+		attendeeModel.Data = cn
+	default:
+		attendeeModel.Data = calAddress
+	}
+	return attendeeModel
+}
+
+// Get the Discord user ID if the attendee is a Discord user, e.g. <@1234>
+func (a *Attendee) DiscordUserID() string {
+	if a.UserID != "" {
+		return a.UserID
+	}
+	if match := discordMentionRgx.FindStringSubmatch(strings.TrimSpace(a.Data)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// Get the iCalendar cal-address of the attendee: a Discord profile URL for
+// Discord mentions, a mailto: URI for email addresses. Returns an empty string
+// if the attendee can't be reached, e.g. when it's a plain name.
+func (a *Attendee) CalAddress() string {
+	if a.Address != "" {
+		return a.Address
+	}
+	if userID := a.DiscordUserID(); userID != "" {
+		return "https://discord.com/users/" + userID
+	}
+	if address, err := mail.ParseAddress(strings.TrimSpace(a.Data)); err == nil {
+		return "mailto:" + address.Address
+	}
+	if match := nameAddressRgx.FindStringSubmatch(strings.TrimSpace(a.Data)); match != nil {
+		return "mailto:" + match[2]
+	}
+	return ""
+}
+
+// Get the name to show for the attendee, e.g. Bob for Bob <bob@example.com>
+func (a *Attendee) CommonName() string {
+	if address, err := mail.ParseAddress(strings.TrimSpace(a.Data)); err == nil && address.Name != "" {
+		return address.Name
+	}
+	if match := nameAddressRgx.FindStringSubmatch(strings.TrimSpace(a.Data)); match != nil && match[1] != "" {
+		return match[1]
+	}
+	return strings.TrimSpace(a.Data)
+}
+
+// Get the attendee as shown to the users, e.g. Bob <bob@example.com>
+// (optional, accepted)
+func (a *Attendee) Label() string {
+	details := make([]string, 0, 2)
+	switch structured.AttendeeRole(a.Role) {
+	case structured.AttendeeRoleOpt:
+		details = append(details, "optional")
+	case structured.AttendeeRoleNon:
+		details = append(details, "for information")
+	}
+	if a.PartStat != "" && a.PartStat != string(structured.AttendeePartStatNeedsAction) {
+		details = append(details, strings.ToLower(a.PartStat))
+	}
+	if len(details) == 0 {
+		return a.Data
+	}
+	return fmt.Sprintf("%s (%s)", a.Data, strings.Join(details, ", "))
+}
+
+// The attendee as an iCalendar attendee. Returns false if the attendee can't
+// be reached, i.e. has no cal-address. The attendees stored before the
+// iCalendar fields get the RFC5545 defaults.
+func (a *Attendee) ToIcalAttendee() (structured.Attendee, bool) {
+	calAddress := a.CalAddress()
+	if calAddress == "" {
+		return structured.Attendee{}, false
+	}
+	orDefault := func(value string, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	}
+
+	// a name that only repeats the address is left out
+	cn := a.CommonName()
+	if cn == strings.TrimPrefix(calAddress, "mailto:") || discordMentionRgx.MatchString(cn) {
+		cn = ""
+	}
+
+	attendee := structured.NewAttendee()
+	attendee.
+		SetCuType(structured.AttendeeCustomertype(orDefault(a.CuType, string(structured.AttendeeCutypeIndividual)))).
+		SetRole(structured.AttendeeRole(orDefault(a.Role, string(structured.AttendeeRoleReq)))).
+		SetPartStat(structured.AttendeeParticipantStatus(orDefault(a.PartStat, string(structured.AttendeePartStatNeedsAction)))).
+		SetCn(structured.AttendeeCommonName(cn)).
+		SetCalAddress(calAddress).
+		SetRsvp(a.Rsvp).
+		SetSentBy(structured.AttendeeCommonName(a.SentBy))
+	for _, delegatedTo := range a.DelegatedTo {
+		attendee.AddDelegatedTo(structured.AttendeeCommonName(delegatedTo))
+	}
+	for _, delegatedFrom := range a.DelegatedFrom {
+		attendee.AddDelegatedFrom(structured.AttendeeCommonName(delegatedFrom))
+	}
+	return attendee, true
+}
+
+// Carry the iCalendar fields of the attendees already invited over to the
+// same attendees in the new list, so that editing an event doesn't reset
+// their replies
+func CarryOverAttendees(newAttendees []*Attendee, oldAttendees []*Attendee) {
+	for _, newAttendee := range newAttendees {
+		for _, oldAttendee := range oldAttendees {
+			if strings.EqualFold(newAttendee.Data, oldAttendee.Data) {
+				eventID := newAttendee.EventID
+				*newAttendee = *oldAttendee
+				newAttendee.EventID = eventID
+				break
+			}
+		}
+	}
+}
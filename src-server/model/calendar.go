@@ -1,12 +1,46 @@
 package model
 
-import "github.com/uptrace/bun"
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
 
 type Calendar struct {
 	bun.BaseModel `bun:"table:calendars"`
 
-	ChannelID string `bun:"channel_id,pk"` // required
-	Name      string `bun:"name,notnull"`  // required
+	ChannelID string `bun:"channel_id,pk"`              // required
+	Name      string `bun:"name,notnull"`               // required
+	FeedToken string `bun:"feed_token,unique,nullzero"` // the secret part of the feed URL, see GetFeedToken
 
 	Events []*Event `bun:"rel:has-many,join:channel_id=channel_id"`
 }
+
+// Get the token the iCalendar feed of the calendar is served at. The channel
+// IDs are public, so the feed is keyed by a random token instead, created the
+// first time it's asked for.
+func (c *Calendar) GetFeedToken(ctx context.Context, db bun.IDB) (string, error) {
+	if c.FeedToken != "" {
+		return c.FeedToken, nil
+	}
+	// another request may be creating the token at the same time, the first
+	// one wins
+	if _, err := db.NewUpdate().
+		Model((*Calendar)(nil)).
+		Set("feed_token = ?", uuid.NewString()).
+		Where("channel_id = ?", c.ChannelID).
+		Where("feed_token IS NULL").
+		Exec(ctx); err != nil {
+		return "", fmt.Errorf("Calendar.GetFeedToken: can't save feed token: %w", err)
+	}
+	if err := db.NewSelect().
+		Model((*Calendar)(nil)).
+		Column("feed_token").
+		Where("channel_id = ?", c.ChannelID).
+		Scan(ctx, &c.FeedToken); err != nil {
+		return "", fmt.Errorf("Calendar.GetFeedToken: can't get feed token: %w", err)
+	}
+	return c.FeedToken, nil
+}
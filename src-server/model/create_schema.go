@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"reflect"
 
 	"github.com/uptrace/bun"
 )
@@ -11,9 +12,11 @@ import (
 func CreateSchema(db *bun.DB) error {
 	if err := db.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
 		for _, model := range []interface{}{
+			(*Alarm)(nil),
 			(*Attendee)(nil),
 			(*Calendar)(nil),
 			(*Event)(nil),
+			(*EventOverride)(nil),
 			(*ExternalCalendar)(nil),
 			(*KanbanGroup)(nil),
 			(*KanbanItem)(nil),
@@ -27,6 +30,9 @@ func CreateSchema(db *bun.DB) error {
 				Exec(context.Background()); err != nil {
 				return err
 			}
+			if err := addMissingColumns(ctx, tx, model); err != nil {
+				return err
+			}
 		}
 		return nil
 	}); err != nil {
@@ -35,3 +41,48 @@ func CreateSchema(db *bun.DB) error {
 
 	return nil
 }
+
+// CREATE TABLE IF NOT EXISTS leaves the existing tables untouched, so the
+// columns added to a model later on have to be added by hand.
+func addMissingColumns(ctx context.Context, tx bun.Tx, model interface{}) error {
+	table := tx.Dialect().Tables().Get(reflect.TypeOf(model))
+
+	existingColumns := make(map[string]struct{})
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table.Name)
+	if err != nil {
+		return fmt.Errorf("can't get columns of %s: %w", table.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("can't get columns of %s: %w", table.Name, err)
+		}
+		existingColumns[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't get columns of %s: %w", table.Name, err)
+	}
+
+	for _, field := range table.Fields {
+		if _, ok := existingColumns[field.Name]; ok {
+			continue
+		}
+		// SQLite can only add a NOT NULL column if it has a default value
+		column := fmt.Sprintf("%s %s", field.SQLName, field.CreateTableSQLType)
+		if field.SQLDefault != "" {
+			column += " DEFAULT " + field.SQLDefault
+			if field.NotNull {
+				column += " NOT NULL"
+			}
+		}
+		if _, err := tx.
+			NewAddColumn().
+			Model(model).
+			ColumnExpr(column).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't add column %s to %s: %w", field.Name, table.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package model_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"towd/src-server/model"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// A calendar imported before the refreshes were scheduled is due for one
+// once the schema is migrated.
+func TestCreateSchemaMigratesExternalCalendars(t *testing.T) {
+	rawDB, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	if err != nil {
+		t.Fatalf("sql.Open: %s", err)
+	}
+	// every connection to :memory: gets its own database
+	rawDB.SetMaxOpenConns(1)
+	db := bun.NewDB(rawDB, sqlitedialect.New())
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, query := range []string{
+		`CREATE TABLE external_calendars (
+			id VARCHAR NOT NULL PRIMARY KEY,
+			prod_id VARCHAR,
+			name VARCHAR NOT NULL,
+			description VARCHAR,
+			url VARCHAR UNIQUE,
+			hash VARCHAR UNIQUE,
+			channel_id VARCHAR
+		)`,
+		`INSERT INTO external_calendars (id, name, url, hash, channel_id)
+			VALUES ('calendar', 'Team', 'https://example.com/team.ics', 'hash', 'channel')`,
+	} {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			t.Fatalf("old schema: %s", err)
+		}
+	}
+
+	if err := model.CreateSchema(db); err != nil {
+		t.Fatalf("CreateSchema: %s", err)
+	}
+
+	externalCalendars := []model.ExternalCalendar{}
+	if err := db.NewSelect().
+		Model(&externalCalendars).
+		Where("next_refresh_at <= ?", time.Now().UTC().Unix()).
+		Scan(ctx); err != nil {
+		t.Fatalf("select: %s", err)
+	}
+	if len(externalCalendars) != 1 || externalCalendars[0].ID != "calendar" {
+		t.Fatalf("calendars due for a refresh: %+v, want the old one", externalCalendars)
+	}
+	if externalCalendars[0].Url != "https://example.com/team.ics" || externalCalendars[0].NextRefreshAt != 0 {
+		t.Errorf("migrated calendar: %+v", externalCalendars[0])
+	}
+}
@@ -0,0 +1,312 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/ical/event"
+	"towd/src-server/ical/utils"
+
+	"github.com/uptrace/bun"
+)
+
+// Get the ID of the event imported from an iCalendar event, see EventFromIcal.
+// It's derived from the UID and the channel, so the same event imported in two
+// channels doesn't clash.
+func EventIDFromIcal(uid string, channelID string) string {
+	return fmt.Sprintf("%s-%s", uid, channelID)
+}
+
+// Create an event from an iCalendar event, along with its attendees, the
+// overrides of its occurrences and its alarms, see InsertEvents. The ID is
+// derived from the UID and the channel, see EventIDFromIcal.
+func EventFromIcal(masterEvent *event.MasterEvent, calendarID string, channelID string) Event {
+	eventModel := Event{
+		ID:               EventIDFromIcal(masterEvent.GetID(), channelID),
+		Summary:          masterEvent.GetSummary(),
+		Description:      masterEvent.GetDescription(),
+		Location:         masterEvent.GetLocation(),
+		URL:              masterEvent.GetURL(),
+		Organizer:        ical.OrganizerName(&masterEvent.EventInfo),
+		StartDateUnixUTC: masterEvent.GetStartDate(),
+		EndDateUnixUTC:   masterEvent.GetEndDate(),
+		IsWholeDay:       masterEvent.IsWholeDay(),
+		IsFloating:       masterEvent.GetDateKind() == utils.DateKindFloating,
+		HasDuration:      masterEvent.HasDuration(),
+		RRule:            masterEvent.GetRRule(),
+		Tzid:             masterEvent.GetTzid(),
+		Status:           string(masterEvent.GetStatus()),
+		Categories:       masterEvent.GetCategories(),
+		Priority:         masterEvent.GetPriority(),
+		Class:            string(masterEvent.GetClass()),
+		Transp:           string(masterEvent.GetTransp()),
+		Geo:              masterEvent.GetGeo(),
+		Attachments:      masterEvent.GetAttach(),
+		CalendarID:       calendarID,
+		ChannelID:        channelID,
+	}
+	if timezone := masterEvent.GetTimezone(); timezone != nil {
+		var sb strings.Builder
+		timezone.ToIcal(func(line string) {
+			sb.WriteString(line)
+		})
+		eventModel.Timezone = sb.String()
+	}
+	masterEvent.IterateExDates(func(exDate int64) {
+		eventModel.ExDates = append(eventModel.ExDates, exDate)
+	})
+	masterEvent.IterateRDates(func(rDate int64) {
+		eventModel.RDates = append(eventModel.RDates, rDate)
+	})
+	for _, attendee := range masterEvent.GetAttendee() {
+		attendeeModel := AttendeeFromIcal(&attendee, eventModel.ID)
+		eventModel.Attendees = append(eventModel.Attendees, &attendeeModel)
+	}
+
+	masterEvent.IterateChildEvents(func(id string, childEvent *event.ChildEvent) error {
+		eventModel.Overrides = append(eventModel.Overrides, &EventOverride{
+			EventID:          eventModel.ID,
+			RecurrenceID:     childEvent.GetRecurrenceID(),
+			Summary:          childEvent.GetSummary(),
+			Description:      childEvent.GetDescription(),
+			Location:         childEvent.GetLocation(),
+			URL:              childEvent.GetURL(),
+			Status:           string(childEvent.GetStatus()),
+			StartDateUnixUTC: childEvent.GetStartDate(),
+			EndDateUnixUTC:   childEvent.GetEndDate(),
+			ThisAndFuture:    childEvent.IsThisAndFuture(),
+		})
+		return nil
+	})
+
+	// the alarms of the overrides are left out, the ones of the event remind
+	// of every occurrence
+	for _, alarm := range masterEvent.GetAlarm() {
+		alarmModel := AlarmFromIcal(&alarm, eventModel.ID)
+		eventModel.Alarms = append(eventModel.Alarms, &alarmModel)
+	}
+	return eventModel
+}
+
+// Insert the events, along with their attendees, overrides and alarms
+func InsertEvents(ctx context.Context, db bun.IDB, eventModels []Event) error {
+	if len(eventModels) == 0 {
+		return nil
+	}
+	attendeeModels := make([]*Attendee, 0)
+	overrideModels := make([]*EventOverride, 0)
+	alarmModels := make([]*Alarm, 0)
+	for _, eventModel := range eventModels {
+		attendeeModels = append(attendeeModels, eventModel.Attendees...)
+		overrideModels = append(overrideModels, eventModel.Overrides...)
+		alarmModels = append(alarmModels, eventModel.Alarms...)
+	}
+
+	if _, err := db.NewInsert().
+		Model(&eventModels).
+		Exec(ctx); err != nil {
+		return fmt.Errorf("InsertEvents: %w", err)
+	}
+	if len(attendeeModels) > 0 {
+		if _, err := db.NewInsert().
+			Model(&attendeeModels).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("InsertEvents: can't insert attendees: %w", err)
+		}
+	}
+	if len(overrideModels) > 0 {
+		if _, err := db.NewInsert().
+			Model(&overrideModels).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("InsertEvents: can't insert overrides: %w", err)
+		}
+	}
+	if len(alarmModels) > 0 {
+		if _, err := db.NewInsert().
+			Model(&alarmModels).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("InsertEvents: can't insert alarms: %w", err)
+		}
+	}
+	return nil
+}
+
+// The event as an iCalendar event, without its overrides, along with its
+// alarms if they are loaded
+func (e *Event) toUndecidedEvent() event.UndecidedEvent {
+	undecidedEvent := event.NewUndecidedEvent()
+	undecidedEvent.
+		SetID(e.ID).
+		SetSummary(e.Summary).
+		SetDescription(e.Description).
+		SetLocation(e.Location).
+		SetURL(e.URL).
+		SetStartDate(e.StartDateUnixUTC).
+		SetEndDate(e.EndDateUnixUTC).
+		SetTzid(e.Tzid).
+		SetDateKind(e.DateKind()).
+		SetRRuleSet(e.RRule).
+		SetExDate(e.ExDates).
+		SetRDate(e.RDates).
+		SetStatus(event.EventStatus(e.Status)).
+		SetCategories(e.Categories).
+		SetPriority(e.Priority).
+		SetClass(event.EventClass(e.Class)).
+		SetTransp(event.EventTransp(e.Transp)).
+		SetGeo(e.Geo)
+	if e.Timezone != "" {
+		if timezone, err := ical.ParseTimezone(e.Timezone); err != nil {
+			slog.Warn("(*Event).toUndecidedEvent: can't parse timezone", "eventID", e.ID, "tzid", e.Tzid, "error", err)
+		} else {
+			undecidedEvent.SetTimezone(timezone)
+		}
+	}
+	if e.HasDuration {
+		undecidedEvent.SetDuration(e.EndDateUnixUTC - e.StartDateUnixUTC)
+	}
+	for _, attachment := range e.Attachments {
+		undecidedEvent.AddAttach(attachment)
+	}
+	for _, alarmModel := range e.Alarms {
+		undecidedEvent.AddAlarm(alarmModel.ToIcalAlarm())
+	}
+	return undecidedEvent
+}
+
+// Build the iCalendar event of the event, along with its attendees, the
+// overrides of its occurrences and its alarms. The relations must be loaded,
+// e.g. with Relation("Overrides").
+func (e *Event) ToIcalEvent() (*event.MasterEvent, error) {
+	undecidedEvent := e.toUndecidedEvent()
+	undecidedEvent.SetOrganizer(e.Organizer)
+	for _, attendeeModel := range e.Attendees {
+		if attendee, ok := attendeeModel.ToIcalAttendee(); ok {
+			undecidedEvent.AddAttendee(attendee)
+		}
+	}
+	icalEventInter, err := undecidedEvent.DecideEventType()
+	if err != nil {
+		return nil, fmt.Errorf("(*Event).ToIcalEvent: %w", err)
+	}
+	icalEvent, ok := icalEventInter.(event.MasterEvent)
+	if !ok {
+		return nil, fmt.Errorf("(*Event).ToIcalEvent: not a master event")
+	}
+
+	for _, overrideModel := range e.Overrides {
+		undecidedChild := event.NewUndecidedEvent()
+		undecidedChild.
+			SetID(e.ID).
+			SetSummary(overrideModel.Summary).
+			SetDescription(overrideModel.Description).
+			SetLocation(overrideModel.Location).
+			SetURL(overrideModel.URL).
+			SetStatus(event.EventStatus(overrideModel.Status)).
+			SetStartDate(overrideModel.StartDateUnixUTC).
+			SetEndDate(overrideModel.EndDateUnixUTC).
+			SetTzid(e.Tzid).
+			SetTimezone(icalEvent.GetTimezone()).
+			SetDateKind(e.DateKind()).
+			SetOrganizer(e.Organizer).
+			SetRecurrenceID(overrideModel.RecurrenceID).
+			SetThisAndFuture(overrideModel.ThisAndFuture)
+		// a bad override, e.g. of a date the series doesn't have anymore,
+		// is left out rather than the whole series
+		childEventInter, err := undecidedChild.DecideEventType()
+		if err != nil {
+			slog.Warn("(*Event).ToIcalEvent: skipping override", "eventID", e.ID, "recurrenceID", overrideModel.RecurrenceID, "error", err)
+			continue
+		}
+		childEvent, ok := childEventInter.(event.ChildEvent)
+		if !ok {
+			slog.Warn("(*Event).ToIcalEvent: skipping override", "eventID", e.ID, "recurrenceID", overrideModel.RecurrenceID, "error", "not a child event")
+			continue
+		}
+		if err := icalEvent.AddChildEvent(&childEvent); err != nil {
+			slog.Warn("(*Event).ToIcalEvent: skipping override", "eventID", e.ID, "recurrenceID", overrideModel.RecurrenceID, "error", err)
+			continue
+		}
+	}
+	return &icalEvent, nil
+}
+
+// Expand the event into its occurrences overlapping the [from, to) window.
+// Each occurrence is a copy of the event with the dates, and the overridden
+// fields, of the occurrence. A non-recurring event is its only occurrence.
+func (e *Event) Occurrences(from time.Time, to time.Time) ([]Event, error) {
+	icalEvent, err := e.ToIcalEvent()
+	if err != nil {
+		return nil, fmt.Errorf("(*Event).Occurrences: %w", err)
+	}
+	next, err := icalEvent.Occurrences(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("(*Event).Occurrences: %w", err)
+	}
+
+	occurrences := make([]Event, 0)
+	for icalOccurrence, ok := next(); ok; icalOccurrence, ok = next() {
+		occurrence := *e
+		occurrence.Summary = icalOccurrence.Info.GetSummary()
+		occurrence.Description = icalOccurrence.Info.GetDescription()
+		occurrence.Location = icalOccurrence.Info.GetLocation()
+		occurrence.URL = icalOccurrence.Info.GetURL()
+		occurrence.Status = string(icalOccurrence.Info.GetStatus())
+		occurrence.StartDateUnixUTC = icalOccurrence.StartDate
+		// keep the events without an end date as they are
+		if e.EndDateUnixUTC != 0 || icalOccurrence.EndDate != icalOccurrence.StartDate {
+			occurrence.EndDateUnixUTC = icalOccurrence.EndDate
+		}
+		if e.RRule != "" {
+			occurrence.RecurrenceID = icalOccurrence.RecurrenceID
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences, nil
+}
+
+// Get the occurrences of the events overlapping the [from, to) window, sorted
+// by start date, skipping the events that can't be expanded. The filter
+// narrows down the events to expand, e.g. to a channel, and may be nil. The
+// attendees, overrides and alarms are loaded.
+func SelectOccurrences(ctx context.Context, db bun.IDB, from time.Time, to time.Time, filter func(q *bun.SelectQuery) *bun.SelectQuery) ([]Event, error) {
+	eventModels := make([]Event, 0)
+	query := db.
+		NewSelect().
+		Model(&eventModels).
+		Relation("Attendees").
+		Relation("Overrides").
+		Relation("Alarms").
+		Where("start_date < ?", to.Unix()).
+		// a recurring event can occur long after its start date
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("rrule != ''").
+				WhereOr("end_date > ?", from.Unix()).
+				WhereOr("start_date >= ?", from.Unix())
+		})
+	if filter != nil {
+		query = filter(query)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("SelectOccurrences: %w", err)
+	}
+
+	occurrences := make([]Event, 0)
+	for _, eventModel := range eventModels {
+		// one broken recurrence mustn't hide all the other events
+		eventOccurrences, err := eventModel.Occurrences(from, to)
+		if err != nil {
+			slog.Warn("SelectOccurrences: can't expand event", "eventID", eventModel.ID, "error", err)
+			continue
+		}
+		occurrences = append(occurrences, eventOccurrences...)
+	}
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartDateUnixUTC < occurrences[j].StartDateUnixUTC
+	})
+	return occurrences, nil
+}
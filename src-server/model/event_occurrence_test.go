@@ -0,0 +1,93 @@
+package model_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/ical/event"
+	"towd/src-server/model"
+)
+
+// An Outlook series stored and read back keeps its VTIMEZONE, so the
+// occurrences after the change to summer time and their overrides still
+// line up, and an override the series doesn't have is left out on its own.
+func TestOccurrencesOfStoredEvent(t *testing.T) {
+	input := `BEGIN:VCALENDAR
+PRODID:-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:weekly@example.com
+RRULE:FREQ=WEEKLY;COUNT=4;BYDAY=MO
+SUMMARY:Weekly
+DTSTART;TZID=W. Europe Standard Time:20250324T090000
+DTEND;TZID=W. Europe Standard Time:20250324T093000
+DTSTAMP:20250301T000000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250407T090000
+SUMMARY:Weekly (late)
+DTSTART;TZID=W. Europe Standard Time:20250407T110000
+DTEND;TZID=W. Europe Standard Time:20250407T113000
+DTSTAMP:20250301T000000Z
+END:VEVENT
+END:VCALENDAR
+`
+	cal, _, customErr := ical.Parse(context.Background(), strings.NewReader(input), ical.ParseOptions{Strict: true})
+	if customErr != nil {
+		t.Fatalf("Parse: %s", customErr)
+	}
+	var eventModel model.Event
+	cal.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+		eventModel = model.EventFromIcal(masterEvent, "calendar", "channel")
+		return nil
+	})
+	if eventModel.Timezone == "" {
+		t.Fatalf("the VTIMEZONE of %q isn't stored", eventModel.Tzid)
+	}
+	// a Tuesday, which the series doesn't have
+	eventModel.Overrides = append(eventModel.Overrides, &model.EventOverride{
+		EventID:          eventModel.ID,
+		RecurrenceID:     time.Date(2025, 4, 8, 7, 0, 0, 0, time.UTC).Unix(),
+		Summary:          "Weekly (gone)",
+		StartDateUnixUTC: time.Date(2025, 4, 8, 7, 0, 0, 0, time.UTC).Unix(),
+		EndDateUnixUTC:   time.Date(2025, 4, 8, 7, 30, 0, 0, time.UTC).Unix(),
+	})
+
+	occurrences, err := eventModel.Occurrences(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Occurrences: %s", err)
+	}
+	got := make([]string, 0, len(occurrences))
+	for _, occurrence := range occurrences {
+		got = append(got, fmt.Sprintf("%s %s", time.Unix(occurrence.StartDateUnixUTC, 0).UTC().Format("2006-01-02 15:04"), occurrence.Summary))
+	}
+	want := []string{
+		"2025-03-24 08:00 Weekly",
+		"2025-03-31 07:00 Weekly",
+		"2025-04-07 09:00 Weekly (late)",
+		"2025-04-14 07:00 Weekly",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("occurrences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/uptrace/bun"
+)
+
+// An occurrence of a recurring event that differs from the recurrence rule,
+// e.g. moved to another date or renamed (iCalendar RECURRENCE-ID)
+type EventOverride struct {
+	bun.BaseModel `bun:"table:event_overrides"`
+
+	EventID      string `bun:"event_id,pk"`      // required
+	RecurrenceID int64  `bun:"recurrence_id,pk"` // required, the start date the rule gives to the occurrence
+	Summary      string `bun:"summary,notnull"`  // required
+	Description  string `bun:"description"`
+	Location     string `bun:"location"`
+	URL          string `bun:"url"`
+	Status       string `bun:"status"` // iCalendar STATUS, e.g. CANCELLED for a cancelled occurrence
+
+	StartDateUnixUTC int64 `bun:"start_date,notnull"` // required
+	EndDateUnixUTC   int64 `bun:"end_date,notnull"`
+	// RECURRENCE-ID;RANGE=THISANDFUTURE, the following occurrences are
+	// overridden as well
+	ThisAndFuture bool `bun:"this_and_future"`
+
+	Event *Event `bun:"rel:belongs-to,join:event_id=id"`
+}
@@ -0,0 +1,307 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// What SyncEvents or MergeEvents did to the events of a calendar
+type SyncResult struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unchanged int
+}
+
+// Replace the events of a calendar with the given ones, e.g. built with
+// EventFromIcal, while keeping the identity of those still there: the events
+// are matched by ID, i.e. by UID, and their overrides by recurrence ID. Only
+// the changed rows are written. The updated events keep their creation date
+// and notification state, so their reminders aren't sent again.
+func SyncEvents(ctx context.Context, db bun.IDB, calendarID string, eventModels []Event) (SyncResult, error) {
+	result, err := syncEvents(ctx, db, calendarID, eventModels, true)
+	if err != nil {
+		return result, fmt.Errorf("SyncEvents: %w", err)
+	}
+	return result, nil
+}
+
+// Add the given events to a calendar, the ones it already has are updated as
+// with SyncEvents and the others are left as they are
+func MergeEvents(ctx context.Context, db bun.IDB, calendarID string, eventModels []Event) (SyncResult, error) {
+	result, err := syncEvents(ctx, db, calendarID, eventModels, false)
+	if err != nil {
+		return result, fmt.Errorf("MergeEvents: %w", err)
+	}
+	return result, nil
+}
+
+func syncEvents(ctx context.Context, db bun.IDB, calendarID string, eventModels []Event, removeMissing bool) (SyncResult, error) {
+	result := SyncResult{}
+	oldEventModels := make([]Event, 0)
+	if err := db.NewSelect().
+		Model(&oldEventModels).
+		Relation("Attendees").
+		Relation("Overrides").
+		Relation("Alarms").
+		Where("calendar_id = ?", calendarID).
+		Scan(ctx); err != nil {
+		return result, fmt.Errorf("can't get old events: %w", err)
+	}
+	oldEventModelsByID := make(map[string]*Event, len(oldEventModels))
+	for i := range oldEventModels {
+		oldEventModelsByID[oldEventModels[i].ID] = &oldEventModels[i]
+	}
+
+	addedEventModels := make([]Event, 0)
+	for _, eventModel := range eventModels {
+		oldEventModel, ok := oldEventModelsByID[eventModel.ID]
+		if !ok {
+			addedEventModels = append(addedEventModels, eventModel)
+			continue
+		}
+		delete(oldEventModelsByID, eventModel.ID)
+
+		if oldEventModel.sameContent(&eventModel) &&
+			sameAttendees(oldEventModel.Attendees, eventModel.Attendees) &&
+			sameAlarms(oldEventModel.Alarms, eventModel.Alarms) &&
+			sameOverrides(oldEventModel.Overrides, eventModel.Overrides) {
+			result.Unchanged++
+			continue
+		}
+		if err := updateEvent(ctx, db, oldEventModel, &eventModel); err != nil {
+			return result, fmt.Errorf("event %s: %w", eventModel.ID, err)
+		}
+		result.Updated++
+	}
+
+	if err := InsertEvents(ctx, db, addedEventModels); err != nil {
+		return result, err
+	}
+	result.Added = len(addedEventModels)
+
+	if !removeMissing {
+		return result, nil
+	}
+	removedIDs := make([]string, 0, len(oldEventModelsByID))
+	for id := range oldEventModelsByID {
+		removedIDs = append(removedIDs, id)
+	}
+	if err := DeleteEvents(ctx, db, removedIDs); err != nil {
+		return result, err
+	}
+	result.Removed = len(removedIDs)
+
+	return result, nil
+}
+
+// Delete the events, along with their attendees, overrides and alarms
+func DeleteEvents(ctx context.Context, db bun.IDB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := db.NewDelete().
+		Model((*EventOverride)(nil)).
+		Where("event_id IN (?)", bun.In(ids)).
+		Exec(ctx); err != nil {
+		return fmt.Errorf("DeleteEvents: can't delete overrides: %w", err)
+	}
+	if _, err := db.NewDelete().
+		Model((*Alarm)(nil)).
+		Where("event_id IN (?)", bun.In(ids)).
+		Exec(ctx); err != nil {
+		return fmt.Errorf("DeleteEvents: can't delete alarms: %w", err)
+	}
+	if _, err := db.NewDelete().
+		Model((*Attendee)(nil)).
+		Where("event_id IN (?)", bun.In(ids)).
+		Exec(ctx); err != nil {
+		return fmt.Errorf("DeleteEvents: can't delete attendees: %w", err)
+	}
+	if _, err := db.NewDelete().
+		Model((*Event)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx); err != nil {
+		return fmt.Errorf("DeleteEvents: can't delete events: %w", err)
+	}
+	return nil
+}
+
+// Write the differences between the stored event and its new version, the
+// rows that didn't change are left as they are
+func updateEvent(ctx context.Context, db bun.IDB, oldEventModel *Event, eventModel *Event) error {
+	if !oldEventModel.sameContent(eventModel) {
+		eventModel.CreatedAt = oldEventModel.CreatedAt
+		eventModel.UpdatedAt = time.Now().UTC().Unix()
+		eventModel.NotificationSent = oldEventModel.NotificationSent
+		eventModel.NotifiedUntil = oldEventModel.NotifiedUntil
+		if _, err := db.NewUpdate().
+			Model(eventModel).
+			WherePK().
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't update event: %w", err)
+		}
+	}
+
+	// the attendees and alarms have no identity of their own
+	if !sameAttendees(oldEventModel.Attendees, eventModel.Attendees) {
+		if _, err := db.NewDelete().
+			Model((*Attendee)(nil)).
+			Where("event_id = ?", eventModel.ID).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't delete attendees: %w", err)
+		}
+		if len(eventModel.Attendees) > 0 {
+			if _, err := db.NewInsert().
+				Model(&eventModel.Attendees).
+				Exec(ctx); err != nil {
+				return fmt.Errorf("can't insert attendees: %w", err)
+			}
+		}
+	}
+	if !sameAlarms(oldEventModel.Alarms, eventModel.Alarms) {
+		if _, err := db.NewDelete().
+			Model((*Alarm)(nil)).
+			Where("event_id = ?", eventModel.ID).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't delete alarms: %w", err)
+		}
+		if len(eventModel.Alarms) > 0 {
+			if _, err := db.NewInsert().
+				Model(&eventModel.Alarms).
+				Exec(ctx); err != nil {
+				return fmt.Errorf("can't insert alarms: %w", err)
+			}
+		}
+	}
+
+	// the overrides are matched by recurrence ID
+	oldOverrideModels := make(map[int64]*EventOverride, len(oldEventModel.Overrides))
+	for _, overrideModel := range oldEventModel.Overrides {
+		oldOverrideModels[overrideModel.RecurrenceID] = overrideModel
+	}
+	for _, overrideModel := range eventModel.Overrides {
+		oldOverrideModel, ok := oldOverrideModels[overrideModel.RecurrenceID]
+		delete(oldOverrideModels, overrideModel.RecurrenceID)
+		if ok && oldOverrideModel.sameContent(overrideModel) {
+			continue
+		}
+		if _, err := db.NewInsert().
+			Model(overrideModel).
+			On("CONFLICT (event_id, recurrence_id) DO UPDATE").
+			Set("summary = EXCLUDED.summary").
+			Set("description = EXCLUDED.description").
+			Set("location = EXCLUDED.location").
+			Set("url = EXCLUDED.url").
+			Set("status = EXCLUDED.status").
+			Set("start_date = EXCLUDED.start_date").
+			Set("end_date = EXCLUDED.end_date").
+			Set("this_and_future = EXCLUDED.this_and_future").
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't upsert override %d: %w", overrideModel.RecurrenceID, err)
+		}
+	}
+	for recurrenceID := range oldOverrideModels {
+		if _, err := db.NewDelete().
+			Model((*EventOverride)(nil)).
+			Where("event_id = ?", eventModel.ID).
+			Where("recurrence_id = ?", recurrenceID).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("can't delete override %d: %w", recurrenceID, err)
+		}
+	}
+	return nil
+}
+
+// Check if two versions of an event hold the same data, regardless of their
+// relations and of their state, e.g. whether they were reminded of
+func (e *Event) sameContent(other *Event) bool {
+	return e.Summary == other.Summary &&
+		e.Description == other.Description &&
+		e.Location == other.Location &&
+		e.URL == other.URL &&
+		e.Organizer == other.Organizer &&
+		e.StartDateUnixUTC == other.StartDateUnixUTC &&
+		e.EndDateUnixUTC == other.EndDateUnixUTC &&
+		e.IsWholeDay == other.IsWholeDay &&
+		e.IsFloating == other.IsFloating &&
+		e.HasDuration == other.HasDuration &&
+		e.RRule == other.RRule &&
+		slices.Equal(e.ExDates, other.ExDates) &&
+		slices.Equal(e.RDates, other.RDates) &&
+		e.Tzid == other.Tzid &&
+		e.Timezone == other.Timezone &&
+		e.Status == other.Status &&
+		slices.Equal(e.Categories, other.Categories) &&
+		e.Priority == other.Priority &&
+		e.Class == other.Class &&
+		e.Transp == other.Transp &&
+		(e.Geo == nil) == (other.Geo == nil) &&
+		(e.Geo == nil || *e.Geo == *other.Geo) &&
+		slices.Equal(e.Attachments, other.Attachments) &&
+		e.Sequence == other.Sequence &&
+		e.CalendarID == other.CalendarID &&
+		e.ChannelID == other.ChannelID
+}
+
+func (o *EventOverride) sameContent(other *EventOverride) bool {
+	return o.EventID == other.EventID &&
+		o.RecurrenceID == other.RecurrenceID &&
+		o.Summary == other.Summary &&
+		o.Description == other.Description &&
+		o.Location == other.Location &&
+		o.URL == other.URL &&
+		o.Status == other.Status &&
+		o.StartDateUnixUTC == other.StartDateUnixUTC &&
+		o.EndDateUnixUTC == other.EndDateUnixUTC &&
+		o.ThisAndFuture == other.ThisAndFuture
+}
+
+func sameAttendees(a []*Attendee, b []*Attendee) bool {
+	return slices.EqualFunc(a, b, func(a *Attendee, b *Attendee) bool {
+		return a.EventID == b.EventID &&
+			a.Data == b.Data &&
+			a.UserID == b.UserID &&
+			a.Address == b.Address &&
+			a.CuType == b.CuType &&
+			a.Role == b.Role &&
+			a.PartStat == b.PartStat &&
+			a.Rsvp == b.Rsvp &&
+			slices.Equal(a.DelegatedTo, b.DelegatedTo) &&
+			slices.Equal(a.DelegatedFrom, b.DelegatedFrom) &&
+			a.SentBy == b.SentBy
+	})
+}
+
+func sameAlarms(a []*Alarm, b []*Alarm) bool {
+	return slices.EqualFunc(a, b, func(a *Alarm, b *Alarm) bool {
+		return a.EventID == b.EventID &&
+			a.Action == b.Action &&
+			a.TriggerOffset == b.TriggerOffset &&
+			a.TriggerRelated == b.TriggerRelated &&
+			a.TriggerDateUnixUTC == b.TriggerDateUnixUTC &&
+			a.Repeat == b.Repeat &&
+			a.Duration == b.Duration &&
+			a.Description == b.Description
+	})
+}
+
+func sameOverrides(a []*EventOverride, b []*EventOverride) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	overrides := make(map[int64]*EventOverride, len(a))
+	for _, override := range a {
+		overrides[override.RecurrenceID] = override
+	}
+	for _, override := range b {
+		if other, ok := overrides[override.RecurrenceID]; !ok || !override.sameContent(other) {
+			return false
+		}
+	}
+	return true
+}
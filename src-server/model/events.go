@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
+	"towd/src-server/ical"
+	"towd/src-server/ical/event"
+	"towd/src-server/ical/structured"
+	"towd/src-server/ical/utils"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/uptrace/bun"
+	"github.com/xyedo/rrule"
 )
 
 type EventIDCtxKeyType string
@@ -27,7 +33,28 @@ type Event struct {
 
 	StartDateUnixUTC int64 `bun:"start_date,notnull"` // required
 	EndDateUnixUTC   int64 `bun:"end_date,notnull"`   // required
-	IsWholeDay       bool  `bun:"is_whole_day"`
+	IsWholeDay       bool  `bun:"is_whole_day"`       // iCalendar DATE values, at midnight UTC
+	IsFloating       bool  `bun:"is_floating"`        // the same wall clock time everywhere, stored as if in UTC
+	HasDuration      bool  `bun:"has_duration"`       // iCalendar DURATION instead of DTEND
+
+	// The recurrence of the event, expanded on read, see SelectOccurrences
+	RRule   string  `bun:"rrule"` // iCalendar RRULE value, e.g. FREQ=WEEKLY;COUNT=4
+	ExDates []int64 `bun:"ex_dates"`
+	RDates  []int64 `bun:"r_dates"`
+	Tzid    string  `bun:"tzid"` // the timezone the recurrence is computed in
+	// The VTIMEZONE defining Tzid when the IANA database doesn't know it,
+	// e.g. Outlook's "W. Europe Standard Time"
+	Timezone string `bun:"timezone"`
+
+	// iCalendar STATUS, CATEGORIES, PRIORITY, CLASS and TRANSP, blank if
+	// undefined
+	Status      string             `bun:"status"`
+	Categories  []string           `bun:"categories"`
+	Priority    int                `bun:"priority"` // 1 is the highest, 9 the lowest
+	Class       string             `bun:"class"`
+	Transp      string             `bun:"transp"`
+	Geo         *event.Geo         `bun:"geo"`
+	Attachments []event.Attachment `bun:"attachments"`
 
 	CreatedAt int64 `bun:"created_at,notnull"`
 	UpdatedAt int64 `bun:"updated_at"`
@@ -37,9 +64,16 @@ type Event struct {
 	ChannelID  string `bun:"channel_id,notnull"`  // required
 
 	Attendees        []*Attendee       `bun:"rel:has-many,join:id=event_id"`
+	Overrides        []*EventOverride  `bun:"rel:has-many,join:id=event_id"`
+	Alarms           []*Alarm          `bun:"rel:has-many,join:id=event_id"`
 	Calendar         *Calendar         `bun:"rel:belongs-to,join:calendar_id=channel_id"`
 	ExternalCalendar *ExternalCalendar `bun:"rel:belongs-to,join:calendar_id=id"`
 	NotificationSent bool              `bun:"notification_sent"` // required
+	// The date of the last reminder sent, see scheduler.EventNotify
+	NotifiedUntil int64 `bun:"notified_until"`
+
+	// The occurrence an expanded event stands for, 0 for the event itself
+	RecurrenceID int64 `bun:"-"`
 }
 
 func (e *Event) Upsert(ctx context.Context, db bun.IDB) error {
@@ -59,15 +93,14 @@ func (e *Event) Upsert(ctx context.Context, db bun.IDB) error {
 			return fmt.Errorf("(*Event).Upsert: url is invalid: %w", err)
 		}
 	}
+	if e.RRule != "" {
+		if _, err := rrule.StrToRRule(e.RRule); err != nil {
+			return fmt.Errorf("(*Event).Upsert: rrule is invalid: %w", err)
+		}
+	}
 	if e.CreatedAt == 0 {
 		e.CreatedAt = time.Now().UTC().Unix()
 	}
-	startDateDate := time.Unix(e.StartDateUnixUTC, 0)
-	if startDateDate.Hour() == 0 &&
-		startDateDate.Minute() == 0 &&
-		startDateDate.Second() == 0 {
-		e.IsWholeDay = true
-	}
 
 	if _, err := db.NewInsert().
 		Model(e).
@@ -80,11 +113,26 @@ func (e *Event) Upsert(ctx context.Context, db bun.IDB) error {
 		Set("start_date = EXCLUDED.start_date").
 		Set("end_date = EXCLUDED.end_date").
 		Set("is_whole_day = EXCLUDED.is_whole_day").
+		Set("is_floating = EXCLUDED.is_floating").
+		Set("has_duration = EXCLUDED.has_duration").
+		Set("rrule = EXCLUDED.rrule").
+		Set("ex_dates = EXCLUDED.ex_dates").
+		Set("r_dates = EXCLUDED.r_dates").
+		Set("tzid = EXCLUDED.tzid").
+		Set("timezone = EXCLUDED.timezone").
+		Set("status = EXCLUDED.status").
+		Set("categories = EXCLUDED.categories").
+		Set("priority = EXCLUDED.priority").
+		Set("class = EXCLUDED.class").
+		Set("transp = EXCLUDED.transp").
+		Set("geo = EXCLUDED.geo").
+		Set("attachments = EXCLUDED.attachments").
 		Set("created_at = EXCLUDED.created_at").
 		Set("sequence = EXCLUDED.sequence").
 		Set("calendar_id = EXCLUDED.calendar_id").
 		Set("channel_id = EXCLUDED.channel_id").
 		Set("notification_sent = EXCLUDED.notification_sent").
+		Set("notified_until = EXCLUDED.notified_until").
 		Exec(ctx); err != nil {
 		return fmt.Errorf("(*Event).Upsert: %w", err)
 	}
@@ -92,19 +140,119 @@ func (e *Event) Upsert(ctx context.Context, db bun.IDB) error {
 	return nil
 }
 
+// Check if the event is cancelled (STATUS:CANCELLED), its reminders aren't
+// sent
+func (e *Event) IsCancelled() bool {
+	return e.Status == string(event.EventStatusCancelled)
+}
+
+// Check if the details of the event are meant for its attendees only
+// (CLASS:PRIVATE or CONFIDENTIAL), they aren't shown in the channel
+func (e *Event) IsPrivate() bool {
+	return e.Class != "" && e.Class != string(event.EventClassPublic)
+}
+
+// Check if the event takes up time, TRANSP:TRANSPARENT and cancelled events
+// don't
+func (e *Event) IsBusy() bool {
+	return e.Transp != string(event.EventTranspTransparent) && !e.IsCancelled()
+}
+
+// Get the type of the event's dates
+func (e *Event) DateKind() utils.DateKind {
+	switch {
+	case e.IsWholeDay:
+		return utils.DateKindDate
+	case e.IsFloating:
+		return utils.DateKindFloating
+	case e.Tzid != "":
+		return utils.DateKindTzid
+	default:
+		return utils.DateKindUTC
+	}
+}
+
+// Set the dates of the event from instants. The dates of a whole-day event
+// become the days they fall on in the location.
+func (e *Event) SetDates(startDate int64, endDate int64, isWholeDay bool, loc *time.Location) {
+	e.StartDateUnixUTC, e.EndDateUnixUTC = startDate, endDate
+	e.IsWholeDay, e.IsFloating = isWholeDay, false
+	if isWholeDay {
+		e.StartDateUnixUTC = utils.StartOfDay(startDate, loc)
+		if endDate != 0 {
+			e.EndDateUnixUTC = utils.StartOfDay(endDate, loc)
+		}
+	}
+}
+
+// Get the instant a date of the event stands for in the location: the
+// whole-day and floating dates are wall clock times, the others instants
+func (e *Event) Instant(unixTime int64, loc *time.Location) int64 {
+	switch e.DateKind() {
+	case utils.DateKindDate, utils.DateKindFloating:
+		if unixTime == 0 {
+			return 0
+		}
+		return utils.WallClock2Unix(unixTime, loc)
+	default:
+		return unixTime
+	}
+}
+
+// Format a date of the event for Discord. The whole-day and floating dates
+// are written as they are, the others are shown in the reader's timezone.
+func (e *Event) FormatDate(unixTime int64) string {
+	switch e.DateKind() {
+	case utils.DateKindDate:
+		return time.Unix(unixTime, 0).UTC().Format("Monday, January 2, 2006")
+	case utils.DateKindFloating:
+		return time.Unix(unixTime, 0).UTC().Format("Monday, January 2, 2006 15:04")
+	default:
+		return fmt.Sprintf("<t:%d:f>", unixTime)
+	}
+}
+
 func (e *Event) ToDiscordEmbed() *discordgo.MessageEmbed {
+	if e.IsPrivate() {
+		return &discordgo.MessageEmbed{
+			Title: "Private event",
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name:   "Start Date",
+					Value:  e.FormatDate(e.StartDateUnixUTC),
+					Inline: true,
+				},
+				{
+					Name:   "End Date",
+					Value:  e.FormatDate(e.EndDateUnixUTC),
+					Inline: true,
+				},
+			},
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: e.ID,
+			},
+		}
+	}
+
+	title := e.Summary
+	switch event.EventStatus(e.Status) {
+	case event.EventStatusCancelled:
+		title = "[Cancelled] " + title
+	case event.EventStatusTentative:
+		title = "[Tentative] " + title
+	}
 	embed := &discordgo.MessageEmbed{
-		Title:       e.Summary,
+		Title:       title,
 		Description: e.Description,
 		Fields: []*discordgo.MessageEmbedField{
 			{
 				Name:   "Start Date",
-				Value:  fmt.Sprintf("<t:%d:f>", e.StartDateUnixUTC),
+				Value:  e.FormatDate(e.StartDateUnixUTC),
 				Inline: true,
 			},
 			{
 				Name:   "End Date",
-				Value:  fmt.Sprintf("<t:%d:f>", e.EndDateUnixUTC),
+				Value:  e.FormatDate(e.EndDateUnixUTC),
 				Inline: true,
 			},
 		},
@@ -127,17 +275,92 @@ func (e *Event) ToDiscordEmbed() *discordgo.MessageEmbed {
 			Value: e.URL,
 		})
 	}
-
-	if len(e.Attendees) > 0 {
-		attendeeStr := make([]string, len(e.Attendees))
-		for i, attendee := range e.Attendees {
-			attendeeStr[i] = attendee.Data
+	if e.Geo != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Coordinates",
+			Value: fmt.Sprintf("%g, %g", e.Geo.Latitude, e.Geo.Longitude),
+		})
+	}
+	if len(e.Categories) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Categories",
+			Value: strings.Join(e.Categories, ", "),
+		})
+	}
+	if e.Priority != 0 {
+		// RFC5545 section 3.8.1.9
+		priority := "Low"
+		switch {
+		case e.Priority <= 4:
+			priority = "High"
+		case e.Priority == 5:
+			priority = "Medium"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Priority",
+			Value: priority,
+		})
+	}
+	if len(e.Attachments) > 0 {
+		attachments := make([]string, len(e.Attachments))
+		for i, attachment := range e.Attachments {
+			attachments[i] = attachment.URI
 		}
 		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-			Name:  "Attendees",
-			Value: strings.Join(attendeeStr, ", "),
+			Name:  "Attachments",
+			Value: strings.Join(attachments, "\n"),
 		})
 	}
+	if e.RRule != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Repeats",
+			Value: fmt.Sprintf("`%s`", e.RRule),
+		})
+	}
+
+	// the attendees grouped by participation status, the unusual ones last
+	attendeeGroups := make(map[string][]string)
+	for _, attendee := range e.Attendees {
+		partStat := attendee.PartStat
+		if partStat == "" {
+			partStat = string(structured.AttendeePartStatNeedsAction)
+		}
+		label := attendee.Data
+		if attendee.Role == string(structured.AttendeeRoleOpt) {
+			label += " (optional)"
+		}
+		attendeeGroups[partStat] = append(attendeeGroups[partStat], label)
+	}
+	groupNames := []struct {
+		partStat structured.AttendeeParticipantStatus
+		name     string
+	}{
+		{structured.AttendeePartStatAccepted, "Going"},
+		{structured.AttendeePartStatTentative, "Maybe"},
+		{structured.AttendeePartStatNeedsAction, "Invited"},
+		{structured.AttendeePartStatDelegated, "Delegated"},
+		{structured.AttendeePartStatDeclined, "Not going"},
+	}
+	addGroup := func(partStat string, name string) {
+		if attendees := attendeeGroups[partStat]; len(attendees) > 0 {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf("%s (%d)", name, len(attendees)),
+				Value: strings.Join(attendees, ", "),
+			})
+			delete(attendeeGroups, partStat)
+		}
+	}
+	for _, group := range groupNames {
+		addGroup(string(group.partStat), group.name)
+	}
+	otherPartStats := make([]string, 0, len(attendeeGroups))
+	for partStat := range attendeeGroups {
+		otherPartStats = append(otherPartStats, partStat)
+	}
+	slices.Sort(otherPartStats)
+	for _, partStat := range otherPartStats {
+		addGroup(partStat, partStat)
+	}
 
 	return embed
 }
@@ -179,22 +402,22 @@ func (e *Event) Diff(otherEvent *Event) DiffEvent {
 
 	switch newExist, oldExist, theSame := otherEvent.StartDateUnixUTC != 0, e.StartDateUnixUTC != 0, otherEvent.StartDateUnixUTC == e.StartDateUnixUTC; {
 	case newExist && oldExist && !theSame:
-		diff.StartDate = fmt.Sprintf("<t:%d:f> `[old value]` <t:%d:f>", otherEvent.StartDateUnixUTC, e.StartDateUnixUTC)
+		diff.StartDate = fmt.Sprintf("%s `[old value]` %s", otherEvent.FormatDate(otherEvent.StartDateUnixUTC), e.FormatDate(e.StartDateUnixUTC))
 	case newExist && !oldExist:
-		diff.StartDate = fmt.Sprintf("<t:%d:f> `[old value: None]`", otherEvent.StartDateUnixUTC)
+		diff.StartDate = fmt.Sprintf("%s `[old value: None]`", otherEvent.FormatDate(otherEvent.StartDateUnixUTC))
 	case (!newExist && oldExist) || (newExist && theSame):
-		diff.StartDate = fmt.Sprintf("<t:%d:f> `[unchanged]`", e.StartDateUnixUTC)
+		diff.StartDate = fmt.Sprintf("%s `[unchanged]`", e.FormatDate(e.StartDateUnixUTC))
 	default:
 		diff.StartDate = "None `[unchanged]`"
 	}
 
 	switch newExist, oldExist, theSame := otherEvent.EndDateUnixUTC != 0, e.EndDateUnixUTC != 0, otherEvent.EndDateUnixUTC == e.EndDateUnixUTC; {
 	case newExist && oldExist && !theSame:
-		diff.EndDate = fmt.Sprintf("<t:%d:f> `[old value]` <t:%d:f>", otherEvent.EndDateUnixUTC, e.EndDateUnixUTC)
+		diff.EndDate = fmt.Sprintf("%s `[old value]` %s", otherEvent.FormatDate(otherEvent.EndDateUnixUTC), e.FormatDate(e.EndDateUnixUTC))
 	case newExist && !oldExist:
-		diff.EndDate = fmt.Sprintf("<t:%d:f> `[old value: None]`", otherEvent.EndDateUnixUTC)
+		diff.EndDate = fmt.Sprintf("%s `[old value: None]`", otherEvent.FormatDate(otherEvent.EndDateUnixUTC))
 	case (!newExist && oldExist) || (newExist && theSame):
-		diff.EndDate = fmt.Sprintf("<t:%d:f> `[unchanged]`", e.EndDateUnixUTC)
+		diff.EndDate = fmt.Sprintf("%s `[unchanged]`", e.FormatDate(e.EndDateUnixUTC))
 	default:
 		diff.EndDate = "None `[unchanged]`"
 	}
@@ -224,14 +447,14 @@ func (e *Event) Diff(otherEvent *Event) DiffEvent {
 	oldAttendees := func() string {
 		attendees := make([]string, len(e.Attendees))
 		for i, attendee := range e.Attendees {
-			attendees[i] = attendee.Data
+			attendees[i] = attendee.Label()
 		}
 		return strings.Join(attendees, ", ")
 	}()
 	newAttendees := func() string {
 		var attendees []string
 		for _, attendeeModel := range otherEvent.Attendees {
-			attendees = append(attendees, attendeeModel.Data)
+			attendees = append(attendees, attendeeModel.Label())
 		}
 		return strings.Join(attendees, ", ")
 	}()
@@ -248,3 +471,47 @@ func (e *Event) Diff(otherEvent *Event) DiffEvent {
 
 	return diff
 }
+
+// Build an iTIP message about the event, either inviting its attendees
+// (REQUEST) or telling them the event is cancelled (CANCEL). The attendees
+// that can't be reached, i.e. without a cal-address, are left out.
+func (e *Event) ToItip(method ical.Method, organizerCalAddress string) (*ical.Calendar, error) {
+	undecidedEvent := e.toUndecidedEvent()
+	undecidedEvent.
+		SetOrganizer(organizerCalAddress).
+		SetOrganizerCn(e.Organizer).
+		SetSequence(e.Sequence)
+	for _, attendeeModel := range e.Attendees {
+		attendee, ok := attendeeModel.ToIcalAttendee()
+		if !ok {
+			continue
+		}
+		attendee.SetRsvp(method == ical.MethodRequest)
+		undecidedEvent.AddAttendee(attendee)
+	}
+	if method == ical.MethodCancel {
+		// a cancellation must supersede the invitations sent so far
+		undecidedEvent.SetSequence(e.Sequence + 1)
+		undecidedEvent.SetStatus(event.EventStatusCancelled)
+	}
+
+	icalEventInter, err := undecidedEvent.DecideEventType()
+	if err != nil {
+		return nil, fmt.Errorf("(*Event).ToItip: %w", err)
+	}
+	icalEvent, ok := icalEventInter.(event.MasterEvent)
+	if !ok {
+		return nil, fmt.Errorf("(*Event).ToItip: not a master event")
+	}
+
+	icalCalendar := ical.NewCalendar()
+	if err := icalCalendar.SetProdID("-//towd//calendar//EN"); err != nil {
+		return nil, fmt.Errorf("(*Event).ToItip: %w", err)
+	}
+	icalCalendar.SetMethod(method)
+	icalCalendar.SetName(e.Summary)
+	if err := icalCalendar.AddMasterEvent(icalEvent.GetID(), &icalEvent); err != nil {
+		return nil, fmt.Errorf("(*Event).ToItip: %w", err)
+	}
+	return &icalCalendar, nil
+}
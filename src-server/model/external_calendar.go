@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -11,6 +12,14 @@ type DeletedCalendarIDsCtxKeyType string
 
 const DeletedCalendarIDsCtxKey DeletedCalendarIDsCtxKeyType = "calendar-id"
 
+const (
+	// the shortest refresh interval a calendar can have
+	MinRefreshInterval = 5 * time.Minute
+	// the longest a failing calendar waits between two refreshes, unless its
+	// refresh interval is longer
+	MaxRefreshBackoff = 24 * time.Hour
+)
+
 type ExternalCalendar struct {
 	bun.BaseModel `bun:"table:external_calendars"`
 
@@ -18,9 +27,25 @@ type ExternalCalendar struct {
 	ProdID      string `bun:"prod_id"`
 	Name        string `bun:"name,notnull"` // required
 	Description string `bun:"description"`
-	Url         string `bun:"url,unique"`
-	Hash        string `bun:"hash,unique"`
-	ChannelID   string `bun:"channel_id"`
+	Url         string `bun:"url,unique,nullzero"`  // blank for a calendar imported from a file
+	Hash        string `bun:"hash,unique,nullzero"` // the SHA-256 of the last fetched content
+	// the validators of the last fetch, to only download the calendar again
+	// if it changed
+	ETag         string `bun:"etag"`
+	LastModified string `bun:"last_modified"`
+	ChannelID    string `bun:"channel_id"`
+
+	// How often the calendar is refreshed in seconds, the default interval
+	// if 0
+	RefreshInterval int64 `bun:"refresh_interval"`
+	// The outcome of the refreshes: when the calendar was last fetched, the
+	// error of the last refresh if it failed, how many refreshes failed in a
+	// row and when the next one is due, right away for the calendars added
+	// before the refreshes were scheduled
+	LastSyncedAt  int64  `bun:"last_synced_at"`
+	LastError     string `bun:"last_error"`
+	FailureCount  int    `bun:"failure_count"`
+	NextRefreshAt int64  `bun:"next_refresh_at,notnull,default:0"`
 
 	Events []*Event `bun:"rel:has-many,join:id=calendar_id"`
 }
@@ -47,10 +72,52 @@ func (c *ExternalCalendar) Upsert(ctx context.Context, db bun.IDB) error {
 		Set("description = EXCLUDED.description").
 		Set("url = EXCLUDED.url").
 		Set("hash = EXCLUDED.hash").
+		Set("etag = EXCLUDED.etag").
+		Set("last_modified = EXCLUDED.last_modified").
 		Set("channel_id = EXCLUDED.channel_id").
+		Set("refresh_interval = EXCLUDED.refresh_interval").
+		Set("last_synced_at = EXCLUDED.last_synced_at").
+		Set("last_error = EXCLUDED.last_error").
+		Set("failure_count = EXCLUDED.failure_count").
+		Set("next_refresh_at = EXCLUDED.next_refresh_at").
 		Exec(ctx); err != nil {
 		return fmt.Errorf("(*Calendar).Upsert: can't upsert calendar: %w", err)
 	}
 
 	return nil
 }
+
+// Get how often the calendar is refreshed, the default interval if it doesn't
+// have one of its own
+func (c *ExternalCalendar) GetRefreshInterval(defaultInterval time.Duration) time.Duration {
+	if c.RefreshInterval <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(c.RefreshInterval) * time.Second
+}
+
+// Record the outcome of a refresh and schedule the next one. A failing
+// calendar is retried less and less often: the wait doubles with each failure
+// in a row, up to MaxRefreshBackoff.
+func (c *ExternalCalendar) RecordRefresh(now time.Time, refreshErr error, defaultInterval time.Duration) {
+	interval := c.GetRefreshInterval(defaultInterval)
+	if refreshErr == nil {
+		c.LastSyncedAt = now.Unix()
+		c.LastError = ""
+		c.FailureCount = 0
+		c.NextRefreshAt = now.Add(interval).Unix()
+		return
+	}
+
+	c.LastError = refreshErr.Error()
+	c.FailureCount++
+	wait := interval
+	for range c.FailureCount {
+		if wait >= MaxRefreshBackoff {
+			break
+		}
+		wait *= 2
+	}
+	wait = min(wait, max(MaxRefreshBackoff, interval))
+	c.NextRefreshAt = now.Add(wait).Unix()
+}
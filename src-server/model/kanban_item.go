@@ -3,6 +3,9 @@ package model
 import (
 	"context"
 	"fmt"
+	"strings"
+	"towd/src-server/ical/structured"
+	"towd/src-server/ical/utils"
 
 	"github.com/uptrace/bun"
 )
@@ -37,3 +40,41 @@ func (k *KanbanItem) Upsert(ctx context.Context, db bun.IDB) error {
 
 	return nil
 }
+
+// Export the item as a VTODO. The group name is kept in CATEGORIES, and items
+// in a "done"-like group are marked as completed.
+func (k *KanbanItem) ToIcalTodo() structured.Todo {
+	todo := structured.NewTodo()
+	todo.
+		SetID(fmt.Sprintf("kanban-%d-%s", k.ID, k.ChannelID)).
+		SetSummary(k.Content).
+		SetStatus(structured.TodoStatusNeedsAction)
+	switch strings.ToLower(k.GroupName) {
+	case "done", "completed", "complete", "finished":
+		todo.SetStatus(structured.TodoStatusCompleted).SetPercentComplete(100)
+	}
+	if k.GroupName != "" {
+		_ = todo.AddIcalProperty("CATEGORIES:" + utils.EscapeText(k.GroupName))
+	}
+	return todo
+}
+
+// Create an item from a VTODO, to be inserted into the given group. Returns
+// false if the todo has nothing to use as the item content.
+func KanbanItemFromIcalTodo(todo *structured.Todo, groupName string, channelID string) (KanbanItem, bool) {
+	content := strings.TrimSpace(todo.GetSummary())
+	if description := strings.TrimSpace(todo.GetDescription()); description != "" {
+		if content != "" {
+			content += "\n"
+		}
+		content += description
+	}
+	if content == "" {
+		return KanbanItem{}, false
+	}
+	return KanbanItem{
+		Content:   content,
+		GroupName: groupName,
+		ChannelID: channelID,
+	}, true
+}
@@ -9,6 +9,7 @@ import (
 	"towd/src-server/utils"
 
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
 func Calendar(muxer *http.ServeMux, as *utils.AppState) {
@@ -27,6 +28,8 @@ func Calendar(muxer *http.ServeMux, as *utils.AppState) {
 		StartDateUnixUTC int64  `json:"startDateUnixUTC"`
 		EndDateUnixUTC   int64  `json:"endDateUnixUTC"`
 		IsWholeDay       bool   `json:"isWholeDay"`
+		IsFloating       bool   `json:"isFloating"`
+		RecurrenceID     int64  `json:"recurrenceIDUnixUTC,omitempty"` // set for the occurrences of a recurring event
 	}
 
 	// get all events in date range
@@ -57,22 +60,20 @@ func Calendar(muxer *http.ServeMux, as *utils.AppState) {
 			// #endregion
 
 			// #region - get all events & prepare response body
-			eventModels := make([]model.Event, 0)
-			if err := as.BunDB.
-				NewSelect().
-				Model(&eventModels).
-				Where("channel_id = ?", sessionModel.ChannelID).
-				Where("start_date >= ?", startDate.Unix()).
-				Where("end_date <= ?", endDate.Unix()).
-				Relation("Attendees").
-				Scan(r.Context()); err != nil {
+			occurrences, err := model.SelectOccurrences(r.Context(), as.BunDB, startDate, endDate, func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Where("channel_id = ?", sessionModel.ChannelID)
+			})
+			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Write([]byte("Can't get events"))
 				return
 			}
 
 			respBody := make([]OneEventRespBody, 0)
-			for _, event := range eventModels {
+			for _, event := range occurrences {
+				if event.StartDateUnixUTC < startDate.Unix() || event.EndDateUnixUTC > endDate.Unix() {
+					continue
+				}
 				respBody = append(respBody, OneEventRespBody{
 					ID:               event.ID,
 					Title:            event.Summary,
@@ -83,6 +84,8 @@ func Calendar(muxer *http.ServeMux, as *utils.AppState) {
 					StartDateUnixUTC: event.StartDateUnixUTC,
 					EndDateUnixUTC:   event.EndDateUnixUTC,
 					IsWholeDay:       event.IsWholeDay,
+					IsFloating:       event.IsFloating,
+					RecurrenceID:     event.RecurrenceID,
 				})
 			}
 			respBodyJson, err := json.Marshal(respBody)
@@ -0,0 +1,149 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"towd/src-server/ical"
+	"towd/src-server/ical/structured"
+	"towd/src-server/model"
+	"towd/src-server/utils"
+
+	"github.com/uptrace/bun"
+)
+
+func FreeBusy(muxer *http.ServeMux, as *utils.AppState) {
+	type BusyRespBody struct {
+		StartDateUnixUTC int64 `json:"startDateUnixUTC"`
+		EndDateUnixUTC   int64 `json:"endDateUnixUTC"`
+	}
+
+	type FreeBusyRespBody struct {
+		StartDateUnixUTC int64          `json:"startDateUnixUTC"`
+		EndDateUnixUTC   int64          `json:"endDateUnixUTC"`
+		Busy             []BusyRespBody `json:"busy"`
+	}
+
+	// accept both unix timestamps and RFC3339 dates
+	parseDate := func(raw string, fallback time.Time) (time.Time, error) {
+		if raw == "" {
+			return fallback, nil
+		}
+		if unixTime, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return time.Unix(unixTime, 0).UTC(), nil
+		}
+		return time.Parse(time.RFC3339, raw)
+	}
+
+	// get the busy intervals of a channel, including its external calendars.
+	// Only the intervals are returned, never the events themselves, and only
+	// to a session of that channel.
+	muxer.HandleFunc("GET /freebusy/{channel_id}", AuthMiddleware(as, func(w http.ResponseWriter, r *http.Request) {
+		sessionModel, ok := r.Context().Value(SessionCtxKey).(*model.Session)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Can't get session from middleware"))
+			return
+		}
+		channelID := r.PathValue("channel_id")
+		if channelID != sessionModel.ChannelID {
+			http.Error(w, "The session doesn't belong to this channel", http.StatusForbidden)
+			return
+		}
+
+		// #region - parse date range
+		now := time.Now().UTC()
+		startDate, err := parseDate(r.URL.Query().Get("start"), now)
+		if err != nil {
+			http.Error(w, "Invalid start date, expecting a unix timestamp or an RFC3339 date", http.StatusBadRequest)
+			return
+		}
+		endDate, err := parseDate(r.URL.Query().Get("end"), startDate.AddDate(0, 0, 7))
+		if err != nil {
+			http.Error(w, "Invalid end date, expecting a unix timestamp or an RFC3339 date", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case !startDate.Before(endDate):
+			http.Error(w, "The start date must be before the end date", http.StatusBadRequest)
+			return
+		case endDate.Sub(startDate) > 366*24*time.Hour:
+			http.Error(w, "The date range must not exceed a year", http.StatusBadRequest)
+			return
+		}
+		// #endregion
+
+		// #region - compute busy intervals
+		startTimer := time.Now()
+		// the whole-day events without an end date may have started the day
+		// before the range, and the whole-day and floating events are up to a
+		// day away from their instant in the server's timezone
+		occurrences, err := model.SelectOccurrences(r.Context(), as.BunDB, startDate.Add(-48*time.Hour), endDate.Add(24*time.Hour), func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("channel_id = ?", channelID)
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Can't get events: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		as.MetricChans.DatabaseRead <- float64(time.Since(startTimer).Microseconds())
+
+		freeBusy := structured.NewFreeBusy(startDate.Unix(), endDate.Unix())
+		for _, eventModel := range occurrences {
+			// the transparent and cancelled events leave the time free
+			if !eventModel.IsBusy() {
+				continue
+			}
+			endDateUnixUTC := eventModel.EndDateUnixUTC
+			if endDateUnixUTC == 0 && eventModel.IsWholeDay {
+				endDateUnixUTC = eventModel.StartDateUnixUTC + 24*60*60
+			}
+			loc := as.Config.GetLocation()
+			freeBusy.AddBusy(eventModel.Instant(eventModel.StartDateUnixUTC, loc), eventModel.Instant(endDateUnixUTC, loc))
+		}
+		// #endregion
+
+		w.Header().Set("Vary", "Accept")
+
+		// #region - write as JSON
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			respBody := FreeBusyRespBody{
+				StartDateUnixUTC: freeBusy.GetStartDate(),
+				EndDateUnixUTC:   freeBusy.GetEndDate(),
+				Busy:             make([]BusyRespBody, 0),
+			}
+			for _, period := range freeBusy.GetBusy() {
+				respBody.Busy = append(respBody.Busy, BusyRespBody{
+					StartDateUnixUTC: period.Start,
+					EndDateUnixUTC:   period.End,
+				})
+			}
+			respBodyJson, err := json.Marshal(respBody)
+			if err != nil {
+				http.Error(w, "Can't marshal response body", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(respBodyJson)
+			return
+		}
+		// #endregion
+
+		// #region - write as iCalendar
+		icalCalendar := ical.NewCalendar()
+		if err := icalCalendar.AddFreeBusy(&freeBusy); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := icalCalendar.ToIcal(w); err != nil {
+			slog.Warn("can't write to response", "where", "routes/freebusy.go", "err", err)
+		}
+		// #endregion
+	}))
+}
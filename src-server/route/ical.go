@@ -1,11 +1,12 @@
 package route
 
 import (
-	"io"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 	"towd/src-server/ical"
-	"towd/src-server/ical/event"
 	"towd/src-server/model"
 	"towd/src-server/utils"
 )
@@ -14,17 +15,39 @@ func Ical(muxer *http.ServeMux, as *utils.AppState) {
 	muxer.HandleFunc("GET /ical/{calendar_id}", func(w http.ResponseWriter, r *http.Request) {
 		calendarID := r.PathValue("calendar_id")
 
-		// getting the calendar model
+		// getting the calendar model, a channel calendar is served at its feed
+		// token rather than at the ID of its channel, which is public
 		calendalModel := new(model.ExternalCalendar)
-		if err := as.BunDB.NewSelect().
+		isChannelCalendar := false
+		err := as.BunDB.NewSelect().
 			Model(calendalModel).
 			Where("id = ?", calendarID).
-			Scan(r.Context(), calendalModel); err != nil {
+			Scan(r.Context(), calendalModel)
+		if errors.Is(err, sql.ErrNoRows) {
+			channelCalendarModel := new(model.Calendar)
+			err = as.BunDB.NewSelect().
+				Model(channelCalendarModel).
+				Where("feed_token = ?", calendarID).
+				Scan(r.Context(), channelCalendarModel)
+			calendalModel.ID = channelCalendarModel.ChannelID
+			calendalModel.ChannelID = channelCalendarModel.ChannelID
+			isChannelCalendar = true
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "calendar not found", http.StatusNotFound)
+			return
+		case err != nil:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if calendalModel.Url != "" {
+		// jCal is served from the stored events, even for the calendars having
+		// an upstream URL, since the upstream only speaks iCalendar
+		w.Header().Set("Vary", "Accept")
+		wantsJCal := strings.Contains(r.Header.Get("Accept"), "application/calendar+json")
+
+		if calendalModel.Url != "" && !wantsJCal {
 			http.Redirect(w, r, calendalModel.Url, http.StatusFound)
 			return
 		}
@@ -36,30 +59,43 @@ func Ical(muxer *http.ServeMux, as *utils.AppState) {
 			if err := as.BunDB.
 				NewSelect().
 				Model(&eventModels).
-				Where("calendar_id = ?", calendarID).
+				Where("calendar_id = ?", calendalModel.ID).
 				Relation("Attendees").
+				Relation("Overrides").
+				Relation("Alarms").
 				Scan(r.Context(), &eventModels); err != nil {
 				return nil, err
 			}
+			// the recurring events are written as they are, with their
+			// RRULE and overrides, for the clients to expand them
 			for _, eventModel := range eventModels {
-				undecidedEvent := event.NewUndecidedEvent()
-				undecidedEvent.
-					SetID(eventModel.ID).
-					SetSummary(eventModel.Summary).
-					SetDescription(eventModel.Description).
-					SetLocation(eventModel.Location).
-					SetURL(eventModel.URL).
-					SetStartDate(eventModel.StartDateUnixUTC).
-					SetEndDate(eventModel.EndDateUnixUTC).
-					SetOrganizer(eventModel.Organizer)
-				icalEventInter, err := undecidedEvent.DecideEventType()
+				icalEvent, err := eventModel.ToIcalEvent()
 				if err != nil {
 					return nil, err
 				}
-				if icalEvent, ok := icalEventInter.(event.MasterEvent); ok {
-					icalCalendar.AddMasterEvent(icalEvent.GetID(), &icalEvent)
+				icalCalendar.AddMasterEvent(icalEvent.GetID(), icalEvent)
+			}
+
+			// the kanban board of the channel, as VTODOs, only in the
+			// channel's own calendar
+			if !isChannelCalendar {
+				return &icalCalendar, nil
+			}
+			itemModels := make([]model.KanbanItem, 0)
+			if err := as.BunDB.
+				NewSelect().
+				Model(&itemModels).
+				Where("channel_id = ?", calendalModel.ChannelID).
+				Scan(r.Context(), &itemModels); err != nil {
+				return nil, err
+			}
+			for _, itemModel := range itemModels {
+				todo := itemModel.ToIcalTodo()
+				if err := icalCalendar.AddTodo(todo.GetID(), &todo); err != nil {
+					return nil, err
 				}
 			}
+
 			return &icalCalendar, nil
 		}()
 		if err != nil {
@@ -67,17 +103,26 @@ func Ical(muxer *http.ServeMux, as *utils.AppState) {
 			return
 		}
 
-		// write the ical calendar
-		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		writer := func(s string) {
-			if _, err := io.WriteString(w, s); err != nil {
+		// write the jcal calendar
+		if wantsJCal {
+			jcal, err := icalCalendar.ToJCal()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/calendar+json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(jcal); err != nil {
 				slog.Warn("can't write to response", "where", "routes/ical.go", "err", err)
 			}
-		}
-		if err := icalCalendar.ToIcal(writer); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+
+		// write the ical calendar
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := icalCalendar.ToIcal(w); err != nil {
+			slog.Warn("can't write to response", "where", "routes/ical.go", "err", err)
+		}
 	})
 }
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 	"towd/src-server/ical"
+	"towd/src-server/ical/event"
 	"towd/src-server/model"
 	"towd/src-server/utils"
 
@@ -16,120 +17,150 @@ import (
 
 const (
 	WORKER_COUNT = 4
+	// how often the calendars due for a refresh are looked for
+	calendarUpdateTick = time.Minute
+	// the channel is told about a failing calendar after this many refreshes
+	// failed in a row
+	refreshFailureReportThreshold = 3
 )
 
 func CalendarUpdate(as *utils.AppState) {
 	for {
+		time.Sleep(min(calendarUpdateTick, as.Config.GetCalendarUpdateInterval()))
+
+		// the calendars imported from a URL, due for a refresh
 		externalCalendars := []model.ExternalCalendar{}
 		if err := as.BunDB.
 			NewSelect().
 			Model(&externalCalendars).
-			Where("url LIKE ?", "https://%").
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.
+					Where("url LIKE ?", "https://%").
+					WhereOr("url LIKE ?", "http://%")
+			}).
+			// the column was once added without a default, leaving it NULL
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.
+					Where("next_refresh_at <= ?", time.Now().UTC().Unix()).
+					WhereOr("next_refresh_at IS NULL")
+			}).
 			Scan(context.Background()); err != nil {
 			slog.Error("can't get calendars", "error", err)
-			time.Sleep(as.Config.GetCalendarUpdateInterval())
 			continue
 		}
 		if len(externalCalendars) == 0 {
-			time.Sleep(as.Config.GetCalendarUpdateInterval())
 			continue
 		}
 
-		jobs := make(chan model.ExternalCalendar, len(externalCalendars))
-		var wg sync.WaitGroup
+		jobs := make(chan *model.ExternalCalendar, len(externalCalendars))
+		for i := range externalCalendars {
+			jobs <- &externalCalendars[i]
+		}
+		close(jobs)
 
+		var wg sync.WaitGroup
 		for range WORKER_COUNT {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				for oldExternalCalModel := range jobs {
-					calCh := make(chan *ical.Calendar)
-					errCh := make(chan error)
-
-					go func() {
-						iCalCalendar, err := ical.FromIcalUrl(oldExternalCalModel.Url)
-						if err != nil {
-							errCh <- err
-							return
-						}
-						calCh <- iCalCalendar
-					}()
-
-					select {
-					case <-time.After(time.Minute * 5):
-						slog.Warn("CalendarUpdate: timed out waiting for calendar to be fetched & parsed")
-					case err := <-errCh:
-						slog.Warn("CalendarUpdate: can't fetch calendar", "url", oldExternalCalModel.Url, "error", err)
-					case icalCal := <-calCh:
-						if err := as.BunDB.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
-							// remove old calendar model & events
-							if _, err := tx.NewDelete().
-								Model((*model.Event)(nil)).
-								Where("calendar_id = ?", oldExternalCalModel.ID).
-								Exec(ctx); err != nil {
-								return fmt.Errorf("can't delete old events: %w", err)
-							}
-							if _, err := tx.NewDelete().
-								Model((*model.ExternalCalendar)(nil)).
-								Where("id = ?", oldExternalCalModel.ID).
-								Exec(ctx); err != nil {
-								return fmt.Errorf("can't delete old calendar: %w", err)
-							}
-
-							// create new calendar model and insert to DB
-							hash, err := utils.GetFileHash(oldExternalCalModel.Url)
-							if err != nil {
-								return err
-							}
-							newExternalCalModel := model.ExternalCalendar{
-								ID:          icalCal.GetID(),
-								ProdID:      icalCal.GetProdID(),
-								Name:        icalCal.GetName(),
-								Description: icalCal.GetDescription(),
-								Url:         oldExternalCalModel.Url,
-								Hash:        hash,
-								ChannelID:   oldExternalCalModel.ChannelID,
-							}
-							if _, err := tx.
-								NewInsert().
-								Model(&newExternalCalModel).
-								Exec(ctx); err != nil {
-								return err
-							}
-
-							eventModels := make([]model.Event, 0)
-							for _, event := range icalCal.ToStaticEvents() {
-								eventModels = append(eventModels, model.Event{
-									ID:               fmt.Sprintf("%s-%s", event.ID, oldExternalCalModel.ChannelID),
-									Summary:          event.Title,
-									Description:      event.Description,
-									Location:         event.Location,
-									URL:              event.URL,
-									Organizer:        event.Organizer,
-									StartDateUnixUTC: event.StartDate,
-									EndDateUnixUTC:   event.EndDate,
-									CalendarID:       newExternalCalModel.ID,
-									ChannelID:        oldExternalCalModel.ChannelID,
-								})
-							}
-							if _, err := tx.NewInsert().
-								Model(&eventModels).
-								Exec(ctx); err != nil {
-								return err
-							}
-							return nil
-						}); err != nil {
-							slog.Warn("CalendarUpdate: can't insert calendar", "url", oldExternalCalModel.Url, "error", err)
-						}
-						close(calCh)
-						close(errCh)
+				for externalCalendar := range jobs {
+					if err := RefreshCalendar(as, externalCalendar); err != nil {
+						slog.Warn("CalendarUpdate: can't refresh calendar", "url", externalCalendar.Url, "error", err)
 					}
 				}
 			}()
 		}
 
 		wg.Wait()
+	}
+}
 
-		time.Sleep(as.Config.GetCalendarUpdateInterval())
+// Refresh an external calendar, see syncCalendar, then record the outcome
+// and schedule the next refresh. The channel of the calendar is told once it
+// failed too many times in a row.
+func RefreshCalendar(as *utils.AppState, externalCalendar *model.ExternalCalendar) error {
+	refreshErr := syncCalendar(as, externalCalendar)
+	externalCalendar.RecordRefresh(time.Now().UTC(), refreshErr, as.Config.GetCalendarUpdateInterval())
+	if _, err := as.BunDB.NewUpdate().
+		Model(externalCalendar).
+		Column("etag", "last_modified", "last_synced_at", "last_error", "failure_count", "next_refresh_at").
+		WherePK().
+		Exec(context.Background()); err != nil {
+		slog.Warn("RefreshCalendar: can't save refresh outcome", "url", externalCalendar.Url, "error", err)
+	}
+
+	if refreshErr != nil && externalCalendar.FailureCount == refreshFailureReportThreshold {
+		msg := fmt.Sprintf(
+			"Can't refresh calendar `%s` (`%s`) after %d attempts, it will be retried less and less often:\n```\n%s\n```\nUse `/calendar refresh` to retry now.",
+			externalCalendar.Name,
+			externalCalendar.ID,
+			externalCalendar.FailureCount,
+			externalCalendar.LastError,
+		)
+		if _, err := as.DgSession.ChannelMessageSend(externalCalendar.ChannelID, msg); err != nil {
+			slog.Warn("RefreshCalendar: can't send message about failing calendar", "error", err)
+		}
+	}
+	return refreshErr
+}
+
+// Fetch an external calendar again and sync its events, unless it didn't
+// change since the last fetch. The calendar and its events keep their IDs.
+// The calendar is updated once its new version is stored.
+func syncCalendar(as *utils.AppState, externalCalendar *model.ExternalCalendar) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+	result, customErr := ical.FetchIcalIfChanged(ctx, externalCalendar.Url, ical.FetchValidators{
+		ETag:         externalCalendar.ETag,
+		LastModified: externalCalendar.LastModified,
+		Hash:         externalCalendar.Hash,
+	}, ical.ParseOptions{})
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("timed out waiting for calendar to be fetched & parsed")
+	case customErr != nil:
+		return customErr
+	}
+
+	if result.Unchanged {
+		// the content is the same, only the validators may be new
+		externalCalendar.ETag = result.Validators.ETag
+		externalCalendar.LastModified = result.Validators.LastModified
+		return nil
+	}
+
+	icalCal := result.Calendar
+	if skippedCount := ical.CountDiagnostics(result.Diagnostics, ical.DiagnosticSeverityError); skippedCount > 0 {
+		slog.Warn("CalendarUpdate: some components were skipped", "url", externalCalendar.Url, "count", skippedCount)
+	}
+	// the calendar keeps its ID and the name it was imported with
+	newExternalCalModel := *externalCalendar
+	newExternalCalModel.ProdID = icalCal.GetProdID()
+	newExternalCalModel.Description = icalCal.GetDescription()
+	newExternalCalModel.Hash = result.Validators.Hash
+	newExternalCalModel.ETag = result.Validators.ETag
+	newExternalCalModel.LastModified = result.Validators.LastModified
+	if err := as.BunDB.RunInTx(context.Background(), &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		if err := newExternalCalModel.Upsert(ctx, tx); err != nil {
+			return err
+		}
+
+		// the recurring events are stored with their recurrence, they're
+		// expanded on read
+		eventModels := make([]model.Event, 0)
+		if err := icalCal.IterateMasterEvents(func(id string, masterEvent *event.MasterEvent) error {
+			eventModels = append(eventModels, model.EventFromIcal(masterEvent, externalCalendar.ID, externalCalendar.ChannelID))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if _, err := model.SyncEvents(ctx, tx, externalCalendar.ID, eventModels); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
+	*externalCalendar = newExternalCalModel
+	return nil
 }
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
 	"time"
 	"towd/src-server/model"
@@ -10,26 +11,72 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
+const (
+	// the reminder of the events without any alarm, before their start
+	defaultReminderLead = 15 * time.Minute
+	// a reminder late by more than this, e.g. while the bot was down, is
+	// dropped
+	reminderGracePeriod = 15 * time.Minute
+	// how far the whole-day and floating dates, stored as if they were in
+	// UTC, can be from their instant in the server's timezone
+	maxUTCOffset = 14 * time.Hour
+)
+
 func EventNotify(as *utils.AppState) {
 	for {
 		time.Sleep(time.Second * 30)
+		now := time.Now().UTC()
+
+		// how long before or after an occurrence its alarms can go off
+		var maxLead, maxLag sql.NullInt64
+		if err := as.BunDB.NewSelect().
+			Model((*model.Alarm)(nil)).
+			ColumnExpr("MAX(-trigger_offset)").
+			ColumnExpr("MAX(trigger_offset + repeat * duration)").
+			Where("trigger_related != ''").
+			Scan(context.Background(), &maxLead, &maxLag); err != nil {
+			slog.Error("EventNotify: can't get the alarms reach", "error", err)
+			continue
+		}
+		lead := max(defaultReminderLead, time.Duration(maxLead.Int64)*time.Second)
+		lag := max(0, time.Duration(maxLag.Int64)*time.Second)
 
-		// get all eventModels starting in 15 minutes from now
-		eventModels := make([]model.Event, 0)
-		if err := as.BunDB.
-			NewSelect().
-			Model(&eventModels).
+		// get all the occurrences which may have a reminder going off now
+		occurrences, err := model.SelectOccurrences(context.Background(), as.BunDB, now.Add(-lag-reminderGracePeriod-maxUTCOffset), now.Add(lead+time.Second+maxUTCOffset), nil)
+		if err != nil {
+			slog.Error("can't get events", "error", err)
+			continue
+		}
+		// the alarms at an absolute date go off whenever the occurrences are
+		absoluteAlarmEvents := make([]model.Event, 0)
+		if err := as.BunDB.NewSelect().
+			Model(&absoluteAlarmEvents).
 			Relation("Attendees").
-			Where("start_date > ?", time.Now().UTC().Unix()).
-			Where("start_date < ?", time.Now().UTC().Add(15*time.Minute).Unix()).
-			Where("notification_sent = ?", false).
+			Relation("Alarms").
+			Where("id IN (?)", as.BunDB.NewSelect().
+				Model((*model.Alarm)(nil)).
+				Column("event_id").
+				Where("trigger_related = ''").
+				Where("trigger_date > ?", now.Add(-reminderGracePeriod).Unix()).
+				Where("trigger_date <= ?", now.Unix())).
 			Scan(context.Background()); err != nil {
 			slog.Error("can't get events", "error", err)
 			continue
 		}
 
+		// one reminder per event, for its earliest occurrence with a reminder
+		// due
 		channelsToEventModels := make(map[string][]*model.Event)
-		for _, event := range eventModels {
+		dueReminders := make(map[string]int64)
+		for _, event := range append(occurrences, absoluteAlarmEvents...) {
+			if _, ok := dueReminders[event.ID]; ok {
+				continue
+			}
+			dueReminder := getDueReminder(&event, now, as.Config.GetLocation())
+			if dueReminder == 0 {
+				continue
+			}
+			dueReminders[event.ID] = dueReminder
 			channelsToEventModels[event.ChannelID] = append(channelsToEventModels[event.ChannelID], &event)
 		}
 
@@ -48,16 +95,52 @@ func EventNotify(as *utils.AppState) {
 				continue
 			}
 
-			if _, err := as.BunDB.NewUpdate().
-				With("_data", as.BunDB.NewValues(&eventModels)).
-				Model((*model.Event)(nil)).
-				TableExpr("_data").
-				Set("notification_sent = ?", true).
-				Where("event.id = _data.id").
-				Exec(context.Background()); err != nil {
-				slog.Error("EventNotify: can't update notification_sent field", "error", err)
-				continue
+			for _, event := range eventModels {
+				if _, err := as.BunDB.NewUpdate().
+					Model((*model.Event)(nil)).
+					Set("notification_sent = ?", true).
+					Set("notified_until = ?", dueReminders[event.ID]).
+					Where("id = ?", event.ID).
+					Exec(context.Background()); err != nil {
+					slog.Error("EventNotify: can't update notification_sent field", "error", err)
+				}
 			}
 		}
 	}
 }
+
+// Get the date of the latest reminder of the occurrence going off by now
+// and not sent yet, 0 if there is none. The alarms of the event must be
+// loaded; an event without alarms is reminded of before its start, a
+// cancelled one isn't reminded of. The whole-day and floating events are
+// reminded of in the server's timezone.
+func getDueReminder(event *model.Event, now time.Time, loc *time.Location) int64 {
+	if event.IsCancelled() {
+		return 0
+	}
+	notifiedUntil := event.NotifiedUntil
+	if event.RRule == "" && event.NotificationSent && notifiedUntil == 0 {
+		// notified before the reminders followed the alarms
+		notifiedUntil = event.Instant(event.StartDateUnixUTC, loc)
+	}
+
+	startDate, endDate := event.Instant(event.StartDateUnixUTC, loc), event.Instant(event.EndDateUnixUTC, loc)
+	reminders := []int64{startDate - int64(defaultReminderLead.Seconds())}
+	if len(event.Alarms) > 0 {
+		reminders = reminders[:0]
+		for _, alarm := range event.Alarms {
+			reminders = append(reminders, alarm.TriggerDates(startDate, endDate)...)
+		}
+	}
+
+	dueReminder := int64(0)
+	for _, reminder := range reminders {
+		if reminder > notifiedUntil &&
+			reminder > now.Add(-reminderGracePeriod).Unix() &&
+			reminder <= now.Unix() &&
+			reminder > dueReminder {
+			dueReminder = reminder
+		}
+	}
+	return dueReminder
+}
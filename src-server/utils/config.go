@@ -22,6 +22,7 @@ type Config struct {
 
 	location           *time.Location
 	staticWebClientDir string
+	publicURL          string
 
 	eventNotifyInterval      time.Duration
 	calendarUpdateInterval   time.Duration
@@ -152,6 +153,14 @@ func NewConfig() *Config {
 			return filepath.Clean(staticWebClientDir)
 		}(),
 
+		publicURL: func() string {
+			publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+			if publicURL == "" {
+				slog.Warn("PUBLIC_URL is not set, the links posted to Discord will be relative")
+			}
+			slog.Debug("env", "PUBLIC_URL", publicURL)
+			return publicURL
+		}(),
 		eventNotifyInterval: func() time.Duration {
 			eventNotifyInterval := os.Getenv("EVENT_NOTIFY_INTERVAL")
 			if eventNotifyInterval == "" {
@@ -247,6 +256,12 @@ func (c *Config) GetStaticWebClientDir() string {
 	return c.staticWebClientDir
 }
 
+// Get PUBLIC_URL env, the URL the server is reached at without a trailing
+// slash, e.g. https://towd.example.com
+func (c *Config) GetPublicURL() string {
+	return c.publicURL
+}
+
 // Get EVENT_NOTIFY_INTERVAL env
 func (c *Config) GetEventNotifyInterval() time.Duration {
 	return c.eventNotifyInterval
@@ -16,6 +16,8 @@ export interface OneEventRespBody {
 	startDateUnixUTC: number;
 	endDateUnixUTC: number;
 	isWholeDay?: boolean;
+	/** Set for the occurrences of a recurring event, which share its id. */
+	recurrenceIDUnixUTC?: number;
 }
 
 /** Get all events in a date range. */